@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/example/prreview/pkg/client"
+)
+
+const clientUsage = `client commands:
+  team add -name T -member id:name[:inactive]...
+  team get -name T
+  pr create -id ID -title T -author U [-team T] [-file path]...
+  pr get -id ID
+  pr merge -id ID [-force -reason R]
+  pr reassign -id ID -reviewer U
+  user set-active -id U -active=true|false
+  user reviews -id U
+
+client flags:
+  -server url    API base URL (env PRREVIEW_SERVER, default http://localhost:8080)
+  -token t       API token (env PRREVIEW_TOKEN)
+  -o format      table or json (default table)
+  -timeout d     request timeout (default 30s)
+
+client exit codes:
+  1 other failure, 2 usage, 3 BAD_REQUEST, 4 UNAUTHORIZED, 5 FORBIDDEN,
+  6 NOT_FOUND, 10 TEAM_EXISTS, 11 PR_EXISTS, 12 USER_EXISTS, 20 PR_MERGED,
+  21 NOT_ASSIGNED, 22 NO_CANDIDATE, 23 NOT_APPROVED, 24 TEAM_ARCHIVED,
+  25 AMBIGUOUS_TEAM, 26 ERROR, 27 PRECONDITION_FAILED, 30 RATE_LIMITED,
+  31 IDEMPOTENCY_KEY_REUSED, 32 IDEMPOTENCY_IN_PROGRESS, 40 INTERNAL
+`
+
+// exitCodes maps the API error codes to exit codes, so scripts can tell
+// failures apart without parsing output.
+var exitCodes = map[string]int{
+	client.CodeBadRequest:            3,
+	client.CodeUnauthorized:          4,
+	client.CodeForbidden:             5,
+	client.CodeNotFound:              6,
+	client.CodeTeamExists:            10,
+	client.CodePRExists:              11,
+	client.CodeUserExists:            12,
+	client.CodePRMerged:              20,
+	client.CodeNotAssigned:           21,
+	client.CodeNoCandidate:           22,
+	client.CodeNotApproved:           23,
+	client.CodeTeamArchived:          24,
+	client.CodeAmbiguousTeam:         25,
+	client.CodeError:                 26,
+	client.CodePreconditionFailed:    27,
+	client.CodeRateLimited:           30,
+	client.CodeIdempotencyKeyReused:  31,
+	client.CodeIdempotencyInProgress: 32,
+	client.CodeInternal:              40,
+}
+
+// errUsage marks mistakes in the command line; main exits with 2.
+var errUsage = errors.New("usage")
+
+// exitCode is the process exit code for an error of a command.
+func exitCode(err error) int {
+	if errors.Is(err, errUsage) {
+		return 2
+	}
+	if code, ok := exitCodes[client.ErrorCode(err)]; ok {
+		return code
+	}
+	return 1
+}
+
+type cliClient struct {
+	server  string
+	token   string
+	output  string
+	timeout time.Duration
+	api     *client.Client
+	out     io.Writer
+}
+
+// clientFlags registers the flags every client command shares.
+func clientFlags(name string) (*flag.FlagSet, *cliClient) {
+	c := &cliClient{out: os.Stdout}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&c.server, "server", envOr("PRREVIEW_SERVER", "http://localhost:8080"), "API base URL")
+	fs.StringVar(&c.token, "token", os.Getenv("PRREVIEW_TOKEN"), "API token")
+	fs.StringVar(&c.output, "o", "table", "output format: table or json")
+	fs.DurationVar(&c.timeout, "timeout", 30*time.Second, "request timeout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: prreview %s [flags]\n", name)
+		fs.PrintDefaults()
+	}
+	return fs, c
+}
+
+func parseClientFlags(fs *flag.FlagSet, c *cliClient, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %q", errUsage, fs.Arg(0))
+	}
+	if c.output != "table" && c.output != "json" {
+		return fmt.Errorf("%w: -o must be table or json", errUsage)
+	}
+	api, err := client.New(c.server, client.WithToken(c.token))
+	if err != nil {
+		return fmt.Errorf("%w: -server: %v", errUsage, err)
+	}
+	c.api = api
+	return nil
+}
+
+func required(flags map[string]string) error {
+	for _, name := range sortedKeys(flags) {
+		if flags[name] == "" {
+			return fmt.Errorf("%w: -%s is required", errUsage, name)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// context bounds one command by -timeout, retries included.
+func (c *cliClient) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+// print writes v as indented JSON with -o json and calls table otherwise.
+func (c *cliClient) print(v interface{}, table func(w *tabwriter.Writer)) error {
+	if c.output == "json" {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+// subcommand splits "team add ..." into the action and its arguments.
+func subcommand(group string, args []string, actions ...string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", nil, fmt.Errorf("%w: prreview %s %s", errUsage, group, strings.Join(actions, "|"))
+	}
+	for _, a := range actions {
+		if args[0] == a {
+			return a, args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: unknown command %q, want prreview %s %s", errUsage, args[0], group, strings.Join(actions, "|"))
+}
+
+// --- team ---
+
+// memberFlag collects -member id:name[:inactive] values.
+type memberFlag []client.TeamMember
+
+func (m *memberFlag) String() string { return "" }
+
+func (m *memberFlag) Set(v string) error {
+	parts := strings.Split(v, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("want id:name[:inactive], got %q", v)
+	}
+	member := client.TeamMember{UserID: parts[0], Username: parts[1], IsActive: true}
+	if len(parts) == 3 {
+		if parts[2] != "inactive" {
+			return fmt.Errorf("want id:name[:inactive], got %q", v)
+		}
+		member.IsActive = false
+	}
+	*m = append(*m, member)
+	return nil
+}
+
+func runTeam(args []string) error {
+	action, args, err := subcommand("team", args, "add", "get")
+	if err != nil {
+		return err
+	}
+	fs, c := clientFlags("team " + action)
+	name := fs.String("name", "", "team name")
+	var members memberFlag
+	if action == "add" {
+		fs.Var(&members, "member", "member as id:name[:inactive], repeatable")
+	}
+	if err := parseClientFlags(fs, c, args); err != nil {
+		return err
+	}
+	if err := required(map[string]string{"name": *name}); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	var team *client.Team
+	if action == "add" {
+		team, err = c.api.AddTeam(ctx, *name, members)
+	} else {
+		team, err = c.api.GetTeam(ctx, *name)
+	}
+	if err != nil {
+		return err
+	}
+	return c.print(map[string]*client.Team{"team": team}, func(w *tabwriter.Writer) { printTeam(w, team) })
+}
+
+func printTeam(w *tabwriter.Writer, t *client.Team) {
+	title := "team " + t.TeamName
+	if t.Archived {
+		title += " (archived)"
+	}
+	fmt.Fprintln(w, title)
+	fmt.Fprintln(w, "USER_ID\tUSERNAME\tACTIVE")
+	for _, m := range t.Members {
+		fmt.Fprintf(w, "%s\t%s\t%t\n", m.UserID, m.Username, m.IsActive)
+	}
+}
+
+// --- pr ---
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func runPR(args []string) error {
+	action, args, err := subcommand("pr", args, "create", "get", "merge", "reassign")
+	if err != nil {
+		return err
+	}
+	fs, c := clientFlags("pr " + action)
+	id := fs.String("id", "", "pull request id")
+	var title, author, team, reviewer, reason *string
+	var force *bool
+	var files listFlag
+	switch action {
+	case "create":
+		title = fs.String("title", "", "pull request title")
+		author = fs.String("author", "", "author user id")
+		team = fs.String("team", "", "team, if the author is in several")
+		fs.Var(&files, "file", "changed file, repeatable")
+	case "merge":
+		force = fs.Bool("force", false, "merge without the required approvals (admin)")
+		reason = fs.String("reason", "", "reason for a forced merge")
+	case "reassign":
+		reviewer = fs.String("reviewer", "", "reviewer to replace")
+	}
+	if err := parseClientFlags(fs, c, args); err != nil {
+		return err
+	}
+	need := map[string]string{"id": *id}
+	switch action {
+	case "create":
+		need["title"], need["author"] = *title, *author
+	case "reassign":
+		need["reviewer"] = *reviewer
+	}
+	if err := required(need); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	switch action {
+	case "merge":
+		pr, err := c.api.MergePR(ctx, *id, &client.MergeOptions{Force: *force, Reason: *reason})
+		if err != nil {
+			return err
+		}
+		return c.print(map[string]*client.MergedPR{"pr": pr}, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "ID\t%s\n", pr.ID)
+			fmt.Fprintf(w, "TITLE\t%s\n", pr.Title)
+			fmt.Fprintf(w, "AUTHOR\t%s\n", pr.AuthorID)
+			fmt.Fprintf(w, "STATUS\t%s\n", pr.Status)
+			fmt.Fprintf(w, "REVIEWERS\t%s\n", strings.Join(pr.Reviewers, ", "))
+			printVerdicts(w, pr.Reviews)
+		})
+	case "reassign":
+		res, err := c.api.ReassignReviewer(ctx, *id, *reviewer)
+		if err != nil {
+			return err
+		}
+		return c.print(res, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "ID\t%s\n", res.PR.ID)
+			fmt.Fprintf(w, "TITLE\t%s\n", res.PR.Title)
+			fmt.Fprintf(w, "AUTHOR\t%s\n", res.PR.AuthorID)
+			fmt.Fprintf(w, "REPLACED_BY\t%s\n", res.ReplacedBy)
+		})
+	}
+
+	var pr *client.PullRequest
+	if action == "create" {
+		pr, err = c.api.CreatePR(ctx, client.NewPR{ID: *id, Title: *title, AuthorID: *author, TeamName: *team, ChangedFiles: files})
+	} else {
+		pr, err = c.api.GetPR(ctx, *id)
+	}
+	if err != nil {
+		return err
+	}
+	return c.print(map[string]*client.PullRequest{"pr": pr}, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "ID\t%s\n", pr.PullRequestID)
+		fmt.Fprintf(w, "TITLE\t%s\n", pr.PullRequestName)
+		fmt.Fprintf(w, "AUTHOR\t%s\n", pr.AuthorID)
+		fmt.Fprintf(w, "TEAM\t%s\n", pr.Team_name)
+		fmt.Fprintf(w, "STATUS\t%s\n", pr.Status)
+		fmt.Fprintf(w, "REVIEWERS\t%s\n", strings.Join(pr.AssignedReviewers, ", "))
+		printVerdicts(w, pr.Reviews)
+	})
+}
+
+func printVerdicts(w *tabwriter.Writer, reviews []client.Review) {
+	for _, r := range reviews {
+		fmt.Fprintf(w, "VERDICT\t%s: %s\n", r.ReviewerID, r.Verdict)
+	}
+}
+
+// --- user ---
+
+func runUser(args []string) error {
+	action, args, err := subcommand("user", args, "set-active", "reviews")
+	if err != nil {
+		return err
+	}
+	fs, c := clientFlags("user " + action)
+	id := fs.String("id", "", "user id")
+	var active *bool
+	if action == "set-active" {
+		active = fs.Bool("active", true, "whether the user can be assigned reviews")
+	}
+	if err := parseClientFlags(fs, c, args); err != nil {
+		return err
+	}
+	if err := required(map[string]string{"id": *id}); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	if action == "set-active" {
+		user, reassigned, err := c.api.SetUserActive(ctx, *id, *active)
+		if err != nil {
+			return err
+		}
+		out := map[string]interface{}{"user": user, "reassigned": reassigned}
+		return c.print(out, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "USER_ID\t%s\n", user.UserID)
+			fmt.Fprintf(w, "USERNAME\t%s\n", user.Username)
+			fmt.Fprintf(w, "TEAMS\t%s\n", strings.Join(user.Teams, ", "))
+			fmt.Fprintf(w, "ACTIVE\t%t\n", user.IsActive)
+			for _, pr := range sortedKeys(reassigned) {
+				to := reassigned[pr]
+				if to == "" {
+					to = "(no candidate)"
+				}
+				fmt.Fprintf(w, "REASSIGNED\t%s -> %s\n", pr, to)
+			}
+		})
+	}
+
+	reviews, err := c.api.GetUserReviews(ctx, *id)
+	if err != nil {
+		return err
+	}
+	return c.print(reviews, func(w *tabwriter.Writer) {
+		limit := "unlimited"
+		if reviews.Load.MaxOpenReviews != nil {
+			limit = fmt.Sprint(*reviews.Load.MaxOpenReviews)
+		}
+		fmt.Fprintf(w, "open reviews: %d of %s\n", reviews.Load.OpenReviews, limit)
+		fmt.Fprintln(w, "PR_ID\tTITLE\tAUTHOR\tSTATUS")
+		for _, pr := range reviews.PRs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", pr.PullRequestID, pr.PullRequestName, pr.AuthorID, pr.Status)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/pkg/client"
+)
+
+func TestClientErrorsMapToExitCodes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		if r.URL.Path == "/pullRequest/get" {
+			http.Error(w, "pull_request_id required", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/pullRequest/reassign" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = w.Write([]byte(`{"error":{"code":"PRECONDITION_FAILED","message":"resource was modified, fetch it again and retry"}}`))
+			return
+		}
+		require.Equal(t, "/pullRequest/merge", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error":{"code":"NOT_APPROVED","message":"1 of 2 approvals"}}`))
+	}))
+	defer srv.Close()
+
+	err := runPR([]string{"merge", "-id", "pr-1", "-server", srv.URL, "-token", "secret"})
+	require.Equal(t, client.CodeNotApproved, client.ErrorCode(err))
+	require.Equal(t, 23, exitCode(err))
+
+	err = runPR([]string{"get", "-id", "pr-1", "-server", srv.URL, "-token", "secret"})
+	require.Equal(t, client.CodeBadRequest, client.ErrorCode(err))
+	require.Equal(t, 3, exitCode(err))
+
+	err = runPR([]string{"reassign", "-id", "pr-1", "-reviewer", "u2", "-server", srv.URL, "-token", "secret"})
+	require.Equal(t, client.CodePreconditionFailed, client.ErrorCode(err))
+	require.Equal(t, 27, exitCode(err))
+
+	err = runPR([]string{"merge"})
+	require.ErrorIs(t, err, errUsage)
+	require.Equal(t, 2, exitCode(err))
+}
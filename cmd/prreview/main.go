@@ -1,31 +1,116 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/example/prreview/internal/app"
+	"github.com/example/prreview/internal/bulk"
 	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	"github.com/example/prreview/internal/teamspec"
 )
 
+const usage = `usage: prreview [command] [flags]
+
+commands:
+  serve          run the HTTP server and, if enabled, the gRPC server (default)
+  migrate        apply database migrations and exit
+  config print   print the effective configuration with secrets redacted
+  plan           show how the database differs from a team file
+  apply          bring the database in line with a team file
+  import         add teams and users from a CSV or JSON file
+  export         write all teams and users as CSV or JSON
+  team, pr, user call a running server, see "prreview help"
+
+common flags:
+  -config path   YAML config file (env PRREVIEW_CONFIG)
+
+plan/apply flags:
+  -f path        team file (default teams.yaml)
+  -prune mode    deactivate or remove members missing from the file
+
+import/export flags:
+  -f path        file to read or write (export default: stdout)
+  -format f      csv or json (default: from the file extension, else csv)
+  -dry-run       import: validate and report without saving
+`
+
 func main() {
-	cfg := config.LoadFromEnv()
-	logger := log.New(os.Stdout, "", log.LstdFlags)
+	args := os.Args[1:]
+	cmd := "serve"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = runServe(args)
+	case "migrate":
+		err = runMigrate(args)
+	case "config":
+		err = runConfig(args)
+	case "plan":
+		err = runTeamSync("plan", args, false)
+	case "apply":
+		err = runTeamSync("apply", args, true)
+	case "import":
+		err = runImport(args)
+	case "export":
+		err = runExport(args)
+	case "team":
+		err = runTeam(args)
+	case "pr":
+		err = runPR(args)
+	case "user":
+		err = runUser(args)
+	case "help":
+		fmt.Print(usage + "\n" + clientUsage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "prreview %s: %v\n", cmd, err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func runServe(args []string) error {
+	cfg, err := config.Load("serve", args)
+	if err != nil {
+		return err
+	}
+	logger := app.SetupLogger(cfg.Log)
 
 	a, err := app.NewApp(cfg, logger)
 	if err != nil {
-		logger.Fatalf("init app: %v", err)
+		return fmt.Errorf("init app: %w", err)
 	}
 
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	a.Start(ctx)
+
 	srv := &http.Server{
-		Addr:         ":" + cfg.Port,
+		Addr:         ":" + cfg.HTTP.Port,
 		Handler:      a.Router,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
 	}
 
 	go func() {
@@ -35,9 +120,202 @@ func main() {
 		}
 	}()
 
+	if a.GRPC != nil {
+		lis, err := net.Listen("tcp", ":"+cfg.GRPC.Port)
+		if err != nil {
+			return fmt.Errorf("grpc listen: %w", err)
+		}
+		go func() {
+			logger.Printf("gRPC listening on %s", lis.Addr())
+			if err := a.GRPC.Serve(lis); err != nil {
+				logger.Fatalf("grpc server: %v", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logger.Println("shutting down")
-	_ = srv.Close()
+
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if a.GRPC != nil {
+		a.GRPC.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		_ = srv.Close()
+	}
+	return a.DB.Close()
+}
+
+func runMigrate(args []string) error {
+	cfg, err := config.Load("migrate", args)
+	if err != nil {
+		return err
+	}
+	db, err := app.OpenDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := repo.RunMigrations(db, cfg.DB.MigrationsDir); err != nil {
+		return err
+	}
+	log.Println("migrations applied")
+	return nil
+}
+
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: prreview config print [flags]")
+	}
+	cfg, err := config.Load("config print", args[1:])
+	if err != nil {
+		return err
+	}
+	out, err := cfg.Redacted().YAML()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func runTeamSync(name string, args []string, apply bool) error {
+	var file, prune string
+	cfg, err := config.Load(name, args, func(fs *flag.FlagSet) {
+		fs.StringVar(&file, "f", "teams.yaml", "team file")
+		fs.StringVar(&prune, "prune", "", "deactivate or remove members missing from the file")
+	})
+	if err != nil {
+		return err
+	}
+	mode, err := services.ParsePruneMode(prune)
+	if err != nil {
+		return err
+	}
+	spec, err := teamspec.Load(file)
+	if err != nil {
+		return err
+	}
+
+	db, err := app.OpenDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	sync := services.NewServices(repo.NewSQLRepo(db), cfg.Reviewers, cfg.SLA, cfg.Email).TeamSync
+
+	var plan *services.SyncPlan
+	if apply {
+		plan, err = sync.Apply(spec, mode)
+	} else {
+		plan, err = sync.Plan(spec, mode)
+	}
+	if err != nil {
+		return err
+	}
+	if err := plan.Print(os.Stdout); err != nil {
+		return err
+	}
+	if apply {
+		log.Println("team file applied")
+	}
+	return nil
+}
+
+func runImport(args []string) error {
+	var file, format string
+	var dryRun bool
+	cfg, err := config.Load("import", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&file, "f", "", "CSV or JSON file to import")
+		fs.StringVar(&format, "format", "", "csv or json")
+		fs.BoolVar(&dryRun, "dry-run", false, "validate and report without saving")
+	})
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("-f is required")
+	}
+	f, err := bulk.ParseFormat(format, file)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	rows, err := bulk.Read(in, f)
+	if err != nil {
+		return fmt.Errorf("%s:\n%w", file, err)
+	}
+
+	db, err := app.OpenDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	sum, err := services.NewServices(repo.NewSQLRepo(db), cfg.Reviewers, cfg.SLA, cfg.Email).Bulk.Import(rows, dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "imported"
+	if dryRun {
+		verb = "dry run, nothing saved"
+	}
+	fmt.Printf("%s: %d teams created, %d users created, %d users updated, %d memberships added\n",
+		verb, sum.TeamsCreated, sum.UsersCreated, sum.UsersUpdated, sum.MembershipsAdded)
+	for _, pr := range sortedKeys(sum.Reassigned) {
+		if to := sum.Reassigned[pr]; to != "" {
+			fmt.Printf("  %s: review reassigned to %s\n", pr, to)
+		} else {
+			fmt.Printf("  %s: no candidate, deactivated reviewer kept\n", pr)
+		}
+	}
+	return nil
+}
+
+func runExport(args []string) error {
+	var file, format string
+	cfg, err := config.Load("export", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&file, "f", "", "file to write (default stdout)")
+		fs.StringVar(&format, "format", "", "csv or json")
+	})
+	if err != nil {
+		return err
+	}
+	f, err := bulk.ParseFormat(format, file)
+	if err != nil {
+		return err
+	}
+
+	db, err := app.OpenDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	rows, err := services.NewServices(repo.NewSQLRepo(db), cfg.Reviewers, cfg.SLA, cfg.Email).Bulk.Export()
+	if err != nil {
+		return err
+	}
+
+	if file == "" {
+		return bulk.Write(os.Stdout, f, rows)
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := bulk.Write(out, f, rows); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
 }
@@ -1,55 +1,253 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 
+	"github.com/example/prreview/internal/auth"
 	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/dashboard"
+	"github.com/example/prreview/internal/events"
+	"github.com/example/prreview/internal/grpcapi"
 	"github.com/example/prreview/internal/handlers"
+	"github.com/example/prreview/internal/notify"
+	"github.com/example/prreview/internal/openapi"
+	"github.com/example/prreview/internal/ratelimit"
 	"github.com/example/prreview/internal/repo"
 	"github.com/example/prreview/internal/server"
 	"github.com/example/prreview/internal/services"
 )
 
+const janitorInterval = time.Hour
+
 type App struct {
 	DB     *sqlx.DB
 	Router *server.RouterHolder
 	Logger *log.Logger
 	Repos  *repo.SQLRepo
 	Svcs   *services.Services
+	Events *events.Broker
+	// GRPC is nil unless grpc.enabled is set.
+	GRPC *grpcapi.Server
+	// Notifier is nil unless email.enabled is set.
+	Notifier *notify.Notifier
+
+	cfg config.Config
 }
 
 func NewApp(cfg config.Config, logger *log.Logger) (*App, error) {
-	db, err := sqlx.Connect("postgres", cfg.DatabaseURL)
+	db, err := OpenDB(cfg.DB)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := repo.RunMigrations(db); err != nil {
+	if err := repo.RunMigrations(db, cfg.DB.MigrationsDir); err != nil {
 		panic(fmt.Sprintf("migration failed: %v", err))
 	}
 
 	repos := repo.NewSQLRepo(db)
-	svcs := services.NewServices(repos)
+	svcs := services.NewServices(repos, cfg.Reviewers, cfg.SLA, cfg.Email)
+	broker := events.NewBroker(cfg.Events.BufferSize)
 	router := server.NewRouter()
+	router.Mux().Use(auth.Middleware(cfg.Auth, "/docs/", "/slack/", dashboard.Prefix))
+	router.Mux().Use(handlers.DeprecationMiddleware())
+	router.Mux().Use(handlers.RateLimitMiddleware(newLimiter(cfg.RateLimit, repos), cfg.RateLimit))
+	if cfg.HTTP.ValidateRequests || cfg.HTTP.ValidateResponses {
+		spec, err := openapi.Load(filepath.Join(cfg.HTTP.DocsDir, "openapi.yaml"))
+		if err != nil {
+			return nil, fmt.Errorf("load API spec: %w", err)
+		}
+		router.Mux().Use(handlers.ValidationMiddleware(spec, cfg.HTTP.ValidateResponses))
+	}
+	router.Mux().Use(handlers.IdempotencyMiddleware(repos, cfg.Idempotency.TTL))
 
 	handlers.RegisterTeamRoutes(router.Mux(), repos, svcs)
 	handlers.RegisterUserRoutes(router.Mux(), repos, svcs)
 	handlers.RegisterPRRoutes(router.Mux(), repos, svcs)
+	handlers.RegisterAPIv1Routes(router.Mux(), repos, svcs)
+	handlers.RegisterAbsenceRoutes(router.Mux(), repos, svcs)
+	handlers.RegisterSCIMRoutes(router.Mux(), repos, svcs)
+	handlers.RegisterBulkRoutes(router.Mux(), repos, svcs)
+	handlers.RegisterEventRoutes(router.Mux(), broker, cfg.Events.Heartbeat)
+	if cfg.Slack.Enabled {
+		handlers.RegisterSlackRoutes(router.Mux(), repos, svcs, cfg.Slack.SigningSecret)
+	}
+	if cfg.Dashboard.Enabled {
+		dashboard.Register(router.Mux(), cfg.Auth, repos, svcs)
+	}
 
 	router.Mux().PathPrefix("/docs/").Handler(
-		http.StripPrefix("/docs/", http.FileServer(http.Dir("/app/swagger-ui"))),
+		http.StripPrefix("/docs/", http.FileServer(http.Dir(cfg.HTTP.DocsDir))),
 	)
 
-	return &App{
+	a := &App{
 		DB:     db,
 		Router: router,
 		Logger: logger,
 		Repos:  repos,
 		Svcs:   svcs,
-	}, nil
+		Events: broker,
+		cfg:    cfg,
+	}
+	if cfg.GRPC.Enabled {
+		a.GRPC = grpcapi.NewServer(cfg.Auth, repos, svcs)
+	}
+	if cfg.Email.Enabled {
+		if a.Notifier, err = notify.New(repos, cfg.Email); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+func newLimiter(cfg config.RateLimitConfig, repos *repo.SQLRepo) ratelimit.Limiter {
+	if cfg.Backend == "postgres" {
+		return ratelimit.NewPostgres(repos)
+	}
+	return ratelimit.NewMemory()
+}
+
+// Start runs background jobs until ctx is cancelled.
+func (a *App) Start(ctx context.Context) {
+	go a.listenEvents(ctx)
+	go a.every(ctx, janitorInterval, a.purge)
+	go a.every(ctx, a.cfg.Absences.HandoffInterval, a.offerHandoffs)
+	if a.cfg.SLA.Enabled {
+		go a.every(ctx, a.cfg.SLA.CheckInterval, a.checkSLA)
+	}
+	if a.Notifier != nil {
+		go a.every(ctx, a.cfg.Email.SendInterval, a.sendEmails)
+	}
+}
+
+func (a *App) every(ctx context.Context, interval time.Duration, job func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			job()
+		}
+	}
+}
+
+// listenEvents feeds the GET /events streams. When it ends the broker is
+// closed, which also ends the open streams so that shutdown does not wait
+// for them.
+func (a *App) listenEvents(ctx context.Context) {
+	if err := events.Listen(ctx, a.cfg.DB.DSN(), a.Events, a.Logger); err != nil {
+		a.Logger.Printf("events listener: %v", err)
+	}
+}
+
+func (a *App) offerHandoffs() {
+	offers, err := a.Svcs.Absences.OfferHandoffs(a.cfg.Absences.HandoffLookahead)
+	if err != nil {
+		a.Logger.Printf("offer handoffs: %v", err)
+		return
+	}
+	for _, o := range offers {
+		a.Logger.Printf("absence %d: offered handoff of review on %s", o.AbsenceID, o.PullRequestID)
+	}
+}
+
+// checkSLA acts on overdue review assignments. The service emails reminders
+// and escalations and publishes them to GET /events; they are also logged.
+func (a *App) checkSLA() {
+	events, err := a.Svcs.SLA.Check()
+	if err != nil {
+		a.Logger.Printf("check review SLAs: %v", err)
+	}
+	for _, e := range events {
+		switch e.Action {
+		case services.SLARemind:
+			a.Logger.Printf("sla: reminded %s of overdue review on %s", e.ReviewerID, e.PRID)
+		case services.SLAReassign:
+			a.Logger.Printf("sla: reassigned overdue review on %s from %s to %s", e.PRID, e.ReviewerID, e.NewReviewerID)
+		case services.SLAEscalate:
+			if e.LeadUserID == "" {
+				a.Logger.Printf("sla: review on %s by %s is overdue and team has no lead to escalate to", e.PRID, e.ReviewerID)
+				continue
+			}
+			a.Logger.Printf("sla: escalated overdue review on %s by %s to %s", e.PRID, e.ReviewerID, e.LeadUserID)
+		}
+	}
+}
+
+func (a *App) sendEmails() {
+	if n, err := a.Notifier.SendQueued(); err != nil {
+		a.Logger.Printf("send assignment emails (%d sent): %v", n, err)
+	} else if n > 0 {
+		a.Logger.Printf("sent %d assignment emails", n)
+	}
+	if n, err := a.Notifier.SendDigests(); err != nil {
+		a.Logger.Printf("send review digests (%d sent): %v", n, err)
+	} else if n > 0 {
+		a.Logger.Printf("sent %d review digests", n)
+	}
+}
+
+func (a *App) purge() {
+	if n, err := a.Repos.PurgeExpiredIdempotencyKeys(); err != nil {
+		a.Logger.Printf("purge idempotency keys: %v", err)
+	} else if n > 0 {
+		a.Logger.Printf("purged %d expired idempotency keys", n)
+	}
+
+	rl := a.cfg.RateLimit
+	if !rl.Enabled || rl.Backend != "postgres" {
+		return
+	}
+	// A bucket idle for longer than the slowest refill is full, so dropping it
+	// is equivalent to keeping it.
+	idle := ratelimit.FromConfig(rl.Default).RefillTime()
+	for _, g := range rl.Groups {
+		if d := ratelimit.FromConfig(g.RateLimitRule).RefillTime(); d > idle {
+			idle = d
+		}
+	}
+	if _, err := a.Repos.PurgeIdleRateLimitBuckets(idle.Seconds()); err != nil {
+		a.Logger.Printf("purge rate limit buckets: %v", err)
+	}
+}
+
+func OpenDB(cfg config.DBConfig) (*sqlx.DB, error) {
+	db, err := sqlx.Connect("postgres", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return db, nil
+}
+
+// SetupLogger installs a slog handler built from cfg as the process-wide
+// default and returns a *log.Logger that writes through it.
+func SetupLogger(cfg config.LogConfig) *log.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(strings.ToUpper(cfg.Level)))
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	if cfg.Format == "json" {
+		h = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		h = slog.NewTextHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(h))
+	return slog.NewLogLogger(h, slog.LevelInfo)
 }
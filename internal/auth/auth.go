@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/example/prreview/internal/config"
+)
+
+type Client struct {
+	Name  string
+	Admin bool
+}
+
+type ctxKey struct{}
+
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	c, ok := ctx.Value(ctxKey{}).(Client)
+	return c, ok
+}
+
+// Middleware authenticates requests with "Authorization: Bearer <token>" or
+// "X-API-Key: <token>". When auth is disabled every request passes through
+// unauthenticated. Paths under skipPrefixes (e.g. the Swagger UI) are public.
+func Middleware(cfg config.AuthConfig, skipPrefixes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range skipPrefixes {
+				if strings.HasPrefix(r.URL.Path, p) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			c, ok := Authenticate(cfg, tokenFromRequest(r))
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="prreview"`)
+				writeUnauthorized(w)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithClient(r.Context(), c)))
+		})
+	}
+}
+
+func Authenticate(cfg config.AuthConfig, token string) (Client, bool) {
+	if token == "" {
+		return Client{}, false
+	}
+	for _, t := range cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return Client{Name: t.Name, Admin: t.Admin}, true
+		}
+	}
+	return Client{}, false
+}
+
+func tokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	var e struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	e.Error.Code = "UNAUTHORIZED"
+	e.Error.Message = "missing or invalid API token"
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,262 @@
+// Package bulk reads and writes the flat team and user directory used by
+// `prreview import` / `prreview export` and /bulk/import, /bulk/export.
+//
+// Every row is a team membership: a team and one of its members. A row
+// without user_id lists a team that has no members, a row without team_name a
+// user that is in no team. The same user may appear in many rows; all of them
+// must agree on the user's fields.
+package bulk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+)
+
+// ParseFormat accepts "csv" and "json"; an empty value is taken from the
+// file extension of path and defaults to CSV.
+func ParseFormat(s, path string) (Format, error) {
+	if s == "" {
+		s = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if s != string(JSON) {
+			s = string(CSV)
+		}
+	}
+	switch f := Format(strings.ToLower(s)); f {
+	case CSV, JSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("format %q is not one of csv, json", s)
+}
+
+type Row struct {
+	TeamName    string `json:"team_name,omitempty"`
+	UserID      string `json:"user_id,omitempty"`
+	Username    string `json:"username,omitempty"`
+	IsActive    *bool  `json:"is_active,omitempty"`
+	Email       string `json:"email,omitempty"`
+	SlackUserID string `json:"slack_user_id,omitempty"`
+
+	// Line is the CSV line or the 1-based JSON array index, for errors.
+	Line int `json:"-"`
+}
+
+// Active defaults to true.
+func (r Row) Active() bool {
+	return r.IsActive == nil || *r.IsActive
+}
+
+type RowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// Errors is every problem found in a file.
+type Errors []RowError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, re := range e {
+		msgs[i] = re.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var columns = []string{"team_name", "user_id", "username", "is_active", "email", "slack_user_id"}
+
+// Read decodes and validates a file. Problems with single rows are returned
+// together as Errors.
+func Read(r io.Reader, f Format) ([]Row, error) {
+	var rows []Row
+	var err error
+	if f == JSON {
+		rows, err = readJSON(r)
+	} else {
+		rows, err = readCSV(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if errs := Validate(rows); len(errs) > 0 {
+		return nil, errs
+	}
+	return rows, nil
+}
+
+func readJSON(r io.Reader) ([]Row, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var rows []Row
+	if err := dec.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode JSON: %w", err)
+	}
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+	return rows, nil
+}
+
+// readCSV needs a header line; of the columns only team_name, user_id and
+// username are required, in any order.
+func readCSV(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if !contains(columns, name) {
+			return nil, fmt.Errorf("unknown column %q, expected %s", name, strings.Join(columns, ","))
+		}
+		index[name] = i
+	}
+	for _, name := range columns[:3] {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var rows []Row
+	var errs Errors
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := index[name]; ok {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		row := Row{
+			TeamName:    get("team_name"),
+			UserID:      get("user_id"),
+			Username:    get("username"),
+			Email:       get("email"),
+			SlackUserID: get("slack_user_id"),
+			Line:        line,
+		}
+		if v := get("is_active"); v != "" {
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, RowError{line, fmt.Sprintf("is_active %q is not a boolean", v)})
+				continue
+			}
+			row.IsActive = &active
+		}
+		rows = append(rows, row)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return rows, nil
+}
+
+// Validate reports every problem in rows.
+func Validate(rows []Row) Errors {
+	var errs Errors
+	add := func(r Row, format string, args ...interface{}) {
+		errs = append(errs, RowError{r.Line, fmt.Sprintf(format, args...)})
+	}
+
+	users := map[string]Row{}
+	members := map[[2]string]int{}
+	for _, r := range rows {
+		switch {
+		case r.TeamName == "" && r.UserID == "":
+			add(r, "team_name or user_id is required")
+			continue
+		case r.UserID == "":
+			if r.Username != "" || r.IsActive != nil || r.Email != "" || r.SlackUserID != "" {
+				add(r, "user fields need a user_id")
+			}
+			continue
+		case r.Username == "":
+			add(r, "username is required")
+			continue
+		}
+
+		if first, ok := users[r.UserID]; !ok {
+			users[r.UserID] = r
+		} else if first.Username != r.Username || first.Active() != r.Active() ||
+			first.Email != r.Email || first.SlackUserID != r.SlackUserID {
+			add(r, "user %s differs from row %d", r.UserID, first.Line)
+		}
+		if r.TeamName == "" {
+			continue
+		}
+		key := [2]string{r.TeamName, r.UserID}
+		if line, ok := members[key]; ok {
+			add(r, "duplicate of row %d", line)
+			continue
+		}
+		members[key] = r.Line
+	}
+	return errs
+}
+
+// Write encodes rows in the form Read accepts.
+func Write(w io.Writer, f Format, rows []Row) error {
+	if f == JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if rows == nil {
+			rows = []Row{}
+		}
+		return enc.Encode(rows)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		active := ""
+		if r.IsActive != nil {
+			active = strconv.FormatBool(*r.IsActive)
+		}
+		if err := cw.Write([]string{r.TeamName, r.UserID, r.Username, active, r.Email, r.SlackUserID}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
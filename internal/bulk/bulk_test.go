@@ -0,0 +1,75 @@
+package bulk
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWriteRoundTrip(t *testing.T) {
+	in := `team_name,user_id,username,is_active,email,slack_user_id
+,u9,Zed,false,,
+backend,u1,Alice,true,alice@example.com,U01
+backend,u2,"Bob, Jr.",true,,
+empty,,,,,
+platform,u1,Alice,true,alice@example.com,U01
+`
+	for _, f := range []Format{CSV, JSON} {
+		rows, err := Read(strings.NewReader(in), CSV)
+		require.NoError(t, err)
+		require.Len(t, rows, 5)
+		require.Equal(t, 3, rows[1].Line)
+		require.False(t, rows[0].Active())
+
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, f, rows))
+		again, err := Read(bytes.NewReader(buf.Bytes()), f)
+		require.NoError(t, err, buf.String())
+
+		var out bytes.Buffer
+		require.NoError(t, Write(&out, CSV, again))
+		require.Equal(t, in, out.String(), f)
+	}
+}
+
+func TestReadReportsEveryRow(t *testing.T) {
+	_, err := Read(strings.NewReader(`user_id,team_name,username
+u1,backend,Alice
+u1,backend,Alice
+u1,platform,Alicia
+,,
+u2,backend,
+,platform,Bob
+`), CSV)
+	var errs Errors
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, Errors{
+		{3, "duplicate of row 2"},
+		{4, "user u1 differs from row 2"},
+		{5, "team_name or user_id is required"},
+		{6, "username is required"},
+		{7, "user fields need a user_id"},
+	}, errs)
+
+	_, err = Read(strings.NewReader("team_name,user_id,username,is_active\nbackend,u1,Alice,maybe\n"), CSV)
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, Errors{{2, `is_active "maybe" is not a boolean`}}, errs)
+
+	_, err = Read(strings.NewReader("team,user_id,username\n"), CSV)
+	require.ErrorContains(t, err, `unknown column "team"`)
+	_, err = Read(strings.NewReader(`[{"team_name": "a", "owner": "u1"}]`), JSON)
+	require.ErrorContains(t, err, "owner")
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("", "teams.JSON")
+	require.NoError(t, err)
+	require.Equal(t, JSON, f)
+	f, err = ParseFormat("", "")
+	require.NoError(t, err)
+	require.Equal(t, CSV, f)
+	_, err = ParseFormat("xml", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,140 @@
+// Package codeowners parses ownership rules written in CODEOWNERS syntax and
+// resolves the owners of file paths.
+//
+// Each non-empty line that is not a comment holds a gitignore-style path
+// pattern followed by zero or more owner user ids (an optional leading "@" is
+// dropped). When several rules match a path, the last one wins, so a rule with
+// no owners can clear ownership set by an earlier, broader rule.
+package codeowners
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Rule struct {
+	Pattern string
+	Owners  []string
+	Line    int
+
+	re *regexp.Regexp
+}
+
+type Ruleset struct {
+	Rules []Rule
+}
+
+func Parse(text string) (*Ruleset, error) {
+	rs := &Ruleset{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		re, err := compile(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rule := Rule{Pattern: fields[0], Line: i + 1, re: re}
+		for _, o := range fields[1:] {
+			if strings.HasPrefix(o, "#") {
+				break
+			}
+			o = strings.TrimPrefix(o, "@")
+			if o == "" {
+				return nil, fmt.Errorf("line %d: empty owner", i+1)
+			}
+			rule.Owners = append(rule.Owners, o)
+		}
+		rs.Rules = append(rs.Rules, rule)
+	}
+	return rs, nil
+}
+
+// Owners returns the owners of path according to the last matching rule.
+func (rs *Ruleset) Owners(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	for i := len(rs.Rules) - 1; i >= 0; i-- {
+		if rs.Rules[i].re.MatchString(path) {
+			return rs.Rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// AllOwners returns every owner mentioned in the ruleset, without duplicates.
+func (rs *Ruleset) AllOwners() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, r := range rs.Rules {
+		for _, o := range r.Owners {
+			if !seen[o] {
+				seen[o] = true
+				out = append(out, o)
+			}
+		}
+	}
+	return out
+}
+
+// compile turns a gitignore-style pattern into a regular expression:
+// a leading "/" or a "/" in the middle anchors the pattern at the repository
+// root, a trailing "/" matches only directories, "*" and "?" stay within one
+// path segment and "**" spans any number of segments. A pattern matches the
+// files under a matching directory too, unless its last segment has a "*" or
+// "?": "docs/*" owns docs/a.md but not docs/api/b.md, as on GitHub.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "!") {
+		return nil, fmt.Errorf("negated pattern %q is not supported", pattern)
+	}
+	if strings.HasPrefix(pattern, "[") {
+		return nil, fmt.Errorf("sections are not supported: %q", pattern)
+	}
+
+	dirOnly := strings.HasSuffix(pattern, "/")
+	p := strings.TrimSuffix(pattern, "/")
+	anchored := strings.HasPrefix(p, "/") || strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern %q", pattern)
+	}
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "/**") && i+3 == len(p):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	last := p[strings.LastIndex(p, "/")+1:]
+	switch {
+	case dirOnly:
+		b.WriteString("/.*$")
+	case strings.ContainsAny(last, "*?") && !strings.Contains(last, "**"):
+		b.WriteString("$")
+	default:
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
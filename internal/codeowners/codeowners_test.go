@@ -0,0 +1,52 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwners(t *testing.T) {
+	rs, err := Parse(`
+# default owners
+*                 @lead
+*.go              u-go
+/docs/            u-docs
+payments/         u-pay1 @u-pay2
+/api/*.proto      u-api
+**/migrations     u-db
+vendor/
+/scripts/*        u-ops
+`)
+	require.NoError(t, err)
+
+	cases := map[string][]string{
+		"README.md":                       {"lead"},
+		"cmd/main.go":                     {"u-go"},
+		"docs/index.md":                   {"u-docs"},
+		"internal/docs/a.md":              {"lead"},
+		"internal/payments/charge.go":     {"u-pay1", "u-pay2"},
+		"payments":                        {"lead"},
+		"api/user.proto":                  {"u-api"},
+		"api/v1/user.proto":               {"lead"},
+		"migrations/0001_init.sql":        {"u-db"},
+		"svc/billing/migrations/0002.sql": {"u-db"},
+		"vendor/github.com/x/y.go":        nil,
+		"/internal/payments/refund/x.go":  {"u-pay1", "u-pay2"},
+		"scripts/deploy.sh":               {"u-ops"},
+		"scripts/ci/lint.sh":              {"lead"},
+		"scripts/ci/build.go":             {"u-go"},
+	}
+	for path, want := range cases {
+		require.Equal(t, want, rs.Owners(path), path)
+	}
+	require.Equal(t, []string{"lead", "u-go", "u-docs", "u-pay1", "u-pay2", "u-api", "u-db", "u-ops"}, rs.AllOwners())
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse("!secret.txt u1")
+	require.ErrorContains(t, err, "line 1")
+
+	_, err = Parse("ok u1\n[Section]\n")
+	require.ErrorContains(t, err, "line 2")
+}
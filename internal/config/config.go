@@ -1,32 +1,719 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// Config is the effective service configuration. Values are resolved in the
+// following order, each step overriding the previous one: built-in defaults,
+// the YAML config file, environment variables, command-line flags.
 type Config struct {
-	DatabaseURL string
-	Port        string
+	HTTP        HTTPConfig        `yaml:"http"`
+	GRPC        GRPCConfig        `yaml:"grpc"`
+	DB          DBConfig          `yaml:"db"`
+	Reviewers   ReviewersConfig   `yaml:"reviewers"`
+	Log         LogConfig         `yaml:"log"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Absences    AbsencesConfig    `yaml:"absences"`
+	SLA         SLAConfig         `yaml:"sla"`
+	Events      EventsConfig      `yaml:"events"`
+	Slack       SlackConfig       `yaml:"slack"`
+	Email       EmailConfig       `yaml:"email"`
+	Dashboard   DashboardConfig   `yaml:"dashboard"`
+}
+
+type HTTPConfig struct {
+	Port            string        `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	DocsDir         string        `yaml:"docs_dir"`
+	// ValidateRequests rejects requests that do not match
+	// <docs_dir>/openapi.yaml with 400.
+	ValidateRequests bool `yaml:"validate_requests"`
+	// ValidateResponses also checks every response against the spec and
+	// replaces mismatches with 500. Meant for tests and staging.
+	ValidateResponses bool `yaml:"validate_responses"`
+}
+
+// GRPCConfig runs the gRPC API on its own port next to the HTTP server.
+type GRPCConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Port    string `yaml:"port"`
+}
+
+type DBConfig struct {
+	URL             string        `yaml:"url"`
+	Host            string        `yaml:"host"`
+	Port            string        `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	SSLMode         string        `yaml:"sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	MigrationsDir   string        `yaml:"migrations_dir"`
+}
+
+type ReviewersConfig struct {
+	PerPR int `yaml:"per_pr"`
+	// MaxOpenReviews caps OPEN reviews per reviewer unless the user or one of
+	// their teams sets its own limit. 0 means unlimited.
+	MaxOpenReviews int `yaml:"max_open_reviews"`
+	// RequiredApprovals is how many assigned reviewers must approve before a
+	// PR can be merged, for teams that do not set their own quorum.
+	RequiredApprovals int `yaml:"required_approvals"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type AuthConfig struct {
+	Enabled bool       `yaml:"enabled"`
+	Tokens  []APIToken `yaml:"tokens"`
+}
+
+type IdempotencyConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// RateLimitConfig configures token-bucket limits keyed by API client, or by
+// client IP for unauthenticated requests. A request uses the first group
+// whose path prefix matches, falling back to Default.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Backend is "memory" (per replica) or "postgres" (shared by replicas).
+	Backend string `yaml:"backend"`
+	// TrustProxy takes the client IP from X-Forwarded-For.
+	TrustProxy bool             `yaml:"trust_proxy"`
+	Default    RateLimitRule    `yaml:"default"`
+	Groups     []RateLimitGroup `yaml:"groups"`
+}
+
+type RateLimitRule struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+type RateLimitGroup struct {
+	Name          string   `yaml:"name"`
+	Prefixes      []string `yaml:"prefixes"`
+	RateLimitRule `yaml:",inline"`
+}
+
+// AbsencesConfig controls the job that offers to hand off the open reviews of
+// users who are about to be away.
+type AbsencesConfig struct {
+	HandoffInterval  time.Duration `yaml:"handoff_interval"`
+	HandoffLookahead time.Duration `yaml:"handoff_lookahead"`
+}
+
+// SLAConfig sets the default review SLAs and how an assignment that breaches
+// one is handled: the reviewer is reminded after RemindAfter, the review is
+// reassigned after ReassignAfter and escalated to the team lead after
+// EscalateAfter, all counted from the breach. A zero ReassignAfter or
+// EscalateAfter disables that step.
+type SLAConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	CheckInterval time.Duration `yaml:"check_interval"`
+	FirstResponse time.Duration `yaml:"first_response"`
+	Verdict       time.Duration `yaml:"verdict"`
+	RemindAfter   time.Duration `yaml:"remind_after"`
+	ReassignAfter time.Duration `yaml:"reassign_after"`
+	EscalateAfter time.Duration `yaml:"escalate_after"`
+}
+
+// EventsConfig controls the GET /events stream. Every replica keeps the last
+// BufferSize events so that a client reconnecting with Last-Event-ID gets what
+// it missed; Heartbeat is how often an idle stream sends a comment to keep
+// proxies from closing it.
+type EventsConfig struct {
+	BufferSize int           `yaml:"buffer_size"`
+	Heartbeat  time.Duration `yaml:"heartbeat"`
+}
+
+// SlackConfig enables the slash-command endpoint. SigningSecret is the app's
+// signing secret that Slack signs command requests with.
+type SlackConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	SigningSecret string `yaml:"signing_secret"`
+}
+
+// EmailConfig sends an email to a reviewer on every assignment and, if Digest
+// is set, a daily digest of their open reviews after DigestHour in Timezone.
+// Templates are read from TemplatesDir, falling back to the built-in ones for
+// files it does not contain.
+type EmailConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	SMTPHost     string        `yaml:"smtp_host"`
+	SMTPPort     string        `yaml:"smtp_port"`
+	Username     string        `yaml:"username"`
+	Password     string        `yaml:"password"`
+	From         string        `yaml:"from"`
+	TemplatesDir string        `yaml:"templates_dir"`
+	SendInterval time.Duration `yaml:"send_interval"`
+	Digest       bool          `yaml:"digest"`
+	DigestHour   int           `yaml:"digest_hour"`
+	Timezone     string        `yaml:"timezone"`
+}
+
+// DashboardConfig serves the HTML dashboard under /ui/.
+type DashboardConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type APIToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Admin bool   `yaml:"admin"`
+}
+
+const redacted = "REDACTED"
+
+func Default() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			Port:             "8080",
+			ReadTimeout:      5 * time.Second,
+			WriteTimeout:     10 * time.Second,
+			IdleTimeout:      60 * time.Second,
+			ShutdownTimeout:  10 * time.Second,
+			DocsDir:          "/app/swagger-ui",
+			ValidateRequests: true,
+		},
+		GRPC: GRPCConfig{Port: "9090"},
+		DB: DBConfig{
+			Host:            "db",
+			Port:            "5432",
+			User:            "pruser",
+			Name:            "pr_review",
+			SSLMode:         "disable",
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			MigrationsDir:   "migrations",
+		},
+		Reviewers:   ReviewersConfig{PerPR: 2, RequiredApprovals: 1},
+		Log:         LogConfig{Level: "info", Format: "text"},
+		Idempotency: IdempotencyConfig{TTL: 24 * time.Hour},
+		RateLimit: RateLimitConfig{
+			Backend: "memory",
+			Default: RateLimitRule{Requests: 100, Per: time.Minute, Burst: 50},
+			Groups: []RateLimitGroup{{
+				Name:          "pr-write",
+				Prefixes:      []string{"/pullRequest/create", "/pullRequest/reassign", "/pullRequest/merge", "/api/v1/pull-requests"},
+				RateLimitRule: RateLimitRule{Requests: 30, Per: time.Minute, Burst: 10},
+			}},
+		},
+		Absences: AbsencesConfig{HandoffInterval: 5 * time.Minute, HandoffLookahead: 24 * time.Hour},
+		SLA: SLAConfig{
+			CheckInterval: 5 * time.Minute,
+			FirstResponse: 24 * time.Hour,
+			Verdict:       72 * time.Hour,
+			ReassignAfter: 24 * time.Hour,
+			EscalateAfter: 48 * time.Hour,
+		},
+		Events: EventsConfig{BufferSize: 1000, Heartbeat: 15 * time.Second},
+		Email: EmailConfig{
+			SMTPPort:     "587",
+			SendInterval: 30 * time.Second,
+			Digest:       true,
+			DigestHour:   9,
+			Timezone:     "UTC",
+		},
+		Dashboard: DashboardConfig{Enabled: true},
+	}
+}
+
+// Load resolves the configuration for a command invoked with args.
+// The config file path is taken from -config or PRREVIEW_CONFIG. Commands
+// with flags of their own register them through extra.
+func Load(name string, args []string, extra ...func(*flag.FlagSet)) (Config, error) {
+	return load(name, args, os.LookupEnv, extra...)
+}
+
+type lookupFunc func(string) (string, bool)
+
+func load(name string, args []string, lookup lookupFunc, extra ...func(*flag.FlagSet)) (Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	for _, register := range extra {
+		register(fs)
+	}
+	var (
+		path        = fs.String("config", "", "path to YAML config file (env PRREVIEW_CONFIG)")
+		port        = fs.String("port", "", "HTTP listen port (env PORT)")
+		databaseURL = fs.String("database-url", "", "PostgreSQL connection URL (env DATABASE_URL)")
+		logLevel    = fs.String("log-level", "", "log level: debug, info, warn, error (env LOG_LEVEL)")
+		logFormat   = fs.String("log-format", "", "log format: text, json (env LOG_FORMAT)")
+	)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg := Default()
+
+	if *path == "" {
+		*path, _ = lookup("PRREVIEW_CONFIG")
+	}
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.applyEnv(lookup); err != nil {
+		return Config{}, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.HTTP.Port = *port
+		case "database-url":
+			cfg.DB.URL = *databaseURL
+		case "log-level":
+			cfg.Log.Level = *logLevel
+		case "log-format":
+			cfg.Log.Format = *logFormat
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadFile reads a YAML config file. Other formats are refused up front
+// rather than failing later with a YAML syntax error.
+func (c *Config) loadFile(path string) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q, only YAML (.yaml, .yml) is supported", path, ext)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) applyEnv(lookup lookupFunc) error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	secret := func(key string, dst *string) {
+		str(key, dst)
+		if p, ok := lookup(key + "_FILE"); ok && p != "" {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s_FILE: %w", key, err))
+				return
+			}
+			*dst = strings.TrimSpace(string(data))
+		}
+	}
+	num := func(key string, dst *int) {
+		if v, ok := lookup(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not an integer", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	dur := func(key string, dst *time.Duration) {
+		if v, ok := lookup(key); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration", key, v))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v, ok := lookup(key); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", key, v))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	str("PORT", &c.HTTP.Port)
+	dur("HTTP_READ_TIMEOUT", &c.HTTP.ReadTimeout)
+	dur("HTTP_WRITE_TIMEOUT", &c.HTTP.WriteTimeout)
+	dur("HTTP_IDLE_TIMEOUT", &c.HTTP.IdleTimeout)
+	dur("HTTP_SHUTDOWN_TIMEOUT", &c.HTTP.ShutdownTimeout)
+	str("DOCS_DIR", &c.HTTP.DocsDir)
+	boolean("HTTP_VALIDATE_REQUESTS", &c.HTTP.ValidateRequests)
+	boolean("HTTP_VALIDATE_RESPONSES", &c.HTTP.ValidateResponses)
+
+	boolean("GRPC_ENABLED", &c.GRPC.Enabled)
+	str("GRPC_PORT", &c.GRPC.Port)
+
+	secret("DATABASE_URL", &c.DB.URL)
+	str("DB_HOST", &c.DB.Host)
+	str("DB_PORT", &c.DB.Port)
+	str("POSTGRES_USER", &c.DB.User)
+	secret("POSTGRES_PASSWORD", &c.DB.Password)
+	str("POSTGRES_DB", &c.DB.Name)
+	str("DB_SSLMODE", &c.DB.SSLMode)
+	num("DB_MAX_OPEN_CONNS", &c.DB.MaxOpenConns)
+	num("DB_MAX_IDLE_CONNS", &c.DB.MaxIdleConns)
+	dur("DB_CONN_MAX_LIFETIME", &c.DB.ConnMaxLifetime)
+	dur("DB_CONN_MAX_IDLE_TIME", &c.DB.ConnMaxIdleTime)
+	str("MIGRATIONS_DIR", &c.DB.MigrationsDir)
+
+	num("REVIEWERS_PER_PR", &c.Reviewers.PerPR)
+	num("REVIEWERS_MAX_OPEN_REVIEWS", &c.Reviewers.MaxOpenReviews)
+	num("REVIEWERS_REQUIRED_APPROVALS", &c.Reviewers.RequiredApprovals)
+
+	str("LOG_LEVEL", &c.Log.Level)
+	str("LOG_FORMAT", &c.Log.Format)
+
+	dur("IDEMPOTENCY_TTL", &c.Idempotency.TTL)
+
+	dur("ABSENCES_HANDOFF_INTERVAL", &c.Absences.HandoffInterval)
+	dur("ABSENCES_HANDOFF_LOOKAHEAD", &c.Absences.HandoffLookahead)
+
+	boolean("SLA_ENABLED", &c.SLA.Enabled)
+	dur("SLA_CHECK_INTERVAL", &c.SLA.CheckInterval)
+	dur("SLA_FIRST_RESPONSE", &c.SLA.FirstResponse)
+	dur("SLA_VERDICT", &c.SLA.Verdict)
+	dur("SLA_REMIND_AFTER", &c.SLA.RemindAfter)
+	dur("SLA_REASSIGN_AFTER", &c.SLA.ReassignAfter)
+	dur("SLA_ESCALATE_AFTER", &c.SLA.EscalateAfter)
+
+	num("EVENTS_BUFFER_SIZE", &c.Events.BufferSize)
+	dur("EVENTS_HEARTBEAT", &c.Events.Heartbeat)
+
+	boolean("SLACK_ENABLED", &c.Slack.Enabled)
+	secret("SLACK_SIGNING_SECRET", &c.Slack.SigningSecret)
+
+	boolean("EMAIL_ENABLED", &c.Email.Enabled)
+	str("SMTP_HOST", &c.Email.SMTPHost)
+	str("SMTP_PORT", &c.Email.SMTPPort)
+	str("SMTP_USERNAME", &c.Email.Username)
+	secret("SMTP_PASSWORD", &c.Email.Password)
+	str("EMAIL_FROM", &c.Email.From)
+	str("EMAIL_TEMPLATES_DIR", &c.Email.TemplatesDir)
+	dur("EMAIL_SEND_INTERVAL", &c.Email.SendInterval)
+	boolean("EMAIL_DIGEST", &c.Email.Digest)
+	num("EMAIL_DIGEST_HOUR", &c.Email.DigestHour)
+	str("EMAIL_TIMEZONE", &c.Email.Timezone)
+
+	boolean("DASHBOARD_ENABLED", &c.Dashboard.Enabled)
+
+	boolean("RATE_LIMIT_ENABLED", &c.RateLimit.Enabled)
+	str("RATE_LIMIT_BACKEND", &c.RateLimit.Backend)
+	boolean("RATE_LIMIT_TRUST_PROXY", &c.RateLimit.TrustProxy)
+
+	var tokens string
+	secret("AUTH_TOKENS", &tokens)
+	if tokens != "" {
+		parsed, err := parseTokens(tokens)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("AUTH_TOKENS: %w", err))
+		} else {
+			c.Auth.Enabled = true
+			c.Auth.Tokens = parsed
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
-func LoadFromEnv() Config {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		user := getenv("POSTGRES_USER", "pruser")
-		pass := getenv("POSTGRES_PASSWORD", "prpass")
-		host := getenv("DB_HOST", "db")
-		port := getenv("DB_PORT", "5432")
-		db := getenv("POSTGRES_DB", "pr_review")
-		dsn = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", user, pass, host, port, db)
+// parseTokens reads "name:token[:admin]" entries separated by commas or newlines.
+func parseTokens(s string) ([]APIToken, error) {
+	var out []APIToken
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "admin") {
+			return nil, fmt.Errorf("entry %q must look like name:token or name:token:admin", parts[0])
+		}
+		out = append(out, APIToken{Name: parts[0], Token: parts[1], Admin: len(parts) == 3})
 	}
-	return Config{DatabaseURL: dsn, Port: getenv("PORT", "8080")}
+	return out, nil
 }
 
-func getenv(k, d string) string {
-	v := os.Getenv(k)
-	if v == "" {
-		return d
+// Validate reports every problem found in the configuration at once so that
+// the service fails on startup with a complete list instead of one at a time.
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if p, err := strconv.Atoi(c.HTTP.Port); err != nil || p < 1 || p > 65535 {
+		add("http.port: %q is not a valid port", c.HTTP.Port)
+	}
+	positive := func(name string, d time.Duration) {
+		if d <= 0 {
+			add("%s: must be positive, got %s", name, d)
+		}
+	}
+	positive("http.read_timeout", c.HTTP.ReadTimeout)
+	positive("http.write_timeout", c.HTTP.WriteTimeout)
+	positive("http.idle_timeout", c.HTTP.IdleTimeout)
+	positive("http.shutdown_timeout", c.HTTP.ShutdownTimeout)
+
+	if c.GRPC.Enabled {
+		if p, err := strconv.Atoi(c.GRPC.Port); err != nil || p < 1 || p > 65535 {
+			add("grpc.port: %q is not a valid port", c.GRPC.Port)
+		} else if c.GRPC.Port == c.HTTP.Port {
+			add("grpc.port: must differ from http.port")
+		}
+	}
+
+	if c.DB.URL != "" {
+		u, err := url.Parse(c.DB.URL)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			add("db.url: must be a postgres:// URL")
+		}
+	} else {
+		if c.DB.Host == "" {
+			add("db.host: required when db.url is not set")
+		}
+		if c.DB.User == "" {
+			add("db.user: required when db.url is not set")
+		}
+		if c.DB.Password == "" {
+			add("db.password: required when db.url is not set (use POSTGRES_PASSWORD or POSTGRES_PASSWORD_FILE)")
+		}
+		if c.DB.Name == "" {
+			add("db.name: required when db.url is not set")
+		}
+	}
+	if c.DB.MaxOpenConns < 1 {
+		add("db.max_open_conns: must be at least 1, got %d", c.DB.MaxOpenConns)
+	}
+	if c.DB.MaxIdleConns < 0 || c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		add("db.max_idle_conns: must be between 0 and db.max_open_conns, got %d", c.DB.MaxIdleConns)
+	}
+	if c.DB.ConnMaxLifetime < 0 {
+		add("db.conn_max_lifetime: must not be negative")
+	}
+	if c.DB.ConnMaxIdleTime < 0 {
+		add("db.conn_max_idle_time: must not be negative")
+	}
+
+	if c.Reviewers.PerPR < 1 {
+		add("reviewers.per_pr: must be at least 1, got %d", c.Reviewers.PerPR)
+	}
+	if c.Reviewers.MaxOpenReviews < 0 {
+		add("reviewers.max_open_reviews: must not be negative, got %d", c.Reviewers.MaxOpenReviews)
+	}
+	if c.Reviewers.RequiredApprovals < 0 {
+		add("reviewers.required_approvals: must not be negative, got %d", c.Reviewers.RequiredApprovals)
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		add("log.level: %q is not one of debug, info, warn, error", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		add("log.format: %q is not one of text, json", c.Log.Format)
+	}
+
+	positive("idempotency.ttl", c.Idempotency.TTL)
+
+	positive("absences.handoff_interval", c.Absences.HandoffInterval)
+	if c.Absences.HandoffLookahead < 0 {
+		add("absences.handoff_lookahead: must not be negative")
+	}
+
+	positive("sla.check_interval", c.SLA.CheckInterval)
+	nonNegative := func(name string, d time.Duration) {
+		if d < 0 {
+			add("%s: must not be negative", name)
+		}
+	}
+	nonNegative("sla.first_response", c.SLA.FirstResponse)
+	nonNegative("sla.verdict", c.SLA.Verdict)
+	nonNegative("sla.remind_after", c.SLA.RemindAfter)
+	nonNegative("sla.reassign_after", c.SLA.ReassignAfter)
+	nonNegative("sla.escalate_after", c.SLA.EscalateAfter)
+	if c.SLA.ReassignAfter > 0 && c.SLA.EscalateAfter > 0 && c.SLA.EscalateAfter <= c.SLA.ReassignAfter {
+		add("sla.escalate_after: must be later than sla.reassign_after")
+	}
+
+	if c.Events.BufferSize < 1 {
+		add("events.buffer_size: must be at least 1, got %d", c.Events.BufferSize)
+	}
+	positive("events.heartbeat", c.Events.Heartbeat)
+
+	if c.Slack.Enabled && c.Slack.SigningSecret == "" {
+		add("slack.signing_secret: required when slack is enabled (use SLACK_SIGNING_SECRET or SLACK_SIGNING_SECRET_FILE)")
+	}
+
+	if c.Email.Enabled {
+		if c.Email.SMTPHost == "" {
+			add("email.smtp_host: required when email is enabled")
+		}
+		if p, err := strconv.Atoi(c.Email.SMTPPort); err != nil || p < 1 || p > 65535 {
+			add("email.smtp_port: %q is not a valid port", c.Email.SMTPPort)
+		}
+		if _, err := mail.ParseAddress(c.Email.From); err != nil {
+			add("email.from: %q is not a valid address", c.Email.From)
+		}
+		positive("email.send_interval", c.Email.SendInterval)
+		if c.Email.DigestHour < 0 || c.Email.DigestHour > 23 {
+			add("email.digest_hour: must be between 0 and 23, got %d", c.Email.DigestHour)
+		}
+		if _, err := time.LoadLocation(c.Email.Timezone); err != nil {
+			add("email.timezone: %v", err)
+		}
+	}
+
+	switch c.RateLimit.Backend {
+	case "memory", "postgres":
+	default:
+		add("rate_limit.backend: %q is not one of memory, postgres", c.RateLimit.Backend)
+	}
+	validRule := func(name string, r RateLimitRule) {
+		if r.Requests < 1 || r.Per <= 0 || r.Burst < 1 {
+			add("%s: requests, per and burst must all be positive", name)
+		}
+	}
+	validRule("rate_limit.default", c.RateLimit.Default)
+	groups := map[string]bool{}
+	for i, g := range c.RateLimit.Groups {
+		name := fmt.Sprintf("rate_limit.groups[%d]", i)
+		if g.Name == "" || g.Name == "default" || groups[g.Name] {
+			add("%s.name: must be unique, non-empty and not \"default\"", name)
+		}
+		groups[g.Name] = true
+		if len(g.Prefixes) == 0 {
+			add("%s.prefixes: at least one path prefix is required", name)
+		}
+		validRule(name, g.RateLimitRule)
+	}
+
+	if c.Auth.Enabled && len(c.Auth.Tokens) == 0 {
+		add("auth.tokens: at least one token is required when auth is enabled")
+	}
+	names := map[string]bool{}
+	tokens := map[string]bool{}
+	for i, t := range c.Auth.Tokens {
+		if t.Name == "" {
+			add("auth.tokens[%d].name: required", i)
+		} else if names[t.Name] {
+			add("auth.tokens[%d].name: duplicate name %q", i, t.Name)
+		}
+		if t.Token == "" {
+			add("auth.tokens[%d].token: required", i)
+		} else if tokens[t.Token] {
+			add("auth.tokens[%d].token: duplicate token", i)
+		}
+		names[t.Name] = true
+		tokens[t.Token] = true
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (c DBConfig) DSN() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     c.Host + ":" + c.Port,
+		Path:     "/" + c.Name,
+		RawQuery: "sslmode=" + url.QueryEscape(c.SSLMode),
+	}
+	return u.String()
+}
+
+// Redacted returns a copy of the configuration that is safe to print.
+func (c Config) Redacted() Config {
+	out := c
+	if out.DB.URL != "" {
+		if u, err := url.Parse(out.DB.URL); err == nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+			out.DB.URL = u.String()
+		} else {
+			out.DB.URL = redacted
+		}
+	}
+	if out.DB.Password != "" {
+		out.DB.Password = redacted
+	}
+	if out.Email.Password != "" {
+		out.Email.Password = redacted
+	}
+	if out.Slack.SigningSecret != "" {
+		out.Slack.SigningSecret = redacted
+	}
+	out.Auth.Tokens = make([]APIToken, len(c.Auth.Tokens))
+	for i, t := range c.Auth.Tokens {
+		t.Token = redacted
+		out.Auth.Tokens[i] = t
+	}
+	return out
+}
+
+func (c Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
 	}
-	return v
+	return buf.Bytes(), nil
 }
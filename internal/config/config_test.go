@@ -0,0 +1,117 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func envMap(m map[string]string) lookupFunc {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+	return p
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "cfg.yaml", `
+http:
+  port: "9000"
+  read_timeout: 2s
+db:
+  password: from-file
+log:
+  level: debug
+`)
+	cfg, err := load("test", []string{"-config", path, "-log-level", "error"}, envMap(map[string]string{
+		"PORT":      "9100",
+		"LOG_LEVEL": "warn",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "9100", cfg.HTTP.Port)
+	require.Equal(t, 2*time.Second, cfg.HTTP.ReadTimeout)
+	require.Equal(t, 10*time.Second, cfg.HTTP.WriteTimeout)
+	require.Equal(t, "error", cfg.Log.Level)
+	require.Equal(t, "from-file", cfg.DB.Password)
+}
+
+func TestLoadSecretFromFile(t *testing.T) {
+	secret := writeFile(t, "pw", "s3cret\n")
+	tokens := writeFile(t, "tokens", "ci:abc\nops:def:admin\n")
+	cfg, err := load("test", nil, envMap(map[string]string{
+		"POSTGRES_PASSWORD_FILE": secret,
+		"AUTH_TOKENS_FILE":       tokens,
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", cfg.DB.Password)
+	require.True(t, cfg.Auth.Enabled)
+	require.Equal(t, []APIToken{{Name: "ci", Token: "abc"}, {Name: "ops", Token: "def", Admin: true}}, cfg.Auth.Tokens)
+	require.Contains(t, cfg.DB.DSN(), "pruser:s3cret@db:5432/pr_review")
+}
+
+func TestLoadRequiresPassword(t *testing.T) {
+	_, err := load("test", nil, envMap(nil))
+	require.ErrorContains(t, err, "db.password")
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := writeFile(t, "cfg.yaml", "http:\n  prot: \"80\"\n")
+	_, err := load("test", []string{"-config", path}, envMap(map[string]string{"POSTGRES_PASSWORD": "x"}))
+	require.ErrorContains(t, err, "field prot not found")
+}
+
+func TestLoadRejectsOtherFormats(t *testing.T) {
+	for _, name := range []string{"cfg.toml", "cfg.json", "cfg"} {
+		path := writeFile(t, name, "")
+		_, err := load("test", []string{"-config", path}, envMap(map[string]string{"POSTGRES_PASSWORD": "x"}))
+		require.ErrorContains(t, err, "only YAML (.yaml, .yml) is supported", name)
+	}
+	path := writeFile(t, "cfg.YML", "log:\n  level: warn\n")
+	cfg, err := load("test", []string{"-config", path}, envMap(map[string]string{"POSTGRES_PASSWORD": "x"}))
+	require.NoError(t, err)
+	require.Equal(t, "warn", cfg.Log.Level)
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.DB.URL = "postgres://u:p@h/db"
+	cfg.HTTP.Port = "abc"
+	cfg.Reviewers.PerPR = 0
+	cfg.Log.Format = "xml"
+	cfg.GRPC = GRPCConfig{Enabled: true, Port: "abc"}
+	cfg.Events.BufferSize = 0
+	cfg.Slack.Enabled = true
+	cfg.Email = EmailConfig{Enabled: true, SMTPHost: "smtp", SMTPPort: "587", From: "nope", SendInterval: time.Second, Timezone: "Mars/Olympus"}
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, want := range []string{"http.port", "grpc.port", "reviewers.per_pr", "log.format", "events.buffer_size", "slack.signing_secret", "email.from", "email.timezone"} {
+		require.Contains(t, err.Error(), want)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.DB.URL = "postgres://u:topsecret@h:5432/db?sslmode=disable"
+	cfg.Auth.Tokens = []APIToken{{Name: "ci", Token: "abc"}}
+	cfg.Slack.SigningSecret = "slacksecret"
+	cfg.Email.Password = "smtpsecret"
+
+	out, err := cfg.Redacted().YAML()
+	require.NoError(t, err)
+	require.False(t, strings.Contains(string(out), "topsecret"))
+	require.False(t, strings.Contains(string(out), "abc"))
+	require.False(t, strings.Contains(string(out), "slacksecret"))
+	require.False(t, strings.Contains(string(out), "smtpsecret"))
+	require.Equal(t, "abc", cfg.Auth.Tokens[0].Token)
+}
@@ -0,0 +1,438 @@
+// Package dashboard serves a small HTML dashboard under /ui/: teams with their
+// members and open PRs, and each user's review queue. Pages are rendered on
+// the server with html/template and work without JavaScript; the buttons post
+// forms to handlers that call the same services as the JSON API.
+package dashboard
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+)
+
+// Prefix is the path the dashboard is served under. It has to bypass the API
+// token middleware: the dashboard authenticates with its own cookie.
+const Prefix = "/ui/"
+
+// tokenCookie holds the API token entered on the login page.
+const tokenCookie = "prreview_token"
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+type dashboard struct {
+	auth  config.AuthConfig
+	repos *repo.SQLRepo
+	svcs  *services.Services
+	pages map[string]*template.Template
+}
+
+// Register mounts the dashboard on r. When auth is enabled the pages ask for
+// an API token, which is kept in a cookie for the session.
+func Register(r *mux.Router, cfg config.AuthConfig, repos *repo.SQLRepo, svcs *services.Services) {
+	d := &dashboard{auth: cfg, repos: repos, svcs: svcs, pages: mustParsePages()}
+
+	ui := r.PathPrefix(strings.TrimSuffix(Prefix, "/")).Subrouter()
+	ui.Use(secureHeaders)
+	ui.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, Prefix+"teams", http.StatusSeeOther)
+	}).Methods("GET")
+	ui.HandleFunc("/login", d.loginForm).Methods("GET")
+	ui.HandleFunc("/login", d.login).Methods("POST")
+	ui.HandleFunc("/logout", d.logout).Methods("POST")
+
+	ui.Handle("/teams", d.session(d.teams)).Methods("GET")
+	ui.Handle("/team", d.session(d.team)).Methods("GET")
+	ui.Handle("/user", d.session(d.user)).Methods("GET")
+	ui.Handle("/users/setIsActive", d.session(d.setIsActive)).Methods("POST")
+	ui.Handle("/pullRequest/reassign", d.session(d.reassign)).Methods("POST")
+	ui.Handle("/pullRequest/merge", d.session(d.merge)).Methods("POST")
+}
+
+func mustParsePages() map[string]*template.Template {
+	pages := map[string]*template.Template{}
+	for _, name := range []string{"login", "teams", "team", "user", "error"} {
+		pages[name] = template.Must(template.ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html"))
+	}
+	return pages
+}
+
+// secureHeaders forbids framing and scripts: the pages need neither.
+func secureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// session authenticates the request with the token cookie and, for forms,
+// checks that they were posted from the dashboard itself.
+func (d *dashboard) session(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !sameOrigin(r) {
+			http.Error(w, "cross-origin form submission", http.StatusForbidden)
+			return
+		}
+		if d.auth.Enabled {
+			var token string
+			if c, err := r.Cookie(tokenCookie); err == nil {
+				token = c.Value
+			}
+			client, ok := auth.Authenticate(d.auth, token)
+			if !ok {
+				http.Redirect(w, r, Prefix+"login", http.StatusSeeOther)
+				return
+			}
+			r = r.WithContext(auth.WithClient(r.Context(), client))
+		}
+		next(w, r)
+	})
+}
+
+// sameOrigin reports whether the Origin (or, failing that, the Referer) of
+// the request names this host. Requests without either are not from a
+// browser page and are let through.
+func sameOrigin(r *http.Request) bool {
+	src := r.Header.Get("Origin")
+	if src == "" {
+		src = r.Header.Get("Referer")
+	}
+	if src == "" {
+		return true
+	}
+	u, err := url.Parse(src)
+	return err == nil && u.Host == r.Host
+}
+
+// page is the data every template gets; Data is the page's own.
+type page struct {
+	Title  string
+	Client string
+	// Auth is set when a session can be logged out of.
+	Auth    bool
+	Message string
+	Error   string
+	Data    interface{}
+}
+
+// render writes the named page. The outcome of the last form, if p has
+// none, comes from the msg and err query parameters set by redirectBack.
+func (d *dashboard) render(w http.ResponseWriter, r *http.Request, status int, name string, p page) {
+	p.Auth = d.auth.Enabled
+	if p.Message == "" && p.Error == "" {
+		p.Message, p.Error = r.URL.Query().Get("msg"), r.URL.Query().Get("err")
+	}
+	if c, ok := auth.ClientFromContext(r.Context()); ok {
+		p.Client = c.Name
+	}
+	var buf bytes.Buffer
+	if err := d.pages[name].ExecuteTemplate(&buf, "layout", p); err != nil {
+		log.Printf("dashboard: render %s: %v", name, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+func (d *dashboard) fail(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, repo.ErrTeamNotFound) || errors.Is(err, repo.ErrUserNotFound) {
+		status = http.StatusNotFound
+	}
+	d.render(w, r, status, "error", page{Title: "Error", Error: userMessage(err)})
+}
+
+func (d *dashboard) loginForm(w http.ResponseWriter, r *http.Request) {
+	if !d.auth.Enabled {
+		http.Redirect(w, r, Prefix+"teams", http.StatusSeeOther)
+		return
+	}
+	d.render(w, r, http.StatusOK, "login", page{Title: "Log in"})
+}
+
+func (d *dashboard) login(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin form submission", http.StatusForbidden)
+		return
+	}
+	if !d.auth.Enabled {
+		http.Redirect(w, r, Prefix+"teams", http.StatusSeeOther)
+		return
+	}
+	token := strings.TrimSpace(r.PostFormValue("token"))
+	if _, ok := auth.Authenticate(d.auth, token); !ok {
+		d.render(w, r, http.StatusUnauthorized, "login", page{Title: "Log in", Error: "Unknown token."})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    token,
+		Path:     Prefix,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, Prefix+"teams", http.StatusSeeOther)
+}
+
+func (d *dashboard) logout(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin form submission", http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: tokenCookie, Path: Prefix, MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	http.Redirect(w, r, Prefix+"login", http.StatusSeeOther)
+}
+
+// teamSummary is a row of the teams page.
+type teamSummary struct {
+	*models.TeamResp
+	Active  int
+	OpenPRs int
+}
+
+func (d *dashboard) teams(w http.ResponseWriter, r *http.Request) {
+	names, _, err := d.repos.ListTeamNames("", 0, 1000)
+	if err != nil {
+		d.fail(w, r, err)
+		return
+	}
+	rows := make([]teamSummary, 0, len(names))
+	for _, name := range names {
+		team, err := d.repos.GetTeamByName(name)
+		if err != nil {
+			d.fail(w, r, err)
+			return
+		}
+		prs, err := d.repos.ListOpenPRs(name)
+		if err != nil {
+			d.fail(w, r, err)
+			return
+		}
+		row := teamSummary{TeamResp: team, OpenPRs: len(prs)}
+		for _, m := range team.Members {
+			if m.IsActive {
+				row.Active++
+			}
+		}
+		rows = append(rows, row)
+	}
+	d.render(w, r, http.StatusOK, "teams", page{Title: "Teams", Data: rows})
+}
+
+// reviewerView is an assigned reviewer of a PR on the team page.
+type reviewerView struct {
+	UserID string
+	// Verdict is the reviewer's latest verdict, empty before the first one.
+	Verdict string
+	// FallbackTeam is set for reviewers borrowed from a fallback team.
+	FallbackTeam string
+}
+
+type prView struct {
+	*models.PullRequestResp
+	Reviewers []reviewerView
+}
+
+func (d *dashboard) team(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("team_name")
+	if name == "" {
+		http.Error(w, "team_name required", http.StatusBadRequest)
+		return
+	}
+	team, err := d.repos.GetTeamByName(name)
+	if err != nil {
+		d.fail(w, r, err)
+		return
+	}
+	sort.Slice(team.Members, func(i, j int) bool { return team.Members[i].UserID < team.Members[j].UserID })
+
+	prs, err := d.repos.ListOpenPRs(name)
+	if err != nil {
+		d.fail(w, r, err)
+		return
+	}
+	views := make([]prView, 0, len(prs))
+	for _, pr := range prs {
+		views = append(views, newPRView(pr))
+	}
+	d.render(w, r, http.StatusOK, "team", page{Title: "Team " + team.TeamName, Data: struct {
+		Team *models.TeamResp
+		PRs  []prView
+		Back string
+	}{team, views, r.URL.RequestURI()}})
+}
+
+func newPRView(pr *models.PullRequestResp) prView {
+	verdicts := map[string]string{}
+	for _, rv := range pr.Reviews {
+		verdicts[rv.ReviewerID] = rv.Verdict
+	}
+	v := prView{PullRequestResp: pr}
+	reviewers := append([]string(nil), pr.AssignedReviewers...)
+	sort.Strings(reviewers)
+	for _, id := range reviewers {
+		v.Reviewers = append(v.Reviewers, reviewerView{UserID: id, Verdict: verdicts[id], FallbackTeam: pr.FallbackReviewers[id]})
+	}
+	return v
+}
+
+func (d *dashboard) user(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id required", http.StatusBadRequest)
+		return
+	}
+	user, err := d.repos.GetUser(userID)
+	if err != nil {
+		d.fail(w, r, err)
+		return
+	}
+	load, err := d.svcs.PR.ReviewLoad(userID)
+	if err != nil {
+		d.fail(w, r, err)
+		return
+	}
+	prs, err := d.repos.GetPRsForUser(userID)
+	if err != nil {
+		d.fail(w, r, err)
+		return
+	}
+	// OPEN reviews first, each group by id.
+	sort.Slice(prs, func(i, j int) bool {
+		if (prs[i].Status == "OPEN") != (prs[j].Status == "OPEN") {
+			return prs[i].Status == "OPEN"
+		}
+		return prs[i].PullRequestID < prs[j].PullRequestID
+	})
+	d.render(w, r, http.StatusOK, "user", page{Title: user.Username, Data: struct {
+		User *models.UserResp
+		Load *models.ReviewLoadResp
+		PRs  []*models.PullRequestShortResp
+		Back string
+	}{user, load, prs, r.URL.RequestURI()}})
+}
+
+func (d *dashboard) setIsActive(w http.ResponseWriter, r *http.Request) {
+	userID := r.PostFormValue("user_id")
+	if userID == "" {
+		http.Error(w, "user_id required", http.StatusBadRequest)
+		return
+	}
+	active := r.PostFormValue("is_active") == "true"
+	user, replaced, err := d.svcs.Users.Update(userID, repo.UserUpdate{}, &active)
+	if err != nil {
+		d.redirectBack(w, r, "", userMessage(err))
+		return
+	}
+	msg := fmt.Sprintf("%s is now active.", user.Username)
+	if !active {
+		moved := 0
+		for _, newID := range replaced {
+			if newID != "" {
+				moved++
+			}
+		}
+		msg = fmt.Sprintf("%s is now inactive; %d review(s) reassigned, %d kept for lack of a candidate.",
+			user.Username, moved, len(replaced)-moved)
+	}
+	d.redirectBack(w, r, msg, "")
+}
+
+func (d *dashboard) reassign(w http.ResponseWriter, r *http.Request) {
+	prID, oldID := r.PostFormValue("pull_request_id"), r.PostFormValue("old_reviewer_id")
+	if prID == "" || oldID == "" {
+		http.Error(w, "pull_request_id and old_reviewer_id required", http.StatusBadRequest)
+		return
+	}
+	newID, _, err := d.svcs.PR.Reassign(prID, oldID, nil)
+	if err != nil {
+		d.redirectBack(w, r, "", userMessage(err))
+		return
+	}
+	d.redirectBack(w, r, fmt.Sprintf("Review of %s handed from %s to %s.", prID, oldID, newID), "")
+}
+
+func (d *dashboard) merge(w http.ResponseWriter, r *http.Request) {
+	prID := r.PostFormValue("pull_request_id")
+	if prID == "" {
+		http.Error(w, "pull_request_id required", http.StatusBadRequest)
+		return
+	}
+	if _, err := d.svcs.PR.MergePR(prID, services.MergeOptions{}); err != nil {
+		d.redirectBack(w, r, "", userMessage(err))
+		return
+	}
+	d.redirectBack(w, r, prID+" merged.", "")
+}
+
+// redirectBack returns to the page the form was posted from, given by the
+// "back" field, with the outcome in the msg or err query parameter. Only
+// dashboard pages are valid targets.
+func (d *dashboard) redirectBack(w http.ResponseWriter, r *http.Request, msg, errMsg string) {
+	target := localPath(r.PostFormValue("back"))
+	q := target.Query()
+	q.Del("msg")
+	q.Del("err")
+	if msg != "" {
+		q.Set("msg", msg)
+	}
+	if errMsg != "" {
+		q.Set("err", errMsg)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusSeeOther)
+}
+
+// localPath parses back as a dashboard path, falling back to the teams page
+// for anything else, such as another host.
+func localPath(back string) *url.URL {
+	u, err := url.Parse(back)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" ||
+		!strings.HasPrefix(u.Path, Prefix) || strings.Contains(back, "\\") {
+		return &url.URL{Path: Prefix + "teams"}
+	}
+	return &url.URL{Path: u.Path, RawQuery: u.RawQuery}
+}
+
+// userMessage explains err to a person; unexpected errors are logged.
+func userMessage(err error) string {
+	switch {
+	case errors.Is(err, repo.ErrPRNotFound), errors.Is(err, sql.ErrNoRows):
+		return "PR not found."
+	case errors.Is(err, repo.ErrTeamNotFound):
+		return "Team not found."
+	case errors.Is(err, repo.ErrUserNotFound):
+		return "User not found."
+	case errors.Is(err, services.ErrPRMerged):
+		return "The PR is already merged."
+	case errors.Is(err, services.ErrNotAssigned):
+		return "The user is not a reviewer of this PR."
+	case errors.Is(err, services.ErrNoCandidate):
+		return "There is no one to hand the review to."
+	case errors.Is(err, services.ErrNotApproved):
+		return "The PR cannot be merged yet: " + strings.TrimPrefix(err.Error(), services.ErrNotApproved.Error()+": ") + "."
+	}
+	log.Printf("dashboard: %v", err)
+	return "Something went wrong, please try again later."
+}
@@ -0,0 +1,148 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/models"
+)
+
+func newTestRouter(cfg config.AuthConfig) *mux.Router {
+	r := mux.NewRouter()
+	Register(r, cfg, nil, nil)
+	return r
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func postForm(target string, form url.Values) *http.Request {
+	req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestLogin(t *testing.T) {
+	r := newTestRouter(config.AuthConfig{Enabled: true, Tokens: []config.APIToken{{Name: "ci", Token: "secret"}}})
+
+	w := serve(r, httptest.NewRequest("GET", "/ui/teams", nil))
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/ui/login", w.Header().Get("Location"))
+
+	w = serve(r, httptest.NewRequest("GET", "/ui/login", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	require.Contains(t, w.Body.String(), `name="token"`)
+
+	w = serve(r, postForm("/ui/login", url.Values{"token": {"wrong"}}))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Body.String(), "Unknown token.")
+	require.Empty(t, w.Result().Cookies())
+
+	w = serve(r, postForm("/ui/login", url.Values{"token": {"secret"}}))
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/ui/teams", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, "secret", cookies[0].Value)
+	require.True(t, cookies[0].HttpOnly)
+	require.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+
+	// A stale cookie sends the user back to the login page.
+	req := postForm("/ui/pullRequest/merge", url.Values{"pull_request_id": {"pr-1"}})
+	req.AddCookie(&http.Cookie{Name: tokenCookie, Value: "revoked"})
+	w = serve(r, req)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/ui/login", w.Header().Get("Location"))
+}
+
+func TestLoginWithoutAuth(t *testing.T) {
+	r := newTestRouter(config.AuthConfig{})
+
+	w := serve(r, httptest.NewRequest("GET", "/ui/", nil))
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/ui/teams", w.Header().Get("Location"))
+
+	w = serve(r, httptest.NewRequest("GET", "/ui/login", nil))
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	require.Equal(t, "/ui/teams", w.Header().Get("Location"))
+}
+
+func TestFormsRequireSameOrigin(t *testing.T) {
+	r := newTestRouter(config.AuthConfig{})
+
+	for _, h := range []struct{ name, value string }{
+		{"Origin", "https://evil.example"},
+		{"Referer", "https://evil.example/page"},
+	} {
+		req := postForm("/ui/pullRequest/merge", url.Values{"pull_request_id": {"pr-1"}})
+		req.Header.Set(h.name, h.value)
+		w := serve(r, req)
+		require.Equal(t, http.StatusForbidden, w.Code, h.name)
+	}
+
+	// Checked before the form is looked at: an empty same-origin form gets
+	// as far as validation.
+	req := postForm("/ui/users/setIsActive", url.Values{})
+	req.Header.Set("Origin", "http://example.com")
+	w := serve(r, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLocalPath(t *testing.T) {
+	for back, want := range map[string]string{
+		"/ui/team?team_name=backend":    "/ui/team?team_name=backend",
+		"/ui/user?user_id=u1&msg=hello": "/ui/user?user_id=u1&msg=hello",
+		"":                              "/ui/teams",
+		"/pullRequest/get":              "/ui/teams",
+		"https://evil.example/ui/teams": "/ui/teams",
+		"//evil.example/ui/teams":       "/ui/teams",
+		"/\\evil.example/ui/teams":      "/ui/teams",
+	} {
+		require.Equal(t, want, localPath(back).String(), back)
+	}
+}
+
+func TestTeamPage(t *testing.T) {
+	d := &dashboard{pages: mustParsePages()}
+	team := &models.TeamResp{TeamName: "backend", Members: []models.TeamMemberResp{
+		{UserID: "u1", Username: "Alice", IsActive: true},
+		{UserID: "u2", Username: "<Bob>", IsActive: false},
+	}}
+	pr := newPRView(&models.PullRequestResp{
+		PullRequestID: "pr-1", PullRequestName: "Add search", AuthorID: "u1", Status: "OPEN",
+		AssignedReviewers: []string{"u3", "u2"},
+		FallbackReviewers: map[string]string{"u3": "platform"},
+		Reviews:           []models.ReviewResp{{ReviewerID: "u2", Verdict: "APPROVED"}},
+	})
+	require.Equal(t, []reviewerView{{UserID: "u2", Verdict: "APPROVED"}, {UserID: "u3", FallbackTeam: "platform"}}, pr.Reviewers)
+
+	req := httptest.NewRequest("GET", "/ui/team?team_name=backend&msg=pr-0+merged.", nil)
+	w := httptest.NewRecorder()
+	d.render(w, req, http.StatusOK, "team", page{Title: "Team backend", Data: struct {
+		Team *models.TeamResp
+		PRs  []prView
+		Back string
+	}{team, []prView{pr}, "/ui/team?team_name=backend"}})
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	require.Contains(t, body, "pr-0 merged.")
+	require.Contains(t, body, "&lt;Bob&gt;")
+	require.NotContains(t, body, "<Bob>")
+	require.Contains(t, body, `<input type="hidden" name="is_active" value="false">`)
+	require.Contains(t, body, `<input type="hidden" name="old_reviewer_id" value="u3">`)
+	require.Contains(t, body, `from platform`)
+	require.Contains(t, body, `action="/ui/pullRequest/merge"`)
+}
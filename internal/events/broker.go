@@ -0,0 +1,174 @@
+// Package events fans the PR events published by the services out to the
+// GET /events streams of this replica.
+//
+// Services publish events with NOTIFY inside their transactions, so every
+// replica receives every committed event, in commit order, through Listen.
+// The Broker keeps the most recent ones so that a client reconnecting with
+// Last-Event-ID, possibly to another replica, gets the events it missed.
+package events
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/example/prreview/internal/models"
+)
+
+// Resync is the type of the event sent instead of a replay when the events
+// after the client's Last-Event-ID are no longer known. The client should
+// reload whatever state it keeps.
+const Resync = "resync"
+
+// subscriptionBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriptionBuffer = 64
+
+// Filter selects the events of one team and/or one user. An empty field
+// matches everything.
+type Filter struct {
+	Team string
+	User string
+}
+
+func (f Filter) Match(e models.Event) bool {
+	if e.Type == Resync {
+		return true
+	}
+	if f.Team != "" && e.TeamName != f.Team {
+		return false
+	}
+	return f.User == "" || e.Involves(f.User)
+}
+
+// Subscription receives the live events matching its filter on C. C is closed
+// when the subscriber falls behind or the broker is closed; a client that
+// reconnects with Last-Event-ID then resumes where it stopped.
+type Subscription struct {
+	C <-chan models.Event
+
+	ch     chan models.Event
+	filter Filter
+	broker *Broker
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s)
+}
+
+// Broker buffers the last events in the order they were received and passes
+// new ones to subscribers.
+type Broker struct {
+	mu     sync.Mutex
+	buf    []models.Event
+	next   int // index in buf the next event is written to once buf is full
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBroker(size int) *Broker {
+	return &Broker{
+		buf:  make([]models.Event, 0, size),
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish buffers e and sends it to the matching subscribers.
+func (b *Broker) Publish(e models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if len(b.buf) < cap(b.buf) {
+		b.buf = append(b.buf, e)
+	} else {
+		b.buf[b.next] = e
+		b.next = (b.next + 1) % len(b.buf)
+	}
+	b.send(e)
+}
+
+// Resync forgets the buffered events and tells every subscriber to resync.
+// It is used when events may have been lost, e.g. while the connection to
+// the database was down.
+func (b *Broker) Resync() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = b.buf[:0]
+	b.next = 0
+	b.send(models.Event{Type: Resync})
+}
+
+// Subscribe registers a subscriber and returns the buffered events after
+// lastEventID that match f. resync is true when lastEventID is set but not
+// buffered, i.e. the events the client missed are unknown.
+func (b *Broker) Subscribe(f Filter, lastEventID string) (sub *Subscription, replay []models.Event, resync bool) {
+	ch := make(chan models.Event, subscriptionBuffer)
+	sub = &Subscription{C: ch, ch: ch, filter: f, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return sub, nil, false
+	}
+	b.subs[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, false
+	}
+	ordered := append(append([]models.Event{}, b.buf[b.next:]...), b.buf[:b.next]...)
+	id, err := strconv.ParseInt(lastEventID, 10, 64)
+	if err != nil {
+		return sub, nil, true
+	}
+	// Ids come from a sequence but are delivered in commit order, which may
+	// differ, so the resume point is found by position rather than by value.
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if ordered[i].ID != id {
+			continue
+		}
+		for _, e := range ordered[i+1:] {
+			if f.Match(e) {
+				replay = append(replay, e)
+			}
+		}
+		return sub, replay, false
+	}
+	return sub, nil, true
+}
+
+// Close ends every subscription and ignores later events.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		b.drop(sub)
+	}
+}
+
+// send must be called with b.mu held.
+func (b *Broker) send(e models.Event) {
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			b.drop(sub)
+		}
+	}
+}
+
+// drop must be called with b.mu held.
+func (b *Broker) drop(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/models"
+)
+
+func ids(evs []models.Event) []int64 {
+	out := []int64{}
+	for _, e := range evs {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func TestSubscribeReplaysAfterLastEventID(t *testing.T) {
+	b := NewBroker(3)
+	// Commit order differs from id order.
+	for _, id := range []int64{1, 3, 2, 4} {
+		b.Publish(models.Event{ID: id, Type: models.EventPRCreated, TeamName: "backend"})
+	}
+
+	sub, replay, resync := b.Subscribe(Filter{}, "3")
+	defer sub.Close()
+	require.False(t, resync)
+	require.Equal(t, []int64{2, 4}, ids(replay))
+
+	_, replay, resync = b.Subscribe(Filter{}, "4")
+	require.False(t, resync)
+	require.Empty(t, replay)
+
+	// 1 has been pushed out of the buffer.
+	_, replay, resync = b.Subscribe(Filter{}, "1")
+	require.True(t, resync)
+	require.Empty(t, replay)
+
+	_, _, resync = b.Subscribe(Filter{}, "abc")
+	require.True(t, resync)
+
+	_, replay, resync = b.Subscribe(Filter{}, "")
+	require.False(t, resync)
+	require.Empty(t, replay)
+}
+
+func TestFilter(t *testing.T) {
+	e := models.Event{
+		Type: models.EventReviewerReassigned, TeamName: "backend", AuthorID: "u1",
+		Reviewers: []string{"u2", "u4"}, ReviewerID: "u3", NewReviewerID: "u4",
+	}
+	for _, f := range []Filter{{}, {Team: "backend"}, {User: "u1"}, {User: "u2"}, {User: "u3"}, {Team: "backend", User: "u4"}} {
+		require.True(t, f.Match(e), "%+v", f)
+	}
+	for _, f := range []Filter{{Team: "frontend"}, {User: "u5"}, {Team: "frontend", User: "u1"}} {
+		require.False(t, f.Match(e), "%+v", f)
+	}
+	require.True(t, Filter{Team: "frontend"}.Match(models.Event{Type: Resync}))
+
+	escalated := models.Event{Type: models.EventReviewEscalated, TeamName: "backend", AuthorID: "u1", ReviewerID: "u2", LeadUserID: "u9"}
+	require.True(t, Filter{User: "u9"}.Match(escalated), "the lead sees escalations")
+}
+
+func TestPublishDeliversMatchingEvents(t *testing.T) {
+	b := NewBroker(10)
+	sub, _, _ := b.Subscribe(Filter{User: "u1"}, "")
+	defer sub.Close()
+
+	b.Publish(models.Event{ID: 1, AuthorID: "u2"})
+	b.Publish(models.Event{ID: 2, AuthorID: "u1"})
+	require.Equal(t, int64(2), (<-sub.C).ID)
+
+	b.Resync()
+	require.Equal(t, Resync, (<-sub.C).Type)
+	_, _, resync := b.Subscribe(Filter{}, "2")
+	require.True(t, resync, "buffer is emptied on resync")
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(10)
+	sub, _, _ := b.Subscribe(Filter{}, "")
+	for i := 0; i <= subscriptionBuffer; i++ {
+		b.Publish(models.Event{ID: int64(i)})
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	require.Equal(t, subscriptionBuffer, n)
+	sub.Close()
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	b := NewBroker(10)
+	sub, _, _ := b.Subscribe(Filter{}, "")
+	b.Close()
+	_, ok := <-sub.C
+	require.False(t, ok)
+
+	late, _, _ := b.Subscribe(Filter{}, "")
+	_, ok = <-late.C
+	require.False(t, ok)
+	late.Close()
+}
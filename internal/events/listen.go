@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+)
+
+const listenerPing = 90 * time.Second
+
+// Listen feeds b with the events published on repo.EventsChannel until ctx
+// is cancelled, then closes b. The listener reconnects on its own; events
+// sent while it was disconnected are lost, so b is told to resync.
+func Listen(ctx context.Context, dsn string, b *Broker, logger *log.Logger) error {
+	defer b.Close()
+
+	l := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Printf("events listener: %v", err)
+		}
+	})
+	defer func() { _ = l.Close() }()
+	if err := l.Listen(repo.EventsChannel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(listenerPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-l.Notify:
+			if n == nil {
+				b.Resync()
+				continue
+			}
+			var e models.Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				logger.Printf("events listener: bad payload: %v", err)
+				continue
+			}
+			b.Publish(e)
+		case <-ping.C:
+			go func() { _ = l.Ping() }()
+		}
+	}
+}
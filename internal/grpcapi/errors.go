@@ -0,0 +1,63 @@
+package grpcapi
+
+import (
+	"database/sql"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+)
+
+// errorDomain is the ErrorInfo domain of every error; the reason is the REST
+// error code.
+const errorDomain = "prreview"
+
+// statusError maps service and repository errors to gRPC statuses.
+func statusError(err error) error {
+	code, reason := codes.Internal, "INTERNAL"
+	switch {
+	case errors.Is(err, repo.ErrTeamNotFound), errors.Is(err, repo.ErrUserNotFound),
+		errors.Is(err, repo.ErrPRNotFound), errors.Is(err, sql.ErrNoRows),
+		errors.Is(err, services.ErrAuthorMissing), errors.Is(err, services.ErrNotTeamMember):
+		code, reason = codes.NotFound, "NOT_FOUND"
+	case errors.Is(err, repo.ErrTeamExists):
+		code, reason = codes.AlreadyExists, "TEAM_EXISTS"
+	case errors.Is(err, repo.ErrUserExists):
+		code, reason = codes.AlreadyExists, "USER_EXISTS"
+	case errors.Is(err, services.ErrPRExists):
+		code, reason = codes.AlreadyExists, "PR_EXISTS"
+	case errors.Is(err, services.ErrPRMerged):
+		code, reason = codes.FailedPrecondition, "PR_MERGED"
+	case errors.Is(err, services.ErrNotAssigned):
+		code, reason = codes.FailedPrecondition, "NOT_ASSIGNED"
+	case errors.Is(err, services.ErrNoCandidate):
+		code, reason = codes.FailedPrecondition, "NO_CANDIDATE"
+	case errors.Is(err, services.ErrNotApproved):
+		code, reason = codes.FailedPrecondition, "NOT_APPROVED"
+	case errors.Is(err, repo.ErrTeamArchived):
+		code, reason = codes.FailedPrecondition, "TEAM_ARCHIVED"
+	case errors.Is(err, services.ErrAmbiguousTeam):
+		code, reason = codes.InvalidArgument, "AMBIGUOUS_TEAM"
+	case errors.Is(err, services.ErrInvalidVerdict):
+		code, reason = codes.InvalidArgument, "BAD_REQUEST"
+	case errors.Is(err, repo.ErrVersionMismatch):
+		code, reason = codes.FailedPrecondition, "PRECONDITION_FAILED"
+	}
+	return newStatus(code, reason, err.Error())
+}
+
+func invalidArgument(msg string) error {
+	return newStatus(codes.InvalidArgument, "BAD_REQUEST", msg)
+}
+
+func newStatus(code codes.Code, reason, msg string) error {
+	st := status.New(code, msg)
+	if withInfo, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
@@ -0,0 +1,132 @@
+package grpcapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	pb "github.com/example/prreview/pkg/pb/prreview/v1"
+)
+
+type prServer struct {
+	pb.UnimplementedPullRequestServiceServer
+	repos *repo.SQLRepo
+	svcs  *services.Services
+}
+
+func (s *prServer) CreatePullRequest(ctx context.Context, req *pb.CreatePullRequestRequest) (*pb.CreatePullRequestResponse, error) {
+	if req.GetPullRequestId() == "" || req.GetPullRequestName() == "" || req.GetAuthorId() == "" {
+		return nil, invalidArgument("pull_request_id, pull_request_name and author_id required")
+	}
+	_, err := s.svcs.PR.CreatePR(req.GetPullRequestId(), req.GetPullRequestName(), req.GetAuthorId(), req.GetTeamName(), req.GetChangedFiles())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	pr, err := s.getPR(req.GetPullRequestId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreatePullRequestResponse{PullRequest: pr}, nil
+}
+
+func (s *prServer) GetPullRequest(ctx context.Context, req *pb.GetPullRequestRequest) (*pb.GetPullRequestResponse, error) {
+	if req.GetPullRequestId() == "" {
+		return nil, invalidArgument("pull_request_id required")
+	}
+	version, err := s.repos.PRVersion(req.GetPullRequestId())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	pr, err := s.getPR(req.GetPullRequestId())
+	if err != nil {
+		return nil, err
+	}
+	sendETag(ctx, version)
+	return &pb.GetPullRequestResponse{PullRequest: pr}, nil
+}
+
+func (s *prServer) MergePullRequest(ctx context.Context, req *pb.MergePullRequestRequest) (*pb.MergePullRequestResponse, error) {
+	if req.GetPullRequestId() == "" {
+		return nil, invalidArgument("pull_request_id required")
+	}
+	opts := services.MergeOptions{Force: req.GetForce(), Reason: req.GetReason(), IfMatch: ifMatch(ctx)}
+	if opts.Force {
+		client, ok := auth.ClientFromContext(ctx)
+		if !ok || !client.Admin {
+			return nil, newStatus(codes.PermissionDenied, "FORBIDDEN", "force merge requires an admin token")
+		}
+		if opts.Reason == "" {
+			return nil, invalidArgument("reason required for force merge")
+		}
+		opts.Actor = client.Name
+	}
+
+	if _, err := s.svcs.PR.MergePR(req.GetPullRequestId(), opts); err != nil {
+		return nil, statusError(err)
+	}
+	pr, err := s.getPR(req.GetPullRequestId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.MergePullRequestResponse{PullRequest: pr}, nil
+}
+
+func (s *prServer) ReassignReviewer(ctx context.Context, req *pb.ReassignReviewerRequest) (*pb.ReassignReviewerResponse, error) {
+	if req.GetPullRequestId() == "" || req.GetOldReviewerId() == "" {
+		return nil, invalidArgument("pull_request_id and old_reviewer_id required")
+	}
+	newID, _, err := s.svcs.PR.Reassign(req.GetPullRequestId(), req.GetOldReviewerId(), ifMatch(ctx))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	pr, err := s.getPR(req.GetPullRequestId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReassignReviewerResponse{PullRequest: pr, ReplacedBy: newID}, nil
+}
+
+func (s *prServer) SubmitReview(ctx context.Context, req *pb.SubmitReviewRequest) (*pb.SubmitReviewResponse, error) {
+	if req.GetPullRequestId() == "" || req.GetReviewerId() == "" || req.GetVerdict() == "" {
+		return nil, invalidArgument("pull_request_id, reviewer_id and verdict required")
+	}
+	pr, err := s.svcs.PR.SubmitReview(req.GetPullRequestId(), req.GetReviewerId(), req.GetVerdict(), req.GetComment(), ifMatch(ctx))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.SubmitReviewResponse{PullRequest: prToPB(pr)}, nil
+}
+
+func (s *prServer) getPR(id string) (*pb.PullRequest, error) {
+	pr, err := s.repos.GetPR(id)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return prToPB(pr), nil
+}
+
+func prToPB(pr *models.PullRequestResp) *pb.PullRequest {
+	out := &pb.PullRequest{
+		PullRequestId:     pr.PullRequestID,
+		PullRequestName:   pr.PullRequestName,
+		AuthorId:          pr.AuthorID,
+		Status:            pr.Status,
+		AssignedReviewers: pr.AssignedReviewers,
+		TeamName:          pr.Team_name,
+		FallbackReviewers: pr.FallbackReviewers,
+	}
+	for _, r := range pr.Reviews {
+		out.Reviews = append(out.Reviews, &pb.Review{
+			ReviewerId:  r.ReviewerID,
+			Verdict:     r.Verdict,
+			Comment:     r.Comment,
+			SubmittedAt: timestamppb.New(r.SubmittedAt),
+		})
+	}
+	return out
+}
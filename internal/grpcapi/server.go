@@ -0,0 +1,160 @@
+// Package grpcapi serves the team, user and pull request operations over
+// gRPC, next to the REST API and on top of the same services.
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	pb "github.com/example/prreview/pkg/pb/prreview/v1"
+)
+
+type Server struct {
+	*grpc.Server
+	health *health.Server
+}
+
+// NewServer registers the API, the health service and server reflection.
+// Health checks and reflection do not need a token.
+func NewServer(cfg config.AuthConfig, repos *repo.SQLRepo, svcs *services.Services) *Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryAuth(cfg)),
+		grpc.ChainStreamInterceptor(streamAuth(cfg)),
+	)
+	pb.RegisterTeamServiceServer(s, &teamServer{repos: repos})
+	pb.RegisterUserServiceServer(s, &userServer{repos: repos, svcs: svcs})
+	pb.RegisterPullRequestServiceServer(s, &prServer{repos: repos, svcs: svcs})
+
+	h := health.NewServer()
+	healthpb.RegisterHealthServer(s, h)
+	reflection.Register(s)
+	for name := range s.GetServiceInfo() {
+		h.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	return &Server{Server: s, health: h}
+}
+
+// Shutdown reports NOT_SERVING to health checks and waits for running calls,
+// cancelling them when ctx ends first.
+func (s *Server) Shutdown(ctx context.Context) {
+	s.health.Shutdown()
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
+
+// public lists the method prefixes that skip authentication.
+var public = []string{"/grpc.health.v1.Health/", "/grpc.reflection."}
+
+// authenticate checks the token of a call the way auth.Middleware checks
+// REST requests: "authorization: Bearer <token>" or "x-api-key: <token>".
+func authenticate(ctx context.Context, cfg config.AuthConfig, method string) (context.Context, error) {
+	if !cfg.Enabled {
+		return ctx, nil
+	}
+	for _, p := range public {
+		if strings.HasPrefix(method, p) {
+			return ctx, nil
+		}
+	}
+	c, ok := auth.Authenticate(cfg, tokenFromMetadata(ctx))
+	if !ok {
+		return nil, newStatus(codes.Unauthenticated, "UNAUTHORIZED", "missing or invalid API token")
+	}
+	return auth.WithClient(ctx, c), nil
+}
+
+func tokenFromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, h := range md.Get("authorization") {
+		if strings.HasPrefix(h, "Bearer ") {
+			return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+		}
+	}
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// ifMatch returns the versions listed in the "if-match" metadata, the
+// counterpart of the REST If-Match header: quoted ETags, comma-separated or
+// repeated. "*" or no key makes a write unconditional.
+func ifMatch(ctx context.Context) repo.IfMatch {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var m repo.IfMatch
+	for _, v := range md.Get("if-match") {
+		for _, tag := range strings.Split(v, ",") {
+			tag = strings.TrimSpace(tag)
+			switch {
+			case tag == "":
+				continue
+			case tag == "*":
+				return nil
+			case len(tag) >= 2 && tag[0] == '"' && tag[len(tag)-1] == '"':
+				tag = tag[1 : len(tag)-1]
+			}
+			m = append(m, tag)
+		}
+	}
+	return m
+}
+
+// sendETag returns the version of a read resource in the "etag" header
+// metadata, quoted as in the REST ETag header.
+func sendETag(ctx context.Context, version string) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs("etag", `"`+version+`"`))
+}
+
+func unaryAuth(cfg config.AuthConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, cfg, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuth(cfg config.AuthConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), cfg, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context { return s.ctx }
+
+func int32Ptr(n *int) *int32 {
+	if n == nil {
+		return nil
+	}
+	v := int32(*n)
+	return &v
+}
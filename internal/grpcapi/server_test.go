@@ -0,0 +1,151 @@
+package grpcapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	pb "github.com/example/prreview/pkg/pb/prreview/v1"
+)
+
+var testAuth = config.AuthConfig{Enabled: true, Tokens: []config.APIToken{
+	{Name: "ci", Token: "ci-token"},
+	{Name: "ops", Token: "ops-token", Admin: true},
+}}
+
+// dial serves a server without repository behind bufconn; the calls in these
+// tests are rejected before they reach the database.
+func dial(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(testAuth, nil, nil)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func requireStatus(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	require.True(t, ok, "not a status error: %v", err)
+	require.Equal(t, code, st.Code(), st.Message())
+	require.Len(t, st.Details(), 1)
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	require.Equal(t, reason, info.GetReason())
+	require.Equal(t, errorDomain, info.GetDomain())
+}
+
+func TestHealthAndReflectionArePublic(t *testing.T) {
+	conn := dial(t)
+	ctx := context.Background()
+
+	health := healthpb.NewHealthClient(conn)
+	for _, service := range []string{"", "prreview.v1.TeamService", "prreview.v1.PullRequestService"} {
+		resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	var names []string
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		names = append(names, s.GetName())
+	}
+	require.Subset(t, names, []string{"prreview.v1.TeamService", "prreview.v1.UserService", "prreview.v1.PullRequestService"})
+}
+
+func TestCallsNeedToken(t *testing.T) {
+	teams := pb.NewTeamServiceClient(dial(t))
+
+	_, err := teams.GetTeam(context.Background(), &pb.GetTeamRequest{TeamName: "backend"})
+	requireStatus(t, err, codes.Unauthenticated, "UNAUTHORIZED")
+	_, err = teams.GetTeam(withToken("wrong"), &pb.GetTeamRequest{TeamName: "backend"})
+	requireStatus(t, err, codes.Unauthenticated, "UNAUTHORIZED")
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "ci-token")
+	_, err = teams.GetTeam(ctx, &pb.GetTeamRequest{})
+	requireStatus(t, err, codes.InvalidArgument, "BAD_REQUEST")
+}
+
+func TestForceMergeNeedsAdmin(t *testing.T) {
+	prs := pb.NewPullRequestServiceClient(dial(t))
+
+	_, err := prs.MergePullRequest(withToken("ci-token"), &pb.MergePullRequestRequest{PullRequestId: "pr-1", Force: true, Reason: "hotfix"})
+	requireStatus(t, err, codes.PermissionDenied, "FORBIDDEN")
+	_, err = prs.MergePullRequest(withToken("ops-token"), &pb.MergePullRequestRequest{PullRequestId: "pr-1", Force: true})
+	requireStatus(t, err, codes.InvalidArgument, "BAD_REQUEST")
+}
+
+func TestStatusError(t *testing.T) {
+	cases := []struct {
+		err    error
+		code   codes.Code
+		reason string
+	}{
+		{repo.ErrTeamNotFound, codes.NotFound, "NOT_FOUND"},
+		{sql.ErrNoRows, codes.NotFound, "NOT_FOUND"},
+		{services.ErrAuthorMissing, codes.NotFound, "NOT_FOUND"},
+		{repo.ErrTeamExists, codes.AlreadyExists, "TEAM_EXISTS"},
+		{services.ErrPRExists, codes.AlreadyExists, "PR_EXISTS"},
+		{services.ErrPRMerged, codes.FailedPrecondition, "PR_MERGED"},
+		{services.ErrNoCandidate, codes.FailedPrecondition, "NO_CANDIDATE"},
+		{fmt.Errorf("%w: 0 of 1", services.ErrNotApproved), codes.FailedPrecondition, "NOT_APPROVED"},
+		{repo.ErrTeamArchived, codes.FailedPrecondition, "TEAM_ARCHIVED"},
+		{fmt.Errorf("%w: a, b", services.ErrAmbiguousTeam), codes.InvalidArgument, "AMBIGUOUS_TEAM"},
+		{repo.ErrVersionMismatch, codes.FailedPrecondition, "PRECONDITION_FAILED"},
+		{sql.ErrConnDone, codes.Internal, "INTERNAL"},
+	}
+	for _, c := range cases {
+		requireStatus(t, statusError(c.err), c.code, c.reason)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	for _, c := range []struct {
+		values []string
+		want   repo.IfMatch
+	}{
+		{nil, nil},
+		{[]string{"*"}, nil},
+		{[]string{`"3"`}, repo.IfMatch{"3"}},
+		{[]string{`"3", "4.10"`, `"5"`}, repo.IfMatch{"3", "4.10", "5"}},
+	} {
+		md := metadata.MD{}
+		for _, v := range c.values {
+			md.Append("if-match", v)
+		}
+		require.Equal(t, c.want, ifMatch(metadata.NewIncomingContext(context.Background(), md)), c.values)
+	}
+}
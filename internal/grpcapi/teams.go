@@ -0,0 +1,61 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	pb "github.com/example/prreview/pkg/pb/prreview/v1"
+)
+
+type teamServer struct {
+	pb.UnimplementedTeamServiceServer
+	repos *repo.SQLRepo
+}
+
+func (s *teamServer) AddTeam(ctx context.Context, req *pb.AddTeamRequest) (*pb.AddTeamResponse, error) {
+	if req.GetTeamName() == "" {
+		return nil, invalidArgument("team_name is required")
+	}
+	members := make([]models.TeamMemberResp, 0, len(req.GetMembers()))
+	for _, m := range req.GetMembers() {
+		members = append(members, models.TeamMemberResp{UserID: m.GetUserId(), Username: m.GetUsername(), IsActive: m.GetIsActive()})
+	}
+
+	team, err := s.repos.CreateTeam(req.GetTeamName(), members)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.AddTeamResponse{Team: teamToPB(team)}, nil
+}
+
+func (s *teamServer) GetTeam(ctx context.Context, req *pb.GetTeamRequest) (*pb.GetTeamResponse, error) {
+	if req.GetTeamName() == "" {
+		return nil, invalidArgument("team_name is required")
+	}
+	version, err := s.repos.TeamVersion(req.GetTeamName())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	team, err := s.repos.GetTeamByName(req.GetTeamName())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	sendETag(ctx, version)
+	return &pb.GetTeamResponse{Team: teamToPB(team)}, nil
+}
+
+func teamToPB(t *models.TeamResp) *pb.Team {
+	out := &pb.Team{
+		TeamName:              t.TeamName,
+		FallbackTeams:         t.FallbackTeams,
+		DefaultMaxOpenReviews: int32Ptr(t.DefaultMaxOpenReviews),
+		RequiredApprovals:     int32Ptr(t.RequiredApprovals),
+		LeadUserId:            t.LeadUserID,
+		Archived:              t.Archived,
+	}
+	for _, m := range t.Members {
+		out.Members = append(out.Members, &pb.TeamMember{UserId: m.UserID, Username: m.Username, IsActive: m.IsActive})
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	pb "github.com/example/prreview/pkg/pb/prreview/v1"
+)
+
+type userServer struct {
+	pb.UnimplementedUserServiceServer
+	repos *repo.SQLRepo
+	svcs  *services.Services
+}
+
+func (s *userServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, invalidArgument("user_id is required")
+	}
+	version, err := s.repos.UserVersion(req.GetUserId())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	user, err := s.repos.GetUser(req.GetUserId())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	sendETag(ctx, version)
+	return &pb.GetUserResponse{User: userToPB(user)}, nil
+}
+
+func (s *userServer) SetIsActive(ctx context.Context, req *pb.SetIsActiveRequest) (*pb.SetIsActiveResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, invalidArgument("user_id is required")
+	}
+	active := req.GetIsActive()
+	user, reassigned, err := s.svcs.Users.Update(req.GetUserId(), repo.UserUpdate{IfMatch: ifMatch(ctx)}, &active)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.SetIsActiveResponse{User: userToPB(user), Reassigned: reassigned}, nil
+}
+
+func (s *userServer) GetReview(ctx context.Context, req *pb.GetReviewRequest) (*pb.GetReviewResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, invalidArgument("user_id is required")
+	}
+	load, err := s.svcs.PR.ReviewLoad(req.GetUserId())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	prs, err := s.repos.GetPRsForUser(req.GetUserId())
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	out := &pb.GetReviewResponse{
+		UserId: req.GetUserId(),
+		Load:   &pb.ReviewLoad{OpenReviews: int32(load.OpenReviews), MaxOpenReviews: int32Ptr(load.MaxOpenReviews)},
+	}
+	for _, pr := range prs {
+		out.PullRequests = append(out.PullRequests, &pb.PullRequestShort{
+			PullRequestId:   pr.PullRequestID,
+			PullRequestName: pr.PullRequestName,
+			AuthorId:        pr.AuthorID,
+			Status:          pr.Status,
+		})
+	}
+	return out, nil
+}
+
+func userToPB(u *models.UserResp) *pb.User {
+	return &pb.User{
+		UserId:      u.UserID,
+		Username:    u.Username,
+		Teams:       u.Teams,
+		IsActive:    u.IsActive,
+		Email:       u.Email,
+		SlackUserId: u.SlackUserID,
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	"github.com/gorilla/mux"
+)
+
+func RegisterAbsenceRoutes(r *mux.Router, repos *repo.SQLRepo, svcs *services.Services) {
+	r.HandleFunc("/users/absences/create", makeCreateAbsenceHandler(svcs)).Methods("POST")
+	r.HandleFunc("/users/absences/list", makeListAbsencesHandler(svcs)).Methods("GET")
+	r.HandleFunc("/users/absences/cancel", makeCancelAbsenceHandler(svcs)).Methods("POST")
+	r.HandleFunc("/users/absences/handoffs", makeListHandoffsHandler(svcs)).Methods("GET")
+	r.HandleFunc("/users/absences/handoffs/accept", makeResolveHandoffsHandler(svcs.Absences.AcceptHandoffs)).Methods("POST")
+	r.HandleFunc("/users/absences/handoffs/decline", makeResolveHandoffsHandler(svcs.Absences.DeclineHandoffs)).Methods("POST")
+}
+
+func makeCreateAbsenceHandler(svcs *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			UserID   string    `json:"user_id"`
+			StartsAt time.Time `json:"starts_at"`
+			EndsAt   time.Time `json:"ends_at"`
+			Reason   string    `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if in.UserID == "" || in.StartsAt.IsZero() || in.EndsAt.IsZero() {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id, starts_at and ends_at required")
+			return
+		}
+
+		a, err := svcs.Absences.Create(in.UserID, in.StartsAt, in.EndsAt, in.Reason)
+		if err != nil {
+			writeAbsenceError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]*models.AbsenceResp{"absence": a})
+	}
+}
+
+func makeListAbsencesHandler(svcs *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id required")
+			return
+		}
+		includePast := r.URL.Query().Get("include_past") == "true"
+
+		absences, err := svcs.Absences.List(userID, includePast)
+		if err != nil {
+			writeAbsenceError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"user_id": userID, "absences": absences})
+	}
+}
+
+func makeCancelAbsenceHandler(svcs *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			AbsenceID int64 `json:"absence_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if in.AbsenceID == 0 {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "absence_id required")
+			return
+		}
+
+		a, err := svcs.Absences.Cancel(in.AbsenceID)
+		if err != nil {
+			writeAbsenceError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]*models.AbsenceResp{"absence": a})
+	}
+}
+
+func makeListHandoffsHandler(svcs *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.URL.Query().Get("absence_id"), 10, 64)
+		if err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "absence_id required")
+			return
+		}
+
+		handoffs, err := svcs.Absences.Handoffs(id)
+		if err != nil {
+			writeAbsenceError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string][]models.HandoffResp{"handoffs": handoffs})
+	}
+}
+
+func makeResolveHandoffsHandler(resolve func(int64, []string) ([]models.HandoffResp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			AbsenceID      int64    `json:"absence_id"`
+			PullRequestIDs []string `json:"pull_request_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if in.AbsenceID == 0 {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "absence_id required")
+			return
+		}
+
+		handoffs, err := resolve(in.AbsenceID, in.PullRequestIDs)
+		if err != nil {
+			writeAbsenceError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string][]models.HandoffResp{"handoffs": handoffs})
+	}
+}
+
+func writeAbsenceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repo.ErrUserNotFound), errors.Is(err, repo.ErrAbsenceNotFound):
+		sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, services.ErrInvalidAbsence):
+		sendAPIError(w, http.StatusBadRequest, "INVALID_ABSENCE", err.Error())
+	case errors.Is(err, services.ErrAbsenceClosed):
+		sendAPIError(w, http.StatusConflict, "ABSENCE_CLOSED", err.Error())
+	default:
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+	}
+}
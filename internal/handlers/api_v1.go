@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	"github.com/example/prreview/internal/teamspec"
+)
+
+// APIv1Prefix is where the resource-oriented API is served. It shares the
+// services and error format with the older RPC-style routes.
+const APIv1Prefix = "/api/v1"
+
+func RegisterAPIv1Routes(r *mux.Router, repos *repo.SQLRepo, svcs *services.Services) {
+	v1 := r.PathPrefix(APIv1Prefix).Subrouter()
+
+	v1.HandleFunc("/teams/{name}", func(w http.ResponseWriter, r *http.Request) {
+		writeTeam(w, r, repos, mux.Vars(r)["name"], http.StatusOK)
+	}).Methods("GET")
+	v1.HandleFunc("/teams/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handleTeamPut(w, r, repos, svcs)
+	}).Methods("PUT")
+
+	v1.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeUser(w, r, repos, mux.Vars(r)["id"])
+	}).Methods("GET")
+	v1.HandleFunc("/users/{id}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		writeUserReviews(w, repos, svcs, mux.Vars(r)["id"])
+	}).Methods("GET")
+
+	v1.HandleFunc("/pull-requests", func(w http.ResponseWriter, r *http.Request) {
+		var in createPRInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if pr, ok := createPR(w, svcs, in); ok {
+			w.Header().Set("Location", APIv1Prefix+"/pull-requests/"+url.PathEscape(pr.PullRequestID))
+			writeJSON(w, http.StatusCreated, map[string]models.PullRequestResp{"pr": pr})
+		}
+	}).Methods("POST")
+	v1.HandleFunc("/pull-requests/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writePR(w, r, repos, mux.Vars(r)["id"])
+	}).Methods("GET")
+	v1.HandleFunc("/pull-requests/{id}/merge", func(w http.ResponseWriter, r *http.Request) {
+		var in mergeInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil && !errors.Is(err, io.EOF) {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		id := mux.Vars(r)["id"]
+		if _, ok := mergePR(w, r, svcs, id, in); ok {
+			writePR(w, r, repos, id)
+		}
+	}).Methods("POST")
+	v1.HandleFunc("/pull-requests/{id}/reassign", func(w http.ResponseWriter, r *http.Request) {
+		handlePRReassignV1(w, r, repos, svcs)
+	}).Methods("POST")
+	v1.HandleFunc("/pull-requests/{id}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		var in reviewInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		submitReview(w, r, svcs, mux.Vars(r)["id"], in)
+	}).Methods("POST")
+}
+
+func handlePRReassignV1(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, svcs *services.Services) {
+	var in struct {
+		OldUserID string `json:"old_reviewer_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if in.OldUserID == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "old_reviewer_id required")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	newID, _, err := svcs.PR.Reassign(id, in.OldUserID, ifMatch(r))
+	if err != nil {
+		writePRError(w, err)
+		return
+	}
+	pr, err := repos.GetPR(id)
+	if err != nil {
+		writePRError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pr": pr, "replaced_by": newID})
+}
+
+// teamPutInput is the shape of GET /api/v1/teams/{name}, so a team can be
+// read, edited and written back. Settings left out are kept as they are; the
+// member list is always replaced.
+type teamPutInput struct {
+	TeamName string `json:"team_name"`
+	Members  []struct {
+		UserID   string `json:"user_id"`
+		Username string `json:"username"`
+		IsActive *bool  `json:"is_active"`
+	} `json:"members"`
+	FallbackTeams         []string `json:"fallback_teams"`
+	DefaultMaxOpenReviews *int     `json:"default_max_open_reviews"`
+	RequiredApprovals     *int     `json:"required_approvals"`
+	LeadUserID            *string  `json:"lead_user_id"`
+	SLA                   *struct {
+		FirstResponse *string `json:"first_response"`
+		Verdict       *string `json:"verdict"`
+	} `json:"sla"`
+}
+
+// handleTeamPut creates or replaces a team in one transaction, the way
+// `prreview apply -prune=remove` does for a team file with a single team.
+func handleTeamPut(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, svcs *services.Services) {
+	name := mux.Vars(r)["name"]
+	var in teamPutInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if in.TeamName != "" && in.TeamName != name {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name does not match the URL")
+		return
+	}
+	if in.Members == nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "members required")
+		return
+	}
+
+	team := teamspec.Team{
+		Name:              name,
+		FallbackTeams:     in.FallbackTeams,
+		MaxOpenReviews:    in.DefaultMaxOpenReviews,
+		RequiredApprovals: in.RequiredApprovals,
+		Lead:              in.LeadUserID,
+	}
+	listed := map[string]bool{}
+	for _, m := range in.Members {
+		team.Members = append(team.Members, teamspec.Member{UserID: m.UserID, Username: m.Username, IsActive: m.IsActive})
+		listed[m.UserID] = true
+	}
+	if in.SLA != nil {
+		team.SLA = &teamspec.SLA{}
+		var err error
+		if team.SLA.FirstResponse, err = parseOptionalDuration(in.SLA.FirstResponse); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "sla.first_response: "+err.Error())
+			return
+		}
+		if team.SLA.Verdict, err = parseOptionalDuration(in.SLA.Verdict); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "sla.verdict: "+err.Error())
+			return
+		}
+	}
+	if err := (&teamspec.File{Teams: []teamspec.Team{team}}).Validate(); err != nil {
+		msg := strings.NewReplacer("teams[0].", "", "teams[0]: ", "", "\n", "; ").Replace(err.Error())
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", msg)
+		return
+	}
+
+	// teams.lead_user_id references users, so check the lead before the
+	// transaction turns it into a constraint violation.
+	if lead := in.LeadUserID; lead != nil && *lead != "" && !listed[*lead] {
+		if _, err := repos.GetUser(*lead); err != nil {
+			writeUserError(w, err)
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if _, err := repos.GetTeamByName(name); errors.Is(err, repo.ErrTeamNotFound) {
+		status = http.StatusCreated
+	} else if err != nil {
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+
+	if _, err := svcs.TeamSync.ApplyTeam(team, ifMatch(r)); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrVersionMismatch):
+			sendAPIError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", err.Error())
+		case errors.Is(err, repo.ErrTeamNotFound), errors.Is(err, repo.ErrUserNotFound):
+			sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		case errors.Is(err, repo.ErrFallbackCycle):
+			sendAPIError(w, http.StatusConflict, "FALLBACK_CYCLE", err.Error())
+		default:
+			sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		}
+		return
+	}
+	if status == http.StatusCreated {
+		w.Header().Set("Location", APIv1Prefix+"/teams/"+url.PathEscape(name))
+	}
+	writeTeam(w, r, repos, name, status)
+}
+
+// Deprecation of the RPC-style routes that /api/v1 replaces (RFC 9745).
+var legacyDeprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// legacyRoutes maps each deprecated route to its successor; {param} is filled
+// from the query parameter of the same name when the request carries it.
+var legacyRoutes = map[string]string{
+	"/team/add":             APIv1Prefix + "/teams/{team_name}",
+	"/team/get":             APIv1Prefix + "/teams/{team_name}",
+	"/users/get":            APIv1Prefix + "/users/{user_id}",
+	"/users/getReview":      APIv1Prefix + "/users/{user_id}/reviews",
+	"/pullRequest/create":   APIv1Prefix + "/pull-requests",
+	"/pullRequest/get":      APIv1Prefix + "/pull-requests/{pull_request_id}",
+	"/pullRequest/merge":    APIv1Prefix + "/pull-requests/{pull_request_id}/merge",
+	"/pullRequest/reassign": APIv1Prefix + "/pull-requests/{pull_request_id}/reassign",
+	"/pullRequest/review":   APIv1Prefix + "/pull-requests/{pull_request_id}/reviews",
+}
+
+// DeprecationMiddleware marks responses of the routes /api/v1 replaces with
+// a Deprecation header and, where the successor URL is known, a Link to it.
+// The routes keep working.
+func DeprecationMiddleware() func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", legacyDeprecation.Unix())
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			successor, ok := legacyRoutes[r.URL.Path]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Deprecation", deprecation)
+			if link, ok := successorURL(successor, r.URL.Query()); ok {
+				w.Header().Set("Link", "<"+link+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func successorURL(tmpl string, query url.Values) (string, bool) {
+	start := strings.IndexByte(tmpl, '{')
+	if start < 0 {
+		return tmpl, true
+	}
+	end := strings.IndexByte(tmpl, '}')
+	v := query.Get(tmpl[start+1 : end])
+	if v == "" {
+		return "", false
+	}
+	return tmpl[:start] + url.PathEscape(v) + tmpl[end+1:], true
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/models"
+)
+
+func TestTeamPutV1(t *testing.T) {
+	h, _ := newSeededRouter(t)
+
+	// The lead is checked before anything is written.
+	w := serve(h, "PUT", "/api/v1/teams/docs", `{"members":[{"user_id":"u5","username":"Eve"}],"lead_user_id":"ghost"}`)
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	require.Equal(t, "NOT_FOUND", decodeAPIError(t, w).Error.Code)
+	require.Equal(t, http.StatusNotFound, serve(h, "GET", "/api/v1/teams/docs", "").Code)
+
+	w = serve(h, "PUT", "/api/v1/teams/docs", `{"team_name":"docs","members":[{"user_id":"u5","username":"Eve"}],
+		"fallback_teams":["backend"],"lead_user_id":"u1","sla":{"first_response":"2h"}}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.Equal(t, "/api/v1/teams/docs", w.Header().Get("Location"))
+	var out struct {
+		Team models.TeamResp `json:"team"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	require.Len(t, out.Team.Members, 1)
+	require.Equal(t, "u1", out.Team.LeadUserID)
+	require.Equal(t, []string{"backend"}, out.Team.FallbackTeams)
+
+	w = serve(h, "PUT", "/api/v1/teams/docs", `{"members":[{"user_id":"u5","username":"Eve"},{"user_id":"u6","username":"Fay"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Empty(t, w.Header().Get("Location"))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	require.Len(t, out.Team.Members, 2)
+	require.Equal(t, "u1", out.Team.LeadUserID, "settings left out are kept")
+	tag := w.Header().Get("ETag")
+	require.NotEmpty(t, tag)
+
+	body := `{"members":[{"user_id":"u5","username":"Eve"}]}`
+	w = serveIfMatch(h, "PUT", "/api/v1/teams/docs", body, `"0"`)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code, w.Body.String())
+	require.Equal(t, "PRECONDITION_FAILED", decodeAPIError(t, w).Error.Code)
+	w = serveIfMatch(h, "PUT", "/api/v1/teams/docs", body, tag)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = serve(h, "PUT", "/api/v1/teams/backend", `{"members":[{"user_id":"u1","username":"Alice"},{"user_id":"u2","username":"Bob"},
+		{"user_id":"u3","username":"Carol"},{"user_id":"u4","username":"Dan"}],"fallback_teams":["docs"]}`)
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	require.Equal(t, "FALLBACK_CYCLE", decodeAPIError(t, w).Error.Code)
+}
+
+func TestPullRequestsV1(t *testing.T) {
+	h, r := newSeededRouter(t)
+
+	w := serve(h, "POST", "/api/v1/pull-requests", `{"pull_request_id":"pr-2","pull_request_name":"Fix login","author_id":"u2"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.Equal(t, "/api/v1/pull-requests/pr-2", w.Header().Get("Location"))
+	for body, code := range map[string]string{
+		`{"pull_request_id":"pr-2","pull_request_name":"Fix login","author_id":"u2"}`:    "PR_EXISTS",
+		`{"pull_request_id":"pr-3","pull_request_name":"Fix login","author_id":"ghost"}`: "NOT_FOUND",
+	} {
+		w = serve(h, "POST", "/api/v1/pull-requests", body)
+		require.Equal(t, code, decodeAPIError(t, w).Error.Code, body)
+		require.Empty(t, w.Header().Get("Location"), body)
+	}
+
+	before := prReviewers(t, r, "pr-1")
+	w = serve(h, "POST", "/api/v1/pull-requests/pr-1/reassign", `{"old_reviewer_id":"`+before[0]+`"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var reassigned struct {
+		PR         models.PullRequestResp `json:"pr"`
+		ReplacedBy string                 `json:"replaced_by"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reassigned))
+	require.NotContains(t, before, reassigned.ReplacedBy)
+	require.ElementsMatch(t, []string{before[1], reassigned.ReplacedBy}, reassigned.PR.AssignedReviewers)
+	after := prReviewers(t, r, "pr-1")
+
+	version, err := r.PRVersion("pr-1")
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name, path, body, tag string
+		status                int
+		code                  string
+	}{
+		{"reassign unassigned", "/pr-1/reassign", `{"old_reviewer_id":"` + before[0] + `"}`, "", http.StatusConflict, "NOT_ASSIGNED"},
+		{"reassign unknown", "/pr-9/reassign", `{"old_reviewer_id":"u2"}`, "", http.StatusNotFound, "NOT_FOUND"},
+		{"reassign stale", "/pr-1/reassign", `{"old_reviewer_id":"` + after[0] + `"}`, `"` + version + `0"`, http.StatusPreconditionFailed, "PRECONDITION_FAILED"},
+		{"review by author", "/pr-1/reviews", `{"reviewer_id":"u1","verdict":"APPROVED"}`, "", http.StatusConflict, "NOT_ASSIGNED"},
+		{"review stale", "/pr-1/reviews", `{"reviewer_id":"` + after[0] + `","verdict":"APPROVED"}`, `"` + version + `0"`, http.StatusPreconditionFailed, "PRECONDITION_FAILED"},
+		{"merge unapproved", "/pr-1/merge", "", "", http.StatusConflict, "NOT_APPROVED"},
+		{"merge unknown", "/pr-9/merge", "", "", http.StatusNotFound, "NOT_FOUND"},
+		{"merge stale", "/pr-1/merge", "", `"` + version + `0"`, http.StatusPreconditionFailed, "PRECONDITION_FAILED"},
+	} {
+		w = serveIfMatch(h, "POST", "/api/v1/pull-requests"+c.path, c.body, c.tag)
+		require.Equal(t, c.status, w.Code, "%s: %s", c.name, w.Body.String())
+		require.Equal(t, c.code, decodeAPIError(t, w).Error.Code, c.name)
+	}
+
+	w = serve(h, "POST", "/api/v1/pull-requests/pr-1/reviews", `{"reviewer_id":"`+after[0]+`","verdict":"APPROVED"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var reviewed struct {
+		PR models.PullRequestResp `json:"pr"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reviewed))
+	require.Len(t, reviewed.PR.Reviews, 1)
+
+	w = serve(h, "POST", "/api/v1/pull-requests/pr-1/merge", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var merged struct {
+		PR models.PullRequestResp `json:"pr"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &merged))
+	require.Equal(t, "MERGED", merged.PR.Status)
+	require.NotEmpty(t, w.Header().Get("ETag"))
+
+	w = serve(h, "POST", "/api/v1/pull-requests/pr-1/reviews", `{"reviewer_id":"`+after[0]+`","verdict":"COMMENTED"}`)
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	require.Equal(t, "PR_MERGED", decodeAPIError(t, w).Error.Code)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/services"
+)
+
+func TestDeprecationMiddleware(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(DeprecationMiddleware())
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/team/get", ok).Methods("GET")
+	r.HandleFunc("/pullRequest/merge", ok).Methods("POST")
+	r.HandleFunc("/team/setSLA", ok).Methods("POST")
+	r.HandleFunc("/api/v1/teams/{name}", ok).Methods("GET")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/team/get?team_name=back%2Fend", nil))
+	require.Equal(t, "@1792368000", w.Header().Get("Deprecation"))
+	require.Equal(t, `</api/v1/teams/back%2Fend>; rel="successor-version"`, w.Header().Get("Link"))
+
+	// The id is in the body, so the successor URL is unknown.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/pullRequest/merge", nil))
+	require.NotEmpty(t, w.Header().Get("Deprecation"))
+	require.Empty(t, w.Header().Get("Link"))
+
+	for _, c := range []struct{ method, target string }{
+		{"POST", "/team/setSLA"},
+		{"GET", "/api/v1/teams/backend"},
+	} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(c.method, c.target, nil))
+		require.Empty(t, w.Header().Get("Deprecation"), c.target)
+	}
+}
+
+// TestAPIv1Checks covers the v1 requests refused before the database is
+// needed.
+func TestAPIv1Checks(t *testing.T) {
+	h := newAPIRouter(t, nil, &services.Services{})
+	for _, c := range []struct {
+		name, method, path, body, message string
+	}{
+		{"team name mismatch", "PUT", "/api/v1/teams/backend", `{"team_name":"frontend","members":[]}`, "team_name does not match the URL"},
+		{"no members", "PUT", "/api/v1/teams/backend", `{"team_name":"backend"}`, "members"},
+		{"first response", "PUT", "/api/v1/teams/backend", `{"members":[],"sla":{"first_response":"soon"}}`, "sla.first_response: "},
+		{"verdict", "PUT", "/api/v1/teams/backend", `{"members":[],"sla":{"first_response":"4h","verdict":"-1h"}}`, "sla.verdict"},
+		{"duplicate member", "PUT", "/api/v1/teams/backend", `{"members":[{"user_id":"u1","username":"Alice"},{"user_id":"u1","username":"Alice"}]}`, "u1"},
+		{"create without author", "POST", "/api/v1/pull-requests", `{"pull_request_id":"pr-1","pull_request_name":"Add search"}`, "author_id"},
+		{"reassign without reviewer", "POST", "/api/v1/pull-requests/pr-1/reassign", `{}`, "old_reviewer_id"},
+		{"review without verdict", "POST", "/api/v1/pull-requests/pr-1/reviews", `{"reviewer_id":"u2"}`, "verdict"},
+		{"merge body", "POST", "/api/v1/pull-requests/pr-1/merge", `[`, ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			e := decodeAPIError(t, w)
+			require.Equal(t, "BAD_REQUEST", e.Error.Code)
+			require.Contains(t, e.Error.Message, c.message)
+			require.Empty(t, w.Header().Get("Location"))
+		})
+	}
+}
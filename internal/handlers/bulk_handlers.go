@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/bulk"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+)
+
+const maxImportBytes = 10 << 20
+
+func RegisterBulkRoutes(r *mux.Router, repos *repo.SQLRepo, svcs *services.Services) {
+	r.HandleFunc("/bulk/import", func(w http.ResponseWriter, r *http.Request) {
+		handleBulkImport(w, r, svcs)
+	}).Methods("POST")
+	r.HandleFunc("/bulk/export", func(w http.ResponseWriter, r *http.Request) {
+		handleBulkExport(w, r, svcs)
+	}).Methods("GET")
+}
+
+// handleBulkImport reads the file from the body. The format comes from the
+// format query parameter or the Content-Type, CSV by default.
+func handleBulkImport(w http.ResponseWriter, r *http.Request, svcs *services.Services) {
+	if !requireAdmin(w, r, "import") {
+		return
+	}
+	format, err := bulkFormat(r)
+	if err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid dry_run")
+			return
+		}
+	}
+
+	rows, err := bulk.Read(http.MaxBytesReader(w, r.Body, maxImportBytes), format)
+	var rowErrs bulk.Errors
+	if errors.As(err, &rowErrs) {
+		var e struct {
+			apiError
+			Rows bulk.Errors `json:"rows"`
+		}
+		e.Error.Code = "INVALID_IMPORT"
+		e.Error.Message = fmt.Sprintf("%d invalid rows, nothing imported", len(rowErrs))
+		e.Rows = rowErrs
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(e)
+		return
+	}
+	if err != nil {
+		sendAPIError(w, http.StatusBadRequest, "INVALID_IMPORT", err.Error())
+		return
+	}
+
+	summary, err := svcs.Bulk.Import(rows, dryRun)
+	if err != nil {
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"dry_run": dryRun, "summary": summary})
+}
+
+func handleBulkExport(w http.ResponseWriter, r *http.Request, svcs *services.Services) {
+	if !requireAdmin(w, r, "export") {
+		return
+	}
+	format, err := bulk.ParseFormat(r.URL.Query().Get("format"), "")
+	if err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+
+	rows, err := svcs.Bulk.Export()
+	if err != nil {
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+
+	if format == bulk.JSON {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="directory.%s"`, format))
+	_ = bulk.Write(w, format, rows)
+}
+
+func bulkFormat(r *http.Request) (bulk.Format, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		format = string(bulk.JSON)
+	}
+	return bulk.ParseFormat(format, "")
+}
+
+func requireAdmin(w http.ResponseWriter, r *http.Request, action string) bool {
+	if c, ok := auth.ClientFromContext(r.Context()); !ok || !c.Admin {
+		sendAPIError(w, http.StatusForbidden, "FORBIDDEN", action+" requires an admin token")
+		return false
+	}
+	return true
+}
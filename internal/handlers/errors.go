@@ -20,3 +20,9 @@ func sendAPIError(w http.ResponseWriter, httpStatus int, code, message string) {
 	w.WriteHeader(httpStatus)
 	_ = json.NewEncoder(w).Encode(e)
 }
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/example/prreview/internal/repo"
+)
+
+// etag quotes a stored version for the ETag header.
+func etag(version string) string {
+	return `"` + version + `"`
+}
+
+// ifMatch returns the versions listed in the request's If-Match header. "*"
+// matches any existing resource, which every write requires anyway, so it
+// makes the write unconditional. Weak tags are kept as they are and never
+// match: If-Match uses strong comparison.
+func ifMatch(r *http.Request) repo.IfMatch {
+	var m repo.IfMatch
+	for _, tag := range headerList(r.Header.Values("If-Match")) {
+		if tag == "*" {
+			return nil
+		}
+		if len(tag) >= 2 && tag[0] == '"' && tag[len(tag)-1] == '"' {
+			tag = tag[1 : len(tag)-1]
+		}
+		m = append(m, tag)
+	}
+	return m
+}
+
+// writeETag sets the ETag of the resource at version. For a GET whose
+// If-None-Match lists that version it also answers 304 and returns true.
+func writeETag(w http.ResponseWriter, r *http.Request, version string) bool {
+	w.Header().Set("ETag", etag(version))
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, tag := range headerList(r.Header.Values("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag(version) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func headerList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
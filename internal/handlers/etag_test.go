@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/repo"
+)
+
+func TestIfMatch(t *testing.T) {
+	for _, c := range []struct {
+		header []string
+		want   repo.IfMatch
+	}{
+		{nil, nil},
+		{[]string{"*"}, nil},
+		{[]string{`"3"`}, repo.IfMatch{"3"}},
+		{[]string{`"3", "4.10"`, `"5"`}, repo.IfMatch{"3", "4.10", "5"}},
+		{[]string{`W/"3"`}, repo.IfMatch{`W/"3"`}},
+	} {
+		r := httptest.NewRequest("POST", "/", nil)
+		for _, h := range c.header {
+			r.Header.Add("If-Match", h)
+		}
+		require.Equal(t, c.want, ifMatch(r), c.header)
+	}
+}
+
+func TestWriteETag(t *testing.T) {
+	for _, c := range []struct {
+		method, ifNoneMatch string
+		notModified         bool
+	}{
+		{"GET", "", false},
+		{"GET", `"2.7"`, true},
+		{"GET", `"1", W/"2.7"`, true},
+		{"GET", "*", true},
+		{"GET", `"2.6"`, false},
+		{"POST", `"2.7"`, false},
+	} {
+		r := httptest.NewRequest(c.method, "/", nil)
+		if c.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", c.ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		require.Equal(t, c.notModified, writeETag(w, r, "2.7"), c)
+		require.Equal(t, `"2.7"`, w.Header().Get("ETag"))
+		if c.notModified {
+			require.Equal(t, http.StatusNotModified, w.Code)
+		}
+	}
+}
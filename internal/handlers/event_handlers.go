@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/example/prreview/internal/events"
+	"github.com/example/prreview/internal/models"
+)
+
+func RegisterEventRoutes(r *mux.Router, broker *events.Broker, heartbeat time.Duration) {
+	r.HandleFunc("/events", makeEventsHandler(broker, heartbeat)).Methods("GET")
+}
+
+// makeEventsHandler streams PR events as Server-Sent Events, optionally
+// filtered by ?team= and ?user=. A client resuming with a Last-Event-ID
+// header (or ?last_event_id= for clients that cannot set headers) first gets
+// the buffered events it missed.
+func makeEventsHandler(broker *events.Broker, heartbeat time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := events.Filter{Team: q.Get("team"), User: q.Get("user")}
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = q.Get("last_event_id")
+		}
+
+		rc := http.NewResponseController(w)
+		// The stream outlives the server's write timeout.
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		sub, replay, resync := broker.Subscribe(filter, lastEventID)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if resync {
+			writeEvent(w, models.Event{Type: events.Resync})
+		}
+		for _, e := range replay {
+			writeEvent(w, e)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				_, _ = io.WriteString(w, ": ping\n\n")
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				writeEvent(w, e)
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes e in the text/event-stream format. A resync carries an
+// empty id so that the client forgets its Last-Event-ID and does not ask to
+// resume from it again.
+func writeEvent(w io.Writer, e models.Event) {
+	if e.Type == events.Resync {
+		_, _ = io.WriteString(w, "id:\nevent: "+events.Resync+"\ndata: {}\n\n")
+		return
+	}
+	data, _ := json.Marshal(e)
+	_, _ = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
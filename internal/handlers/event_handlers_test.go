@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/events"
+	"github.com/example/prreview/internal/models"
+)
+
+// readEvent reads one event from an SSE stream, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(fields) > 0 {
+				return fields
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		fields[name] = strings.TrimPrefix(value, " ")
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	broker := events.NewBroker(10)
+	broker.Publish(models.Event{ID: 1, Type: models.EventPRCreated, PullRequestID: "pr-1", TeamName: "backend"})
+	broker.Publish(models.Event{ID: 2, Type: models.EventPRCreated, PullRequestID: "pr-2", TeamName: "frontend"})
+	broker.Publish(models.Event{ID: 3, Type: models.EventPRMerged, PullRequestID: "pr-1", TeamName: "backend"})
+
+	r := mux.NewRouter()
+	RegisterEventRoutes(r, broker, 10*time.Millisecond)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/events?team=backend", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	body := bufio.NewReader(resp.Body)
+
+	e := readEvent(t, body)
+	require.Equal(t, "3", e["id"])
+	require.Equal(t, models.EventPRMerged, e["event"])
+	require.Contains(t, e["data"], `"pull_request_id":"pr-1"`)
+
+	broker.Publish(models.Event{ID: 4, Type: models.EventPRCreated, PullRequestID: "pr-3", TeamName: "frontend"})
+	broker.Publish(models.Event{ID: 5, Type: models.EventPRCreated, PullRequestID: "pr-4", TeamName: "backend"})
+	require.Equal(t, "5", readEvent(t, body)["id"])
+}
+
+func TestEventsStreamResync(t *testing.T) {
+	broker := events.NewBroker(10)
+	r := mux.NewRouter()
+	RegisterEventRoutes(r, broker, time.Minute)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?last_event_id=42")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	e := readEvent(t, bufio.NewReader(resp.Body))
+	require.Equal(t, events.Resync, e["event"])
+	require.Equal(t, "", e["id"])
+}
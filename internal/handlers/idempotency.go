@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/repo"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	maxIdempotencyKey = 255
+)
+
+// IdempotencyStore keeps idempotency keys and the responses recorded for them.
+// *repo.SQLRepo implements it on the idempotency_keys table.
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(client, key, requestHash string, ttl time.Duration) (bool, error)
+	GetIdempotencyKey(client, key string) (*repo.IdempotencyRecord, error)
+	CompleteIdempotencyKey(client, key string, status int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(client, key string) error
+}
+
+// IdempotencyMiddleware makes POST requests carrying an Idempotency-Key header
+// safe to retry. The first request with a key is executed and its response is
+// stored for ttl; replays with the same key and body get the stored response,
+// replays with a different body are rejected with 422.
+func IdempotencyMiddleware(store IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKey {
+				sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "failed to read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			var client string
+			if c, ok := auth.ClientFromContext(r.Context()); ok {
+				client = c.Name
+			}
+			hash := requestHash(r, body)
+
+			reserved, err := store.ReserveIdempotencyKey(client, key, hash, ttl)
+			if err != nil {
+				sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+				return
+			}
+			if !reserved {
+				replayIdempotent(w, store, client, key, hash)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError {
+				err = store.ReleaseIdempotencyKey(client, key)
+			} else {
+				err = store.CompleteIdempotencyKey(client, key, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+			}
+			if err != nil {
+				log.Printf("idempotency: store response for key %q: %v", key, err)
+			}
+		})
+	}
+}
+
+func replayIdempotent(w http.ResponseWriter, store IdempotencyStore, client, key, hash string) {
+	stored, err := store.GetIdempotencyKey(client, key)
+	if err != nil {
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	if stored != nil && stored.RequestHash != hash {
+		sendAPIError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", "Idempotency-Key was already used with a different request")
+		return
+	}
+	if stored == nil || !stored.StatusCode.Valid {
+		sendAPIError(w, http.StatusConflict, "IDEMPOTENCY_IN_PROGRESS", "a request with this Idempotency-Key is still being processed")
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(stored.StatusCode.Int64))
+	_, _ = w.Write(stored.Body)
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response through to the client while keeping a
+// copy of the status code and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if !rr.wroteHeader {
+		rr.status = code
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if !rr.wroteHeader {
+		rr.WriteHeader(http.StatusOK)
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
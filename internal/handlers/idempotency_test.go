@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/repo"
+)
+
+// memoryIdempotencyStore is an in-process IdempotencyStore; keys do not expire.
+type memoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]*repo.IdempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{keys: map[string]*repo.IdempotencyRecord{}}
+}
+
+func (s *memoryIdempotencyStore) ReserveIdempotencyKey(client, key, requestHash string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[client+"\x00"+key]; ok {
+		return false, nil
+	}
+	s.keys[client+"\x00"+key] = &repo.IdempotencyRecord{RequestHash: requestHash}
+	return true, nil
+}
+
+func (s *memoryIdempotencyStore) GetIdempotencyKey(client, key string) (*repo.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.keys[client+"\x00"+key]
+	if !ok {
+		return nil, nil
+	}
+	cp := *rec
+	return &cp, nil
+}
+
+func (s *memoryIdempotencyStore) CompleteIdempotencyKey(client, key string, status int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.keys[client+"\x00"+key]
+	rec.StatusCode = sql.NullInt64{Int64: int64(status), Valid: true}
+	rec.ContentType = contentType
+	rec.Body = append([]byte(nil), body...)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) ReleaseIdempotencyKey(client, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, client+"\x00"+key)
+	return nil
+}
+
+func postWithKey(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/pullRequest/create", strings.NewReader(body))
+	r.Header.Set(idempotencyHeader, key)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	calls := 0
+	h := IdempotencyMiddleware(newMemoryIdempotencyStore(), time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeJSON(w, http.StatusCreated, map[string]int{"n": calls})
+	}))
+
+	w := postWithKey(h, "k1", `{"a":1}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	w = postWithKey(h, "k1", `{"a":1}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.JSONEq(t, `{"n":1}`, w.Body.String())
+	require.Equal(t, 1, calls)
+
+	w = postWithKey(h, "k1", `{"a":2}`)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	require.Equal(t, "IDEMPOTENCY_KEY_REUSED", decodeAPIError(t, w).Error.Code)
+	require.Equal(t, 1, calls)
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	h := IdempotencyMiddleware(newMemoryIdempotencyStore(), time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postWithKey(h, "k1", `{}`) }()
+	<-started
+
+	w := postWithKey(h, "k1", `{}`)
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Equal(t, "IDEMPOTENCY_IN_PROGRESS", decodeAPIError(t, w).Error.Code)
+
+	close(release)
+	require.Equal(t, http.StatusOK, (<-done).Code)
+}
+
+func TestIdempotencyReleasesKeyOnServerError(t *testing.T) {
+	status := http.StatusInternalServerError
+	calls := 0
+	h := IdempotencyMiddleware(newMemoryIdempotencyStore(), time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+
+	require.Equal(t, http.StatusInternalServerError, postWithKey(h, "k1", `{}`).Code)
+	status = http.StatusOK
+	w := postWithKey(h, "k1", `{}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	require.Equal(t, 2, calls)
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/example/prreview/internal/auth"
 	"github.com/example/prreview/internal/models"
 	"github.com/example/prreview/internal/repo"
 	"github.com/example/prreview/internal/services"
@@ -14,73 +17,112 @@ func RegisterPRRoutes(r *mux.Router, repos *repo.SQLRepo, svcs *services.Service
 	r.HandleFunc("/pullRequest/create", makeCreatePRHandler(svcs)).Methods("POST")
 	r.HandleFunc("/pullRequest/merge", makeMergePRHandler(svcs)).Methods("POST")
 	r.HandleFunc("/pullRequest/reassign", makeReassignHandler(svcs)).Methods("POST")
+	r.HandleFunc("/pullRequest/review", makeSubmitReviewHandler(svcs)).Methods("POST")
+	r.HandleFunc("/pullRequest/get", func(w http.ResponseWriter, r *http.Request) {
+		handlePRGet(w, r, repos)
+	}).Methods("GET")
+	r.HandleFunc("/pullRequest/audit", func(w http.ResponseWriter, r *http.Request) {
+		handleAuditList(w, r, repos)
+	}).Methods("GET")
+}
+
+type createPRInput struct {
+	PullRequestID   string   `json:"pull_request_id"`
+	PullRequestName string   `json:"pull_request_name"`
+	AuthorID        string   `json:"author_id"`
+	TeamName        string   `json:"team_name"`
+	ChangedFiles    []string `json:"changed_files"`
 }
 
 func makeCreatePRHandler(svcs *services.Services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var in struct {
-			PullRequestID   string `json:"pull_request_id"`
-			PullRequestName string `json:"pull_request_name"`
-			AuthorID        string `json:"author_id"`
-		}
+		var in createPRInput
 		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
 			return
 		}
-		if in.PullRequestID == "" || in.PullRequestName == "" || in.AuthorID == "" {
-			http.Error(w, "pull_request_id, pull_request_name and author_id required", http.StatusBadRequest)
-			return
+		if pr, ok := createPR(w, svcs, in); ok {
+			writeJSON(w, http.StatusCreated, map[string]models.PullRequestResp{"pr": pr})
 		}
+	}
+}
 
-		pr, err := svcs.PR.CreatePR(in.PullRequestID, in.PullRequestName, in.AuthorID)
-		if err != nil {
-			if err == services.ErrPRExists {
-				sendAPIError(w, http.StatusConflict, "PR_EXISTS", "PR id already exists")
-				return
-			}
-			if err == services.ErrAuthorMissing {
-				sendAPIError(w, http.StatusNotFound, "NOT_FOUND", "author not found or has no team")
-				return
-			}
-			sendAPIError(w, http.StatusInternalServerError, "NOT_FOUND", err.Error())
-			return
-		}
+// createPR creates the PR and returns it as the API shows it. On failure the
+// error has already been written to w.
+func createPR(w http.ResponseWriter, svcs *services.Services, in createPRInput) (models.PullRequestResp, bool) {
+	if in.PullRequestID == "" || in.PullRequestName == "" || in.AuthorID == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id, pull_request_name and author_id required")
+		return models.PullRequestResp{}, false
+	}
 
-		resp := models.PullRequestResp{
-			PullRequestID:     pr["id"].(string),
-			PullRequestName:   pr["title"].(string),
-			AuthorID:          pr["author"].(string),
-			Status:            pr["status"].(string),
-			AssignedReviewers: pr["assigned_reviewers"].([]string),
-			Team_name:         pr["team_name"].(string),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		_ = json.NewEncoder(w).Encode(map[string]models.PullRequestResp{"pr": resp})
+	pr, err := svcs.PR.CreatePR(in.PullRequestID, in.PullRequestName, in.AuthorID, in.TeamName, in.ChangedFiles)
+	if err != nil {
+		writePRError(w, err)
+		return models.PullRequestResp{}, false
 	}
+
+	return models.PullRequestResp{
+		PullRequestID:     pr["id"].(string),
+		PullRequestName:   pr["title"].(string),
+		AuthorID:          pr["author"].(string),
+		Status:            pr["status"].(string),
+		AssignedReviewers: pr["assigned_reviewers"].([]string),
+		Team_name:         pr["team_name"].(string),
+		FallbackReviewers: pr["fallback_reviewers"].(map[string]string),
+	}, true
+}
+
+type mergeInput struct {
+	Force  bool   `json:"force"`
+	Reason string `json:"reason"`
 }
 
 func makeMergePRHandler(svcs *services.Services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var in struct {
 			PullRequestID string `json:"pull_request_id"`
+			mergeInput
 		}
 		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
 			return
 		}
 		if in.PullRequestID == "" {
-			http.Error(w, "pull_request_id required", http.StatusBadRequest)
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id required")
 			return
 		}
-		pr, err := svcs.PR.MergePR(in.PullRequestID)
-		if err != nil {
-			sendAPIError(w, http.StatusInternalServerError, "NOT_FOUND", err.Error())
+
+		pr, ok := mergePR(w, r, svcs, in.PullRequestID, in.mergeInput)
+		if !ok {
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{"pr": pr})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"pr": pr})
+	}
+}
+
+// mergePR merges the PR and returns the service's view of it. On failure the
+// error has already been written to w.
+func mergePR(w http.ResponseWriter, r *http.Request, svcs *services.Services, prID string, in mergeInput) (map[string]interface{}, bool) {
+	opts := services.MergeOptions{Force: in.Force, Reason: in.Reason, IfMatch: ifMatch(r)}
+	if in.Force {
+		client, ok := auth.ClientFromContext(r.Context())
+		if !ok || !client.Admin {
+			sendAPIError(w, http.StatusForbidden, "FORBIDDEN", "force merge requires an admin token")
+			return nil, false
+		}
+		if in.Reason == "" {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "reason required for force merge")
+			return nil, false
+		}
+		opts.Actor = client.Name
 	}
+
+	pr, err := svcs.PR.MergePR(prID, opts)
+	if err != nil {
+		writePRError(w, err)
+		return nil, false
+	}
+	return pr, true
 }
 
 func makeReassignHandler(svcs *services.Services) http.HandlerFunc {
@@ -90,20 +132,123 @@ func makeReassignHandler(svcs *services.Services) http.HandlerFunc {
 			OldUserID     string `json:"old_reviewer_id"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
 			return
 		}
 		if in.PullRequestID == "" || in.OldUserID == "" {
-			http.Error(w, "pull_request_id and old_reviewer_id required", http.StatusBadRequest)
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id and old_reviewer_id required")
 			return
 		}
-		newID, pr, err := svcs.PR.Reassign(in.PullRequestID, in.OldUserID)
+		newID, pr, err := svcs.PR.Reassign(in.PullRequestID, in.OldUserID, ifMatch(r))
 		if err != nil {
-			sendAPIError(w, http.StatusConflict, "ERROR", err.Error())
+			writePRError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"pr": pr, "replaced_by": newID})
+	}
+}
+
+type reviewInput struct {
+	ReviewerID string `json:"reviewer_id"`
+	Verdict    string `json:"verdict"`
+	Comment    string `json:"comment"`
+}
+
+func makeSubmitReviewHandler(svcs *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			PullRequestID string `json:"pull_request_id"`
+			reviewInput
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
 			return
 		}
-		out := map[string]interface{}{"pr": pr, "replaced_by": newID}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(out)
+		if in.PullRequestID == "" {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id, reviewer_id and verdict required")
+			return
+		}
+		submitReview(w, r, svcs, in.PullRequestID, in.reviewInput)
+	}
+}
+
+func submitReview(w http.ResponseWriter, r *http.Request, svcs *services.Services, prID string, in reviewInput) {
+	if in.ReviewerID == "" || in.Verdict == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id, reviewer_id and verdict required")
+		return
+	}
+
+	pr, err := svcs.PR.SubmitReview(prID, in.ReviewerID, in.Verdict, in.Comment, ifMatch(r))
+	if err != nil {
+		writePRError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]*models.PullRequestResp{"pr": pr})
+}
+
+func handlePRGet(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	prID := r.URL.Query().Get("pull_request_id")
+	if prID == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "pull_request_id required")
+		return
+	}
+	writePR(w, r, repos, prID)
+}
+
+// writePR responds with the PR as /pullRequest/get does, with its ETag.
+func writePR(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, prID string) {
+	version, err := repos.PRVersion(prID)
+	if err != nil {
+		writePRError(w, err)
+		return
+	}
+	if writeETag(w, r, version) {
+		return
+	}
+	pr, err := repos.GetPR(prID)
+	if err != nil {
+		writePRError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]*models.PullRequestResp{"pr": pr})
+}
+
+func handleAuditList(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	prID := r.URL.Query().Get("pull_request_id")
+	entries, err := repos.ListAudit(prID)
+	if err != nil {
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string][]models.AuditEntryResp{"entries": entries})
+}
+
+func writePRError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, repo.ErrPRNotFound):
+		sendAPIError(w, http.StatusNotFound, "NOT_FOUND", repo.ErrPRNotFound.Error())
+	case errors.Is(err, services.ErrAuthorMissing), errors.Is(err, services.ErrNotTeamMember):
+		sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, services.ErrPRExists):
+		sendAPIError(w, http.StatusConflict, "PR_EXISTS", "PR id already exists")
+	case errors.Is(err, services.ErrAmbiguousTeam):
+		sendAPIError(w, http.StatusBadRequest, "AMBIGUOUS_TEAM", err.Error())
+	case errors.Is(err, services.ErrInvalidVerdict):
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+	case errors.Is(err, repo.ErrTeamArchived):
+		sendAPIError(w, http.StatusConflict, "TEAM_ARCHIVED", err.Error())
+	case errors.Is(err, services.ErrPRMerged):
+		sendAPIError(w, http.StatusConflict, "PR_MERGED", "PR is already merged")
+	case errors.Is(err, services.ErrNotAssigned):
+		sendAPIError(w, http.StatusConflict, "NOT_ASSIGNED", "reviewer is not assigned to this PR")
+	case errors.Is(err, services.ErrNoCandidate):
+		sendAPIError(w, http.StatusConflict, "NO_CANDIDATE", "no active replacement candidate in team")
+	case errors.Is(err, services.ErrNotApproved):
+		sendAPIError(w, http.StatusConflict, "NOT_APPROVED", err.Error())
+	case errors.Is(err, repo.ErrVersionMismatch):
+		sendAPIError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", err.Error())
+	default:
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
 	}
 }
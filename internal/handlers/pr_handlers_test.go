@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/services"
+)
+
+// TestForceMergeChecks covers the checks made before the merge reaches the
+// service, so no services are needed.
+func TestForceMergeChecks(t *testing.T) {
+	h := newAPIRouter(t, nil, &services.Services{})
+	for _, c := range []struct {
+		name   string
+		client *auth.Client
+		body   string
+		status int
+		code   string
+	}{
+		{"no token", nil, `{"pull_request_id":"pr-1","force":true,"reason":"hotfix"}`, http.StatusForbidden, "FORBIDDEN"},
+		{"not admin", &auth.Client{Name: "ci"}, `{"pull_request_id":"pr-1","force":true,"reason":"hotfix"}`, http.StatusForbidden, "FORBIDDEN"},
+		{"no reason", &auth.Client{Name: "ops", Admin: true}, `{"pull_request_id":"pr-1","force":true}`, http.StatusBadRequest, "BAD_REQUEST"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/pullRequest/merge", strings.NewReader(c.body))
+			if c.client != nil {
+				r = r.WithContext(auth.WithClient(r.Context(), *c.client))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, c.status, w.Code)
+			require.Equal(t, c.code, decodeAPIError(t, w).Error.Code)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/ratelimit"
+)
+
+type rateLimitGroup struct {
+	name     string
+	prefixes []string
+	rule     ratelimit.Rule
+}
+
+// RateLimitMiddleware applies the configured token-bucket limits and reports
+// them with RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// If the limiter itself fails the request is let through.
+func RateLimitMiddleware(l ratelimit.Limiter, cfg config.RateLimitConfig) func(http.Handler) http.Handler {
+	groups := make([]rateLimitGroup, 0, len(cfg.Groups)+1)
+	for _, g := range cfg.Groups {
+		groups = append(groups, rateLimitGroup{name: g.Name, prefixes: g.Prefixes, rule: ratelimit.FromConfig(g.RateLimitRule)})
+	}
+	def := rateLimitGroup{name: "default", rule: ratelimit.FromConfig(cfg.Default)}
+
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/docs/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			g := def
+			for _, candidate := range groups {
+				if hasAnyPrefix(r.URL.Path, candidate.prefixes) {
+					g = candidate
+					break
+				}
+			}
+
+			res, err := l.Allow(g.name+"|"+rateLimitIdentity(r, cfg.TrustProxy), g.rule)
+			if err != nil {
+				log.Printf("rate limit: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d;policy=%q", g.rule.Requests, int(g.rule.Per.Seconds()), g.rule.Burst, g.name))
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				sendAPIError(w, http.StatusTooManyRequests, "RATE_LIMITED", "rate limit exceeded for "+g.name+", retry later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitIdentity(r *http.Request, trustProxy bool) string {
+	if c, ok := auth.ClientFromContext(r.Context()); ok {
+		return "client:" + c.Name
+	}
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return "ip:" + strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
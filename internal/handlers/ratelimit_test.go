@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/ratelimit"
+)
+
+func TestRateLimitGroups(t *testing.T) {
+	cfg := config.Default().RateLimit
+	cfg.Enabled = true
+	h := RateLimitMiddleware(ratelimit.NewMemory(), cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for path, group := range map[string]string{
+		"/pullRequest/create":              "pr-write",
+		"/api/v1/pull-requests":            "pr-write",
+		"/api/v1/pull-requests/pr-1/merge": "pr-write",
+		"/team/add":                        "default",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		require.Contains(t, w.Header().Get("RateLimit-Policy"), `policy="`+group+`"`, path)
+	}
+}
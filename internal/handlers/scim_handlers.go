@@ -0,0 +1,744 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+)
+
+// SCIM 2.0 (RFC 7643, 7644) provisioning. Users map to users: the SCIM id is
+// user_id, userName is username and active is is_active. Groups map to teams:
+// id and displayName are both the team name.
+
+const (
+	scimUserSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimUser struct {
+	Schemas    []string    `json:"schemas"`
+	ID         string      `json:"id,omitempty"`
+	ExternalID string      `json:"externalId,omitempty"`
+	UserName   string      `json:"userName"`
+	Active     *bool       `json:"active,omitempty"`
+	Emails     []scimEmail `json:"emails,omitempty"`
+	Groups     []scimRef   `json:"groups,omitempty"`
+	Meta       *scimMeta   `json:"meta,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string  `json:"schemas"`
+	ID          string    `json:"id,omitempty"`
+	DisplayName string    `json:"displayName"`
+	Members     []scimRef `json:"members,omitempty"`
+	Meta        *scimMeta `json:"meta,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type scimPatchOp struct {
+	Operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	} `json:"Operations"`
+}
+
+// scimError is a request problem reported with a SCIM error type.
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimError) Error() string { return e.detail }
+
+func scimBadRequest(scimType, format string, args ...interface{}) error {
+	return &scimError{http.StatusBadRequest, scimType, fmt.Sprintf(format, args...)}
+}
+
+func RegisterSCIMRoutes(r *mux.Router, repos *repo.SQLRepo, svcs *services.Services) {
+	s := r.PathPrefix("/scim/v2").Subrouter()
+	s.Use(requireSCIMAdmin)
+
+	s.HandleFunc("/ServiceProviderConfig", handleSCIMConfig).Methods("GET")
+
+	s.HandleFunc("/Users", func(w http.ResponseWriter, r *http.Request) {
+		handleSCIMListUsers(w, r, repos)
+	}).Methods("GET")
+	s.HandleFunc("/Users", func(w http.ResponseWriter, r *http.Request) {
+		handleSCIMCreateUser(w, r, repos)
+	}).Methods("POST")
+	s.HandleFunc("/Users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		version, err := repos.UserVersion(mux.Vars(r)["id"])
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		user, err := repos.GetUser(mux.Vars(r)["id"])
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		if writeETag(w, r, version) {
+			return
+		}
+		writeSCIM(w, http.StatusOK, toSCIMUser(r, user))
+	}).Methods("GET")
+	s.HandleFunc("/Users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleSCIMReplaceUser(w, r, svcs)
+	}).Methods("PUT")
+	s.HandleFunc("/Users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleSCIMPatchUser(w, r, svcs)
+	}).Methods("PATCH")
+	s.HandleFunc("/Users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := svcs.Users.Delete(mux.Vars(r)["id"], ifMatch(r)); err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+
+	s.HandleFunc("/Groups", func(w http.ResponseWriter, r *http.Request) {
+		handleSCIMListGroups(w, r, repos)
+	}).Methods("GET")
+	s.HandleFunc("/Groups", func(w http.ResponseWriter, r *http.Request) {
+		handleSCIMCreateGroup(w, r, repos, svcs)
+	}).Methods("POST")
+	s.HandleFunc("/Groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeSCIMGroup(w, r, repos, mux.Vars(r)["id"], http.StatusOK)
+	}).Methods("GET")
+	s.HandleFunc("/Groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleSCIMReplaceGroup(w, r, repos, svcs)
+	}).Methods("PUT")
+	s.HandleFunc("/Groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleSCIMPatchGroup(w, r, repos, svcs)
+	}).Methods("PATCH")
+	s.HandleFunc("/Groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := svcs.Teams.Delete(mux.Vars(r)["id"], "", actorName(r), ifMatch(r)); err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+}
+
+// requireSCIMAdmin lets only admin clients provision users and teams.
+func requireSCIMAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := auth.ClientFromContext(r.Context()); !ok || !c.Admin {
+			writeSCIMError(w, &scimError{status: http.StatusForbidden, detail: "SCIM requires an admin token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func handleSCIMConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(v bool) map[string]bool { return map[string]bool{"supported": v} }
+	writeSCIM(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(true),
+		"authenticationSchemes": []map[string]string{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "API token of an admin client",
+		}},
+	})
+}
+
+// --- Users ---
+
+func handleSCIMListUsers(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	start, count, err := scimPage(r)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	var f repo.UserFilter
+	if filter := r.URL.Query().Get("filter"); filter != "" {
+		attr, value, err := parseSCIMFilter(filter)
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		switch attr {
+		case "id", "externalid":
+			f.UserID = value
+		case "username":
+			f.Username = value
+		case "emails", "emails.value":
+			f.Email = value
+		default:
+			writeSCIMError(w, scimBadRequest("invalidFilter", "filtering by %s is not supported", attr))
+			return
+		}
+	}
+
+	users, total, err := repos.ListUsers(f, start-1, count)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	resources := make([]scimUser, 0, len(users))
+	for i := range users {
+		resources = append(resources, toSCIMUser(r, &users[i]))
+	}
+	writeSCIM(w, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// handleSCIMCreateUser takes the user_id from externalId, or from userName
+// when the provider sends no externalId.
+func handleSCIMCreateUser(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var in scimUser
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, scimBadRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+	if in.UserName == "" {
+		writeSCIMError(w, scimBadRequest("invalidValue", "userName is required"))
+		return
+	}
+	id := in.ExternalID
+	if id == "" {
+		id = in.UserName
+	}
+
+	user, err := repos.CreateUser(models.UserResp{
+		UserID:   id,
+		Username: in.UserName,
+		IsActive: in.Active == nil || *in.Active,
+		Email:    primaryEmail(in.Emails),
+	})
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, http.StatusCreated, toSCIMUser(r, user))
+}
+
+func handleSCIMReplaceUser(w http.ResponseWriter, r *http.Request, svcs *services.Services) {
+	var in scimUser
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, scimBadRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+	if in.UserName == "" {
+		writeSCIMError(w, scimBadRequest("invalidValue", "userName is required"))
+		return
+	}
+	email := primaryEmail(in.Emails)
+
+	upd := repo.UserUpdate{Username: &in.UserName, Email: &email, IfMatch: ifMatch(r)}
+	user, _, err := svcs.Users.Update(mux.Vars(r)["id"], upd, in.Active)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, toSCIMUser(r, user))
+}
+
+// handleSCIMPatchUser supports active, userName and emails; other attributes
+// are not stored and are ignored.
+func handleSCIMPatchUser(w http.ResponseWriter, r *http.Request, svcs *services.Services) {
+	var in scimPatchOp
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, scimBadRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+
+	upd := repo.UserUpdate{IfMatch: ifMatch(r)}
+	var active *bool
+	set := func(path string, value json.RawMessage, remove bool) error {
+		attr := strings.ToLower(path)
+		switch {
+		case attr == "active":
+			if remove {
+				return scimBadRequest("mutability", "active cannot be removed")
+			}
+			v, err := parseSCIMBool(value)
+			if err != nil {
+				return err
+			}
+			active = &v
+		case attr == "username":
+			var v string
+			if remove || json.Unmarshal(value, &v) != nil || v == "" {
+				return scimBadRequest("invalidValue", "userName must be a non-empty string")
+			}
+			upd.Username = &v
+		case strings.HasPrefix(attr, "emails"):
+			v := ""
+			if !remove {
+				var err error
+				if v, err = parseSCIMEmail(value); err != nil {
+					return err
+				}
+			}
+			upd.Email = &v
+		}
+		return nil
+	}
+
+	for _, op := range in.Operations {
+		remove := false
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+		case "remove":
+			remove = true
+		default:
+			writeSCIMError(w, scimBadRequest("invalidSyntax", "unknown op %q", op.Op))
+			return
+		}
+		if op.Path != "" {
+			if err := set(op.Path, op.Value, remove); err != nil {
+				writeSCIMError(w, err)
+				return
+			}
+			continue
+		}
+
+		var attrs map[string]json.RawMessage
+		if remove || json.Unmarshal(op.Value, &attrs) != nil {
+			writeSCIMError(w, scimBadRequest("noTarget", "an operation without path needs an object value"))
+			return
+		}
+		for _, name := range sortedKeys(attrs) {
+			if err := set(name, attrs[name], false); err != nil {
+				writeSCIMError(w, err)
+				return
+			}
+		}
+	}
+
+	user, _, err := svcs.Users.Update(mux.Vars(r)["id"], upd, active)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, toSCIMUser(r, user))
+}
+
+func toSCIMUser(r *http.Request, u *models.UserResp) scimUser {
+	active := u.IsActive
+	out := scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       u.UserID,
+		UserName: u.Username,
+		Active:   &active,
+		Meta:     &scimMeta{ResourceType: "User", Location: scimLocation(r, "Users", u.UserID)},
+	}
+	if u.Email != "" {
+		out.Emails = []scimEmail{{Value: u.Email, Type: "work", Primary: true}}
+	}
+	for _, t := range u.Teams {
+		out.Groups = append(out.Groups, scimRef{Value: t, Display: t})
+	}
+	return out
+}
+
+func primaryEmail(emails []scimEmail) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+// parseSCIMEmail accepts a plain address or a list of email objects.
+func parseSCIMEmail(value json.RawMessage) (string, error) {
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		return s, nil
+	}
+	var list []scimEmail
+	if json.Unmarshal(value, &list) == nil {
+		return primaryEmail(list), nil
+	}
+	return "", scimBadRequest("invalidValue", "emails must be a string or a list of emails")
+}
+
+// parseSCIMBool also accepts "True" and "False", which some providers send.
+func parseSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if json.Unmarshal(value, &b) == nil {
+		return b, nil
+	}
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, scimBadRequest("invalidValue", "active must be a boolean")
+}
+
+// --- Groups ---
+
+func handleSCIMListGroups(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	start, count, err := scimPage(r)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	var name string
+	if filter := r.URL.Query().Get("filter"); filter != "" {
+		attr, value, err := parseSCIMFilter(filter)
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		if attr != "id" && attr != "displayname" {
+			writeSCIMError(w, scimBadRequest("invalidFilter", "filtering by %s is not supported", attr))
+			return
+		}
+		name = value
+	}
+
+	names, total, err := repos.ListTeamNames(name, start-1, count)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	withMembers := !strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members")
+	resources := make([]scimGroup, 0, len(names))
+	for _, n := range names {
+		team, err := repos.GetTeamByName(n)
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		g := toSCIMGroup(r, team)
+		if !withMembers {
+			g.Members = nil
+		}
+		resources = append(resources, g)
+	}
+	writeSCIM(w, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimListSchema},
+		TotalResults: total,
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func handleSCIMCreateGroup(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, svcs *services.Services) {
+	var in scimGroup
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, scimBadRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+	if in.DisplayName == "" {
+		writeSCIMError(w, scimBadRequest("invalidValue", "displayName is required"))
+		return
+	}
+	if err := svcs.Teams.Create(in.DisplayName, refValues(in.Members)); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIMGroup(w, r, repos, in.DisplayName, http.StatusCreated)
+}
+
+func handleSCIMReplaceGroup(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, svcs *services.Services) {
+	team := mux.Vars(r)["id"]
+	var in scimGroup
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, scimBadRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+	if err := checkGroupName(team, in.DisplayName); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	members := refValues(in.Members)
+	if err := svcs.Teams.ChangeMembers(team, ifMatch(r), func([]string) ([]string, error) { return members, nil }); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIMGroup(w, r, repos, team, http.StatusOK)
+}
+
+var scimMemberPath = regexp.MustCompile(`(?i)^members\[value\s+eq\s+"([^"]*)"\]$`)
+
+// handleSCIMPatchGroup changes members and accepts an unchanged displayName;
+// teams cannot be renamed.
+func handleSCIMPatchGroup(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, svcs *services.Services) {
+	team := mux.Vars(r)["id"]
+	var in scimPatchOp
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, scimBadRequest("invalidSyntax", "invalid request body"))
+		return
+	}
+
+	err := svcs.Teams.ChangeMembers(team, ifMatch(r), func(current []string) ([]string, error) {
+		members := map[string]bool{}
+		for _, id := range current {
+			members[id] = true
+		}
+		apply := func(op, path string, value json.RawMessage) error {
+			attr := strings.ToLower(path)
+			if m := scimMemberPath.FindStringSubmatch(path); m != nil {
+				if op != "remove" {
+					return scimBadRequest("invalidPath", "only remove is supported for %s", path)
+				}
+				delete(members, m[1])
+				return nil
+			}
+			switch attr {
+			case "displayname":
+				var name string
+				if op == "remove" || json.Unmarshal(value, &name) != nil {
+					return scimBadRequest("invalidValue", "displayName must be a string")
+				}
+				return checkGroupName(team, name)
+			case "members":
+				var refs []scimRef
+				if len(value) > 0 && json.Unmarshal(value, &refs) != nil {
+					return scimBadRequest("invalidValue", "members must be a list")
+				}
+				switch op {
+				case "replace":
+					members = map[string]bool{}
+					fallthrough
+				case "add":
+					for _, ref := range refs {
+						members[ref.Value] = true
+					}
+				case "remove":
+					if len(refs) == 0 {
+						members = map[string]bool{}
+					}
+					for _, ref := range refs {
+						delete(members, ref.Value)
+					}
+				}
+				return nil
+			case "externalid":
+				return nil
+			}
+			return scimBadRequest("invalidPath", "unsupported path %q", path)
+		}
+
+		for _, op := range in.Operations {
+			name := strings.ToLower(op.Op)
+			if name != "add" && name != "replace" && name != "remove" {
+				return nil, scimBadRequest("invalidSyntax", "unknown op %q", op.Op)
+			}
+			if op.Path != "" {
+				if err := apply(name, op.Path, op.Value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			var attrs map[string]json.RawMessage
+			if name == "remove" || json.Unmarshal(op.Value, &attrs) != nil {
+				return nil, scimBadRequest("noTarget", "an operation without path needs an object value")
+			}
+			for _, key := range sortedKeys(attrs) {
+				if err := apply(name, key, attrs[key]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return sortedKeys(members), nil
+	})
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIMGroup(w, r, repos, team, http.StatusOK)
+}
+
+func checkGroupName(team, name string) error {
+	if name != "" && name != team {
+		return scimBadRequest("mutability", "teams cannot be renamed")
+	}
+	return nil
+}
+
+func writeSCIMGroup(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, team string, status int) {
+	version, err := repos.TeamVersion(team)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	t, err := repos.GetTeamByName(team)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	if writeETag(w, r, version) {
+		return
+	}
+	writeSCIM(w, status, toSCIMGroup(r, t))
+}
+
+func toSCIMGroup(r *http.Request, t *models.TeamResp) scimGroup {
+	g := scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          t.TeamName,
+		DisplayName: t.TeamName,
+		Meta:        &scimMeta{ResourceType: "Group", Location: scimLocation(r, "Groups", t.TeamName)},
+	}
+	for _, m := range t.Members {
+		g.Members = append(g.Members, scimRef{Value: m.UserID, Display: m.Username})
+	}
+	return g
+}
+
+func refValues(refs []scimRef) []string {
+	out := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		out = append(out, ref.Value)
+	}
+	return out
+}
+
+// --- Protocol helpers ---
+
+var scimFilterRe = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9.]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// parseSCIMFilter supports the single `attribute eq "value"` form identity
+// providers use to look resources up. The attribute is returned lower case.
+func parseSCIMFilter(filter string) (attr, value string, err error) {
+	m := scimFilterRe.FindStringSubmatch(filter)
+	if m == nil {
+		return "", "", scimBadRequest("invalidFilter", `only 'attribute eq "value"' filters are supported`)
+	}
+	if err := json.Unmarshal([]byte(m[2]), &value); err != nil {
+		return "", "", scimBadRequest("invalidFilter", "invalid filter value %s", m[2])
+	}
+	return strings.ToLower(m[1]), value, nil
+}
+
+// scimPage reads the 1-based startIndex and count query parameters.
+func scimPage(r *http.Request) (start, count int, err error) {
+	start, count = 1, scimDefaultCount
+	q := r.URL.Query()
+	if v := q.Get("startIndex"); v != "" {
+		if start, err = strconv.Atoi(v); err != nil {
+			return 0, 0, scimBadRequest("invalidValue", "invalid startIndex")
+		}
+		if start < 1 {
+			start = 1
+		}
+	}
+	if v := q.Get("count"); v != "" {
+		if count, err = strconv.Atoi(v); err != nil {
+			return 0, 0, scimBadRequest("invalidValue", "invalid count")
+		}
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return start, count, nil
+}
+
+func scimLocation(r *http.Request, resource, id string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/scim/v2/%s/%s", scheme, r.Host, resource, id)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeSCIM(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeSCIMError(w http.ResponseWriter, err error) {
+	e := &scimError{status: http.StatusInternalServerError, detail: err.Error()}
+	var se *scimError
+	switch {
+	case errors.As(err, &se):
+		e = se
+	case errors.Is(err, repo.ErrUserNotFound), errors.Is(err, repo.ErrTeamNotFound):
+		e.status = http.StatusNotFound
+	case errors.Is(err, repo.ErrUserExists), errors.Is(err, repo.ErrTeamExists):
+		e.status, e.scimType = http.StatusConflict, "uniqueness"
+	case errors.Is(err, services.ErrUserHasPRs), errors.Is(err, services.ErrTeamHasOpenPRs):
+		e.status = http.StatusConflict
+	case errors.Is(err, repo.ErrVersionMismatch):
+		e.status = http.StatusPreconditionFailed
+	}
+
+	body := map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(e.status),
+		"detail":  e.detail,
+	}
+	if e.scimType != "" {
+		body["scimType"] = e.scimType
+	}
+	writeSCIM(w, e.status, body)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSCIMFilter(t *testing.T) {
+	attr, value, err := parseSCIMFilter(`userName eq "alice@example.com"`)
+	require.NoError(t, err)
+	require.Equal(t, "username", attr)
+	require.Equal(t, "alice@example.com", value)
+
+	attr, value, err = parseSCIMFilter(` displayName EQ "back \"end\"" `)
+	require.NoError(t, err)
+	require.Equal(t, "displayname", attr)
+	require.Equal(t, `back "end"`, value)
+
+	for _, filter := range []string{`userName co "a"`, `userName eq a`, `userName eq "a" and active eq true`} {
+		_, _, err := parseSCIMFilter(filter)
+		var se *scimError
+		require.ErrorAs(t, err, &se, filter)
+		require.Equal(t, "invalidFilter", se.scimType)
+	}
+}
+
+func TestSCIMPage(t *testing.T) {
+	start, count, err := scimPage(httptest.NewRequest("GET", "/scim/v2/Users", nil))
+	require.NoError(t, err)
+	require.Equal(t, [2]int{1, scimDefaultCount}, [2]int{start, count})
+
+	start, count, err = scimPage(httptest.NewRequest("GET", "/scim/v2/Users?startIndex=0&count=1000", nil))
+	require.NoError(t, err)
+	require.Equal(t, [2]int{1, scimMaxCount}, [2]int{start, count})
+
+	_, _, err = scimPage(httptest.NewRequest("GET", "/scim/v2/Users?count=x", nil))
+	require.Error(t, err)
+}
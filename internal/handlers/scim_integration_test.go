@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	"github.com/example/prreview/internal/testdb"
+)
+
+// newTestRepo migrates a fresh database; see internal/testdb.
+func newTestRepo(t *testing.T) *repo.SQLRepo {
+	return repo.NewSQLRepo(testdb.New(t, repo.RunMigrations).DB)
+}
+
+// newSeededRouter serves the API routes to an admin client
+// over a team of four and one PR authored by u1.
+func newSeededRouter(t *testing.T) (http.Handler, *repo.SQLRepo) {
+	t.Helper()
+	r := newTestRepo(t)
+	svcs := services.NewServices(r, config.ReviewersConfig{PerPR: 2, RequiredApprovals: 1}, config.Default().SLA, config.EmailConfig{})
+	_, err := r.CreateTeam("backend", []models.TeamMemberResp{
+		{UserID: "u1", Username: "Alice", IsActive: true},
+		{UserID: "u2", Username: "Bob", IsActive: true},
+		{UserID: "u3", Username: "Carol", IsActive: true},
+		{UserID: "u4", Username: "Dan", IsActive: true},
+	})
+	require.NoError(t, err)
+	_, err = svcs.PR.CreatePR("pr-1", "Add search", "u1", "", nil)
+	require.NoError(t, err)
+
+	router := newAPIRouter(t, r, svcs)
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		router.ServeHTTP(w, req.WithContext(auth.WithClient(req.Context(), auth.Client{Name: "idp", Admin: true})))
+	})
+	return h, r
+}
+
+func serve(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	return serveIfMatch(h, method, path, body, "")
+}
+
+func serveIfMatch(h http.Handler, method, path, body, tag string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if tag != "" {
+		r.Header.Set("If-Match", tag)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func prReviewers(t *testing.T, r *repo.SQLRepo, prID string) []string {
+	t.Helper()
+	pr, err := r.GetPR(prID)
+	require.NoError(t, err)
+	ids := append([]string(nil), pr.AssignedReviewers...)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestSCIMUserLifecycle(t *testing.T) {
+	h, r := newSeededRouter(t)
+
+	w := serve(h, "POST", "/scim/v2/Users", `{"schemas":["`+scimUserSchema+`"],"externalId":"u5","userName":"Eve",
+		"emails":[{"value":"eve@example.com","primary":true}]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created scimUser
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Equal(t, "u5", created.ID)
+	require.True(t, *created.Active)
+	user, err := r.GetUser("u5")
+	require.NoError(t, err)
+	require.Equal(t, "Eve", user.Username)
+	require.Equal(t, "eve@example.com", user.Email)
+
+	w = serve(h, "POST", "/scim/v2/Users", `{"userName":"Eve","externalId":"u5"}`)
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	// Deactivation hands the user's open review to the one team member left.
+	before := prReviewers(t, r, "pr-1")
+	gone := before[0]
+	w = serve(h, "PATCH", "/scim/v2/Users/"+gone, `{"Operations":[{"op":"replace","path":"active","value":false}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var patched scimUser
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &patched))
+	require.False(t, *patched.Active)
+	after := prReviewers(t, r, "pr-1")
+	require.NotContains(t, after, gone)
+	require.Contains(t, after, before[1])
+	require.Len(t, after, 2)
+
+	w = serve(h, "DELETE", "/scim/v2/Users/u5", "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, http.StatusNotFound, serve(h, "GET", "/scim/v2/Users/u5", "").Code)
+	require.Equal(t, http.StatusNotFound, serve(h, "DELETE", "/scim/v2/Users/u5", "").Code)
+
+	// Authors can only be deactivated.
+	w = serve(h, "DELETE", "/scim/v2/Users/u1", "")
+	require.Equal(t, http.StatusConflict, w.Code)
+}
+
+// TestSetIsActiveHandsOffReviews checks that the REST toggle reassigns the
+// way SCIM deactivation does.
+func TestSetIsActiveHandsOffReviews(t *testing.T) {
+	h, r := newSeededRouter(t)
+	before := prReviewers(t, r, "pr-1")
+	spare := "u2"
+	for _, id := range []string{"u3", "u4"} {
+		if id != before[0] && id != before[1] {
+			spare = id
+		}
+	}
+
+	w := serve(h, "POST", "/users/setIsActive", `{"user_id":"`+before[0]+`","is_active":false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var out struct {
+		User       models.UserResp   `json:"user"`
+		Reassigned map[string]string `json:"reassigned"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	require.False(t, out.User.IsActive)
+	require.Equal(t, map[string]string{"pr-1": spare}, out.Reassigned)
+	require.ElementsMatch(t, []string{before[1], spare}, prReviewers(t, r, "pr-1"))
+}
+
+// TestIfMatchOnDeletes checks that the writes outside the regular update
+// routes refuse a stale version and take the current one.
+func TestIfMatchOnDeletes(t *testing.T) {
+	h, r := newSeededRouter(t)
+	require.Equal(t, http.StatusCreated, serve(h, "POST", "/scim/v2/Users", `{"userName":"Eve","externalId":"u5"}`).Code)
+	require.Equal(t, http.StatusCreated, serve(h, "POST", "/scim/v2/Users", `{"userName":"Fay","externalId":"u6"}`).Code)
+	_, err := r.CreateTeam("docs", nil)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name, method, path, body string
+		version                  func() (string, error)
+		status                   int
+	}{
+		{"scim user patch", "PATCH", "/scim/v2/Users/u5", `{"Operations":[{"op":"replace","path":"userName","value":"Eva"}]}`,
+			func() (string, error) { return r.UserVersion("u5") }, http.StatusOK},
+		{"scim user delete", "DELETE", "/scim/v2/Users/u5", "", func() (string, error) { return r.UserVersion("u5") }, http.StatusNoContent},
+		{"users delete", "POST", "/users/delete", `{"user_id":"u6"}`, func() (string, error) { return r.UserVersion("u6") }, http.StatusOK},
+		{"team archive", "POST", "/team/archive", `{"team_name":"docs"}`, func() (string, error) { return r.TeamVersion("docs") }, http.StatusOK},
+		{"team unarchive", "POST", "/team/unarchive", `{"team_name":"docs"}`, func() (string, error) { return r.TeamVersion("docs") }, http.StatusOK},
+		{"scim group delete", "DELETE", "/scim/v2/Groups/docs", "", func() (string, error) { return r.TeamVersion("docs") }, http.StatusNoContent},
+	}
+	for _, c := range cases {
+		version, err := c.version()
+		require.NoError(t, err, c.name)
+		w := serveIfMatch(h, c.method, c.path, c.body, `"`+version+`0"`)
+		require.Equal(t, http.StatusPreconditionFailed, w.Code, c.name)
+		w = serveIfMatch(h, c.method, c.path, c.body, `"`+version+`"`)
+		require.Equal(t, c.status, w.Code, "%s: %s", c.name, w.Body.String())
+	}
+
+	w := serve(h, "GET", "/scim/v2/Groups/backend", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	version, err := r.TeamVersion("backend")
+	require.NoError(t, err)
+	require.Equal(t, `"`+version+`"`, w.Header().Get("ETag"))
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	"github.com/example/prreview/internal/slack"
+)
+
+const maxSlackBody = 64 << 10
+
+const slackUsage = "Usage:\n" +
+	"• `/reviews` — your open reviews\n" +
+	"• `/reviews team <team>` — open reviews of every member of a team\n" +
+	"• `/reassign <pr-id>` — hand your review of a PR to someone else\n" +
+	"• `/merge <pr-id>` — merge an approved PR"
+
+// RegisterSlackRoutes serves the Slack slash commands. Requests are
+// authenticated by their Slack signature instead of an API token.
+func RegisterSlackRoutes(r *mux.Router, repos *repo.SQLRepo, svcs *services.Services, signingSecret string) {
+	r.HandleFunc("/slack/commands", makeSlackCommandHandler(repos, svcs, signingSecret)).Methods("POST")
+}
+
+func makeSlackCommandHandler(repos *repo.SQLRepo, svcs *services.Services, signingSecret string) http.HandlerFunc {
+	c := &slackCommands{repos: repos, svcs: svcs}
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSlackBody))
+		if err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if err := slack.Verify(signingSecret, r.Header, body, time.Now()); err != nil {
+			sendAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", err.Error())
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+
+		msg := c.run(form.Get("command"), strings.Fields(form.Get("text")), form.Get("user_id"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(msg)
+	}
+}
+
+type slackCommands struct {
+	repos *repo.SQLRepo
+	svcs  *services.Services
+}
+
+// run executes a slash command sent by the Slack user slackUserID. Problems
+// are reported back as ephemeral messages: Slack shows any non-200 response
+// as a generic failure.
+func (c *slackCommands) run(command string, args []string, slackUserID string) slack.Message {
+	switch {
+	case command == "/reviews" && len(args) == 0:
+		return c.asUser(slackUserID, c.userReviews)
+	case command == "/reviews" && len(args) == 2 && args[0] == "team":
+		return c.teamReviews(args[1])
+	case command == "/reassign" && len(args) == 1:
+		return c.asUser(slackUserID, func(u *models.UserResp) slack.Message { return c.reassign(u, args[0]) })
+	case command == "/merge" && len(args) == 1:
+		return c.asUser(slackUserID, func(u *models.UserResp) slack.Message { return c.merge(u, args[0]) })
+	}
+	return slack.Message{ResponseType: slack.Ephemeral, Text: slackUsage, Blocks: []slack.Block{slack.Section(slackUsage)}}
+}
+
+// asUser runs fn for the user whose slack_user_id is slackUserID.
+func (c *slackCommands) asUser(slackUserID string, fn func(*models.UserResp) slack.Message) slack.Message {
+	if slackUserID == "" {
+		return slackText(slackUsage)
+	}
+	users, total, err := c.repos.ListUsers(repo.UserFilter{SlackUserID: slackUserID}, 0, 1)
+	switch {
+	case err != nil:
+		return slackError(err)
+	case total == 0:
+		return slackText("Your Slack account is not linked to a reviewer: ask an admin to set your slack_user_id.")
+	case total > 1:
+		return slackText("Your Slack account is linked to several reviewers: ask an admin to fix slack_user_id.")
+	}
+	return fn(&users[0])
+}
+
+func (c *slackCommands) userReviews(u *models.UserResp) slack.Message {
+	prs, err := c.repos.GetPRsForUser(u.UserID)
+	if err != nil {
+		return slackError(err)
+	}
+	open := openPRs(prs)
+	if len(open) == 0 {
+		return slackText("You have no open reviews. :tada:")
+	}
+	text := fmt.Sprintf("You have %d open review(s)", len(open))
+	return slack.Message{
+		ResponseType: slack.Ephemeral,
+		Text:         text,
+		Blocks:       []slack.Block{slack.Header("Your review queue"), slack.Section(prList(open))},
+	}
+}
+
+func (c *slackCommands) teamReviews(teamName string) slack.Message {
+	team, err := c.repos.GetTeamByName(teamName)
+	if err != nil {
+		return slackError(err)
+	}
+	blocks := []slack.Block{slack.Header("Review queue of " + team.TeamName)}
+	total := 0
+	for _, m := range team.Members {
+		prs, err := c.repos.GetPRsForUser(m.UserID)
+		if err != nil {
+			return slackError(err)
+		}
+		open := openPRs(prs)
+		total += len(open)
+
+		line := fmt.Sprintf("*%s* (`%s`) — %d open", slack.Escape(m.Username), slack.Escape(m.UserID), len(open))
+		if !m.IsActive {
+			line += ", inactive"
+		}
+		if len(open) > 0 {
+			line += "\n" + prList(open)
+		}
+		blocks = append(blocks, slack.Section(line))
+	}
+	if len(team.Members) == 0 {
+		blocks = append(blocks, slack.Section("The team has no members."))
+	}
+	blocks = append(blocks, slack.Context(fmt.Sprintf("%d open review(s) in total", total)))
+	return slack.Message{
+		ResponseType: slack.Ephemeral,
+		Text:         fmt.Sprintf("Team %s has %d open review(s)", team.TeamName, total),
+		Blocks:       blocks,
+	}
+}
+
+func (c *slackCommands) reassign(u *models.UserResp, prID string) slack.Message {
+	newID, _, err := c.svcs.PR.Reassign(prID, u.UserID, nil)
+	if err != nil {
+		return slackError(err)
+	}
+	text := fmt.Sprintf("%s handed the review of `%s` to %s", c.mention(u.UserID), slack.Escape(prID), c.mention(newID))
+	return slack.Message{ResponseType: slack.InChannel, Text: text, Blocks: []slack.Block{slack.Section(text)}}
+}
+
+func (c *slackCommands) merge(u *models.UserResp, prID string) slack.Message {
+	if _, err := c.svcs.PR.MergePR(prID, services.MergeOptions{}); err != nil {
+		return slackError(err)
+	}
+	text := fmt.Sprintf("%s merged `%s`", c.mention(u.UserID), slack.Escape(prID))
+	return slack.Message{ResponseType: slack.InChannel, Text: text, Blocks: []slack.Block{slack.Section(text)}}
+}
+
+// mention refers to a user with a Slack mention when their account is
+// linked, by name and id otherwise.
+func (c *slackCommands) mention(userID string) string {
+	u, err := c.repos.GetUser(userID)
+	switch {
+	case err != nil:
+		return "`" + slack.Escape(userID) + "`"
+	case u.SlackUserID != "":
+		return "<@" + u.SlackUserID + ">"
+	default:
+		return fmt.Sprintf("*%s* (`%s`)", slack.Escape(u.Username), slack.Escape(u.UserID))
+	}
+}
+
+func openPRs(prs []*models.PullRequestShortResp) []*models.PullRequestShortResp {
+	var open []*models.PullRequestShortResp
+	for _, pr := range prs {
+		if pr.Status == "OPEN" {
+			open = append(open, pr)
+		}
+	}
+	return open
+}
+
+func prList(prs []*models.PullRequestShortResp) string {
+	lines := make([]string, 0, len(prs))
+	for _, pr := range prs {
+		lines = append(lines, fmt.Sprintf("• `%s` %s — by `%s`",
+			slack.Escape(pr.PullRequestID), slack.Escape(pr.PullRequestName), slack.Escape(pr.AuthorID)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func slackText(text string) slack.Message {
+	return slack.Message{ResponseType: slack.Ephemeral, Text: text, Blocks: []slack.Block{slack.Section(text)}}
+}
+
+func slackError(err error) slack.Message {
+	switch {
+	case errors.Is(err, repo.ErrPRNotFound), errors.Is(err, sql.ErrNoRows):
+		return slackText("PR not found.")
+	case errors.Is(err, repo.ErrTeamNotFound):
+		return slackText("Team not found.")
+	case errors.Is(err, services.ErrPRMerged):
+		return slackText("The PR is already merged.")
+	case errors.Is(err, services.ErrNotAssigned):
+		return slackText("You are not a reviewer of this PR.")
+	case errors.Is(err, services.ErrNoCandidate):
+		return slackText("There is no one to hand the review to.")
+	case errors.Is(err, services.ErrNotApproved):
+		return slackText("The PR cannot be merged yet: " + slack.Escape(strings.TrimPrefix(err.Error(), services.ErrNotApproved.Error()+": ")) + ".")
+	}
+	log.Printf("slack command: %v", err)
+	return slackText("Something went wrong, please try again later.")
+}
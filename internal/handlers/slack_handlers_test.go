@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/slack"
+)
+
+func slackRequest(t *testing.T, secret string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	r := mux.NewRouter()
+	RegisterSlackRoutes(r, nil, nil, "signing-secret")
+
+	body := form.Encode()
+	now := time.Now()
+	req := httptest.NewRequest("POST", "/slack/commands", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("X-Slack-Signature", slack.Sign(secret, now, []byte(body)))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSlackCommandNeedsSignature(t *testing.T) {
+	rec := slackRequest(t, "wrong", url.Values{"command": {"/reviews"}, "user_id": {"U1"}})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+// The requests below are answered before the database is needed.
+func TestSlackCommandUsage(t *testing.T) {
+	for _, form := range []url.Values{
+		{"command": {"/reviews"}, "text": {"team"}, "user_id": {"U1"}},
+		{"command": {"/reassign"}, "text": {""}, "user_id": {"U1"}},
+		{"command": {"/merge"}, "text": {"pr-1 pr-2"}, "user_id": {"U1"}},
+		{"command": {"/deploy"}, "user_id": {"U1"}},
+		{"command": {"/reviews"}},
+	} {
+		rec := slackRequest(t, "signing-secret", form)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var msg slack.Message
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &msg))
+		require.Equal(t, slack.Ephemeral, msg.ResponseType)
+		require.Contains(t, msg.Text, "Usage:", form.Encode())
+		require.Len(t, msg.Blocks, 1)
+		require.Equal(t, "mrkdwn", msg.Blocks[0].Text.Type)
+	}
+}
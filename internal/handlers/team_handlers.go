@@ -2,8 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/example/prreview/internal/auth"
+	"github.com/example/prreview/internal/codeowners"
 	"github.com/example/prreview/internal/models"
 	"github.com/example/prreview/internal/repo"
 	"github.com/example/prreview/internal/services"
@@ -17,15 +22,54 @@ func RegisterTeamRoutes(r *mux.Router, repos *repo.SQLRepo, svcs *services.Servi
 	r.HandleFunc("/team/get", func(w http.ResponseWriter, r *http.Request) {
 		handleTeamGet(w, r, repos)
 	}).Methods("GET")
+	r.HandleFunc("/team/codeowners", func(w http.ResponseWriter, r *http.Request) {
+		handleCodeownersSet(w, r, repos)
+	}).Methods("POST")
+	r.HandleFunc("/team/codeowners", func(w http.ResponseWriter, r *http.Request) {
+		handleCodeownersGet(w, r, repos)
+	}).Methods("GET")
+	r.HandleFunc("/team/fallbacks", func(w http.ResponseWriter, r *http.Request) {
+		handleFallbacksSet(w, r, repos)
+	}).Methods("POST")
+	r.HandleFunc("/team/setMaxOpenReviews", func(w http.ResponseWriter, r *http.Request) {
+		handleSetTeamMaxOpenReviews(w, r, repos)
+	}).Methods("POST")
+	r.HandleFunc("/team/fallbacks", func(w http.ResponseWriter, r *http.Request) {
+		handleFallbacksGet(w, r, repos)
+	}).Methods("GET")
+	r.HandleFunc("/team/setRequiredApprovals", func(w http.ResponseWriter, r *http.Request) {
+		handleSetTeamRequiredApprovals(w, r, repos)
+	}).Methods("POST")
+	r.HandleFunc("/team/setSLA", func(w http.ResponseWriter, r *http.Request) {
+		handleSetTeamSLA(w, r, repos)
+	}).Methods("POST")
+	r.HandleFunc("/team/archive", makeRetireTeamHandler(svcs.Teams.Archive)).Methods("POST")
+	r.HandleFunc("/team/delete", makeRetireTeamHandler(svcs.Teams.Delete)).Methods("POST")
+	r.HandleFunc("/team/unarchive", func(w http.ResponseWriter, r *http.Request) {
+		handleTeamUnarchive(w, r, svcs)
+	}).Methods("POST")
 }
 
 func handleTeamGet(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
 	teamName := r.URL.Query().Get("team_name")
 	if teamName == "" {
-		http.Error(w, "team_name required", http.StatusBadRequest)
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
 		return
 	}
 
+	writeTeam(w, r, repos, teamName, http.StatusOK)
+}
+
+// writeTeam responds with the stored team as /team/get does, with its ETag.
+func writeTeam(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, teamName string, status int) {
+	version, err := repos.TeamVersion(teamName)
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	if writeETag(w, r, version) {
+		return
+	}
 	team, err := repos.GetTeamByName(teamName)
 	if err != nil {
 		sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
@@ -33,12 +77,17 @@ func handleTeamGet(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo)
 	}
 
 	resp := models.TeamResp{
-		TeamName: team.TeamName,
-		Members:  team.Members,
+		TeamName:              team.TeamName,
+		Members:               team.Members,
+		FallbackTeams:         team.FallbackTeams,
+		DefaultMaxOpenReviews: team.DefaultMaxOpenReviews,
+		RequiredApprovals:     team.RequiredApprovals,
+		LeadUserID:            team.LeadUserID,
+		SLA:                   team.SLA,
+		Archived:              team.Archived,
+		ArchivedAt:            team.ArchivedAt,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]models.TeamResp{"team": resp})
+	writeJSON(w, status, map[string]models.TeamResp{"team": resp})
 }
 
 func handleTeamAdd(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
@@ -47,7 +96,7 @@ func handleTeamAdd(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo)
 		Members  []models.TeamMemberResp `json:"members"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
 		return
 	}
 
@@ -71,3 +120,314 @@ func handleTeamAdd(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo)
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(map[string]models.TeamResp{"team": resp})
 }
+
+func handleCodeownersSet(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var in models.CodeownersResp
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if in.TeamName == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+		return
+	}
+
+	rules, err := codeowners.Parse(in.Codeowners)
+	if err != nil {
+		sendAPIError(w, http.StatusBadRequest, "INVALID_CODEOWNERS", err.Error())
+		return
+	}
+	missing, err := repos.MissingUsers(rules.AllOwners())
+	if err != nil {
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	if len(missing) > 0 {
+		sendAPIError(w, http.StatusBadRequest, "INVALID_CODEOWNERS", "unknown owners: "+strings.Join(missing, ", "))
+		return
+	}
+
+	if err := repos.SetTeamCodeowners(in.TeamName, in.Codeowners); err != nil {
+		if errors.Is(err, repo.ErrTeamNotFound) {
+			sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+			return
+		}
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]models.CodeownersResp{"codeowners": in})
+}
+
+func handleCodeownersGet(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	teamName := r.URL.Query().Get("team_name")
+	if teamName == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+		return
+	}
+
+	content, err := repos.GetTeamCodeowners(teamName)
+	if err != nil {
+		if errors.Is(err, repo.ErrTeamNotFound) {
+			sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+			return
+		}
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+
+	resp := models.CodeownersResp{TeamName: teamName, Codeowners: content}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]models.CodeownersResp{"codeowners": resp})
+}
+
+func handleFallbacksSet(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var in models.TeamFallbacksResp
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if in.TeamName == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+		return
+	}
+	seen := map[string]bool{}
+	for _, t := range in.FallbackTeams {
+		if t == "" || seen[t] {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "fallback_teams must be unique non-empty team names")
+			return
+		}
+		seen[t] = true
+	}
+	if in.FallbackTeams == nil {
+		in.FallbackTeams = []string{}
+	}
+
+	if err := repos.SetTeamFallbacks(in.TeamName, in.FallbackTeams, ifMatch(r)); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrVersionMismatch):
+			sendAPIError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", err.Error())
+		case errors.Is(err, repo.ErrTeamNotFound):
+			sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		case errors.Is(err, repo.ErrFallbackCycle):
+			sendAPIError(w, http.StatusConflict, "FALLBACK_CYCLE", err.Error())
+		default:
+			sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]models.TeamFallbacksResp{"fallbacks": in})
+}
+
+func handleFallbacksGet(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	teamName := r.URL.Query().Get("team_name")
+	if teamName == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+		return
+	}
+
+	team, err := repos.GetTeamByName(teamName)
+	if err != nil {
+		sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		return
+	}
+
+	resp := models.TeamFallbacksResp{TeamName: teamName, FallbackTeams: team.FallbackTeams}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]models.TeamFallbacksResp{"fallbacks": resp})
+}
+
+func handleSetTeamMaxOpenReviews(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var in struct {
+		TeamName       string `json:"team_name"`
+		MaxOpenReviews *int   `json:"max_open_reviews"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if in.TeamName == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+		return
+	}
+	if in.MaxOpenReviews != nil && *in.MaxOpenReviews < 0 {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "max_open_reviews must not be negative")
+		return
+	}
+
+	if err := repos.SetTeamMaxOpenReviews(in.TeamName, in.MaxOpenReviews, ifMatch(r)); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"team_name": in.TeamName, "max_open_reviews": in.MaxOpenReviews})
+}
+
+func handleSetTeamRequiredApprovals(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var in struct {
+		TeamName          string `json:"team_name"`
+		RequiredApprovals *int   `json:"required_approvals"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if in.TeamName == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+		return
+	}
+	if in.RequiredApprovals != nil && *in.RequiredApprovals < 0 {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "required_approvals must not be negative")
+		return
+	}
+
+	if err := repos.SetTeamRequiredApprovals(in.TeamName, in.RequiredApprovals, ifMatch(r)); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"team_name": in.TeamName, "required_approvals": in.RequiredApprovals})
+}
+
+func handleSetTeamSLA(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var in struct {
+		TeamName      string  `json:"team_name"`
+		FirstResponse *string `json:"first_response"`
+		Verdict       *string `json:"verdict"`
+		LeadUserID    *string `json:"lead_user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if in.TeamName == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+		return
+	}
+	firstResponse, err := parseOptionalDuration(in.FirstResponse)
+	if err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "first_response: "+err.Error())
+		return
+	}
+	verdict, err := parseOptionalDuration(in.Verdict)
+	if err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "verdict: "+err.Error())
+		return
+	}
+
+	if err := repos.SetTeamSLA(in.TeamName, firstResponse, verdict, in.LeadUserID, ifMatch(r)); err != nil {
+		if errors.Is(err, repo.ErrUserNotFound) {
+			sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+			return
+		}
+		writeTeamError(w, err)
+		return
+	}
+
+	team, err := repos.GetTeamByName(in.TeamName)
+	if err != nil {
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	out := map[string]interface{}{"team_name": in.TeamName, "lead_user_id": team.LeadUserID}
+	if team.SLA != nil {
+		out["sla"] = team.SLA
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func parseOptionalDuration(s *string) (*time.Duration, error) {
+	if s == nil {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(*s)
+	if err != nil {
+		return nil, err
+	}
+	if d < 0 {
+		return nil, errors.New("must not be negative")
+	}
+	return &d, nil
+}
+
+func makeRetireTeamHandler(retire func(team, successor, actor string, ifMatch repo.IfMatch) ([]string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			TeamName      string `json:"team_name"`
+			SuccessorTeam string `json:"successor_team"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if in.TeamName == "" {
+			sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+			return
+		}
+
+		moved, err := retire(in.TeamName, in.SuccessorTeam, actorName(r), ifMatch(r))
+		if err != nil {
+			writeTeamError(w, err)
+			return
+		}
+		if moved == nil {
+			moved = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"team_name":       in.TeamName,
+			"successor_team":  in.SuccessorTeam,
+			"transferred_prs": moved,
+		})
+	}
+}
+
+func handleTeamUnarchive(w http.ResponseWriter, r *http.Request, svcs *services.Services) {
+	var in struct {
+		TeamName string `json:"team_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	if in.TeamName == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "team_name required")
+		return
+	}
+
+	if err := svcs.Teams.Unarchive(in.TeamName, actorName(r), ifMatch(r)); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"team_name": in.TeamName, "archived": false})
+}
+
+func writeTeamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repo.ErrTeamNotFound):
+		sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, services.ErrInvalidSuccessor):
+		sendAPIError(w, http.StatusBadRequest, "INVALID_SUCCESSOR", err.Error())
+	case errors.Is(err, services.ErrTeamHasOpenPRs):
+		sendAPIError(w, http.StatusConflict, "TEAM_HAS_OPEN_PRS", err.Error())
+	case errors.Is(err, repo.ErrVersionMismatch):
+		sendAPIError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", err.Error())
+	default:
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+	}
+}
+
+// actorName is the API client for the audit log, empty when auth is off.
+func actorName(r *http.Request) string {
+	if c, ok := auth.ClientFromContext(r.Context()); ok {
+		return c.Name
+	}
+	return ""
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,58 +14,234 @@ import (
 )
 
 func RegisterUserRoutes(r *mux.Router, repos *repo.SQLRepo, svcs *services.Services) {
+	r.HandleFunc("/users/create", func(w http.ResponseWriter, r *http.Request) {
+		handleUserCreate(w, r, repos)
+	}).Methods("POST")
+	r.HandleFunc("/users/get", func(w http.ResponseWriter, r *http.Request) {
+		handleUserGet(w, r, repos)
+	}).Methods("GET")
+	r.HandleFunc("/users/update", func(w http.ResponseWriter, r *http.Request) {
+		handleUserUpdate(w, r, repos)
+	}).Methods("POST")
+	r.HandleFunc("/users/delete", func(w http.ResponseWriter, r *http.Request) {
+		handleUserDelete(w, r, svcs)
+	}).Methods("POST")
+
 	r.HandleFunc("/users/setIsActive", func(w http.ResponseWriter, r *http.Request) {
-		handleSetIsActive(w, r, repos)
+		handleSetIsActive(w, r, svcs)
 	}).Methods("POST")
 
 	r.HandleFunc("/users/getReview", func(w http.ResponseWriter, r *http.Request) {
-		handleGetReview(w, r, repos)
+		handleGetReview(w, r, repos, svcs)
 	}).Methods("GET")
+
+	r.HandleFunc("/users/setMaxOpenReviews", func(w http.ResponseWriter, r *http.Request) {
+		handleSetUserMaxOpenReviews(w, r, repos)
+	}).Methods("POST")
 }
 
-func handleSetIsActive(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+func handleSetIsActive(w http.ResponseWriter, r *http.Request, svcs *services.Services) {
 	var input struct {
 		UserID   string `json:"user_id"`
 		IsActive bool   `json:"is_active"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid request body")
 		return
 	}
 
 	if input.UserID == "" {
-		http.Error(w, "user_id is required", http.StatusBadRequest)
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id is required")
 		return
 	}
 
-	if err := repos.SetUserIsActive(input.UserID, input.IsActive); err != nil {
-		http.Error(w, "failed to update user", http.StatusInternalServerError)
+	user, replaced, err := svcs.Users.Update(input.UserID, repo.UserUpdate{IfMatch: ifMatch(r)}, &input.IsActive)
+	if err != nil {
+		writeUserError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(map[string]string{"status": "ok"}); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"user": user, "reassigned": replaced})
+}
+
+func handleUserCreate(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var input struct {
+		UserID      string   `json:"user_id"`
+		Username    string   `json:"username"`
+		IsActive    *bool    `json:"is_active"`
+		Email       string   `json:"email"`
+		SlackUserID string   `json:"slack_user_id"`
+		Teams       []string `json:"teams"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid request body")
+		return
+	}
+	if input.UserID == "" || input.Username == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id and username are required")
+		return
+	}
+
+	u := models.UserResp{
+		UserID:      input.UserID,
+		Username:    input.Username,
+		Teams:       input.Teams,
+		IsActive:    input.IsActive == nil || *input.IsActive,
+		Email:       input.Email,
+		SlackUserID: input.SlackUserID,
+	}
+	user, err := repos.CreateUser(u)
+	if err != nil {
+		writeUserError(w, err)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]*models.UserResp{"user": user})
 }
 
-func handleGetReview(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+func handleUserGet(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
-		http.Error(w, "user_id required", http.StatusBadRequest)
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id required")
+		return
+	}
+	writeUser(w, r, repos, userID)
+}
+
+// writeUser responds with the user as /users/get does, with its ETag.
+func writeUser(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, userID string) {
+	version, err := repos.UserVersion(userID)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	if writeETag(w, r, version) {
+		return
+	}
+	user, err := repos.GetUser(userID)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]*models.UserResp{"user": user})
+}
+
+func handleUserUpdate(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var input struct {
+		UserID        string  `json:"user_id"`
+		Username      *string `json:"username"`
+		Email         *string `json:"email"`
+		SlackUserID   *string `json:"slack_user_id"`
+		Notifications *struct {
+			Assignments *bool `json:"assignments"`
+			Digest      *bool `json:"digest"`
+		} `json:"notifications"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid request body")
+		return
+	}
+	if input.UserID == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id is required")
+		return
+	}
+	if input.Username != nil && *input.Username == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "username must not be empty")
+		return
+	}
+
+	upd := repo.UserUpdate{
+		Username:    input.Username,
+		Email:       input.Email,
+		SlackUserID: input.SlackUserID,
+		IfMatch:     ifMatch(r),
+	}
+	if n := input.Notifications; n != nil {
+		upd.NotifyAssignments = n.Assignments
+		upd.NotifyDigest = n.Digest
+	}
+	user, err := repos.UpdateUser(input.UserID, upd)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]*models.UserResp{"user": user})
+}
+
+func handleUserDelete(w http.ResponseWriter, r *http.Request, svcs *services.Services) {
+	var input struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid request body")
+		return
+	}
+	if input.UserID == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id is required")
+		return
+	}
+
+	replaced, err := svcs.Users.Delete(input.UserID, ifMatch(r))
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"user_id": input.UserID, "reassigned": replaced})
+}
+
+func writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repo.ErrUserNotFound), errors.Is(err, repo.ErrTeamNotFound):
+		sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, repo.ErrUserExists):
+		sendAPIError(w, http.StatusConflict, "USER_EXISTS", err.Error())
+	case errors.Is(err, services.ErrUserHasPRs):
+		sendAPIError(w, http.StatusConflict, "USER_HAS_PRS", err.Error())
+	case errors.Is(err, repo.ErrVersionMismatch):
+		sendAPIError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", err.Error())
+	default:
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+	}
+}
+
+func handleGetReview(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo, svcs *services.Services) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id required")
+		return
+	}
+	writeUserReviews(w, repos, svcs, userID)
+}
+
+// writeUserReviews responds with the PRs the user reviews and their load, as
+// /users/getReview does.
+func writeUserReviews(w http.ResponseWriter, repos *repo.SQLRepo, svcs *services.Services, userID string) {
+	load, err := svcs.PR.ReviewLoad(userID)
+	if err != nil {
+		if errors.Is(err, repo.ErrUserNotFound) {
+			sendAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+			return
+		}
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
 		return
 	}
 
 	prs, err := repos.GetPRsForUser(userID)
 	if err != nil {
 		log.Printf("GetPRsForUser error for user=%q: %v", userID, err)
-		http.Error(w, fmt.Sprintf("failed to fetch PRs: %v", err), http.StatusInternalServerError)
+		sendAPIError(w, http.StatusInternalServerError, "INTERNAL", fmt.Sprintf("failed to fetch PRs: %v", err))
 		return
 	}
 
-	var resp []models.PullRequestShortResp
+	resp := []models.PullRequestShortResp{}
 	for _, pr := range prs {
 		resp = append(resp, models.PullRequestShortResp{
 			PullRequestID:   pr.PullRequestID,
@@ -74,9 +251,32 @@ func handleGetReview(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo
 		})
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string][]models.PullRequestShortResp{"prs": resp}); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"user_id": userID, "prs": resp, "load": load})
+}
+
+func handleSetUserMaxOpenReviews(w http.ResponseWriter, r *http.Request, repos *repo.SQLRepo) {
+	var input struct {
+		UserID         string `json:"user_id"`
+		MaxOpenReviews *int   `json:"max_open_reviews"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid request body")
+		return
+	}
+	if input.UserID == "" {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "user_id is required")
+		return
+	}
+	if input.MaxOpenReviews != nil && *input.MaxOpenReviews < 0 {
+		sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "max_open_reviews must not be negative")
+		return
+	}
+
+	if err := repos.SetUserMaxOpenReviews(input.UserID, input.MaxOpenReviews, ifMatch(r)); err != nil {
+		writeUserError(w, err)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"user_id": input.UserID, "max_open_reviews": input.MaxOpenReviews})
 }
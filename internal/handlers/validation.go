@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/example/prreview/internal/openapi"
+)
+
+// ValidationMiddleware rejects requests that do not match the API spec with
+// 400 before they reach the handlers. Paths the spec does not describe are
+// passed through.
+//
+// With checkResponses set every response is also checked, and one that does
+// not match the spec is replaced with 500 and logged. That is meant for tests
+// and staging: the response is buffered until the handler returns, except
+// for event streams, which are passed through unchecked.
+func ValidationMiddleware(spec *openapi.Spec, checkResponses bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			op, params := spec.Find(r.Method, r.URL.Path)
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := op.ValidateRequest(r, params); err != nil {
+				var verr *openapi.ValidationError
+				if !errors.As(err, &verr) {
+					sendAPIError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+					return
+				}
+				if strings.HasPrefix(r.URL.Path, "/scim/") {
+					writeSCIMError(w, scimBadRequest("invalidValue", "%s", verr.Error()))
+					return
+				}
+				sendAPIError(w, http.StatusBadRequest, "BAD_REQUEST", verr.Error())
+				return
+			}
+			if !checkResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			bw := &bufferedWriter{ResponseWriter: w, header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(bw, r)
+			if bw.streaming {
+				return
+			}
+			if err := op.ValidateResponse(bw.status, bw.header, bw.body.Bytes()); err != nil {
+				log.Printf("openapi: %s %s: response does not match the spec: %v", r.Method, r.URL.Path, err)
+				sendAPIError(w, http.StatusInternalServerError, "INTERNAL", "response does not match the API spec: "+err.Error())
+				return
+			}
+			bw.flush()
+		})
+	}
+}
+
+// bufferedWriter holds a response until it has been checked. Event streams
+// are written through as soon as their headers are.
+type bufferedWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	status      int
+	wroteHeader bool
+	streaming   bool
+	body        bytes.Buffer
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	if bw.streaming {
+		return bw.ResponseWriter.Header()
+	}
+	return bw.header
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	if bw.wroteHeader {
+		return
+	}
+	bw.wroteHeader = true
+	bw.status = code
+	if mediaType, _, _ := mime.ParseMediaType(bw.header.Get("Content-Type")); mediaType == "text/event-stream" {
+		bw.streaming = true
+		copyHeader(bw.ResponseWriter.Header(), bw.header)
+		bw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+	if bw.streaming {
+		return bw.ResponseWriter.Write(b)
+	}
+	return bw.body.Write(b)
+}
+
+// Flush lets event streams reach the client; buffered responses are sent
+// when the handler returns.
+func (bw *bufferedWriter) Flush() {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+	if bw.streaming {
+		http.NewResponseController(bw.ResponseWriter).Flush()
+	}
+}
+
+func (bw *bufferedWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+func (bw *bufferedWriter) flush() {
+	copyHeader(bw.ResponseWriter.Header(), bw.header)
+	bw.ResponseWriter.WriteHeader(bw.status)
+	_, _ = bw.ResponseWriter.Write(bw.body.Bytes())
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/events"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/openapi"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+)
+
+func newValidatedRouter(t *testing.T, checkResponses bool) *mux.Router {
+	t.Helper()
+	spec, err := openapi.Load("../../swagger-ui/openapi.yaml")
+	require.NoError(t, err)
+	r := mux.NewRouter()
+	r.Use(ValidationMiddleware(spec, checkResponses))
+	return r
+}
+
+// newAPIRouter serves the real repository-backed routes behind response
+// validation, so every handler test also checks what it got back against
+// the spec. Tests that stop before the database can pass nil repos and an
+// empty Services.
+func newAPIRouter(t *testing.T, repos *repo.SQLRepo, svcs *services.Services) *mux.Router {
+	t.Helper()
+	r := newValidatedRouter(t, true)
+	RegisterTeamRoutes(r, repos, svcs)
+	RegisterUserRoutes(r, repos, svcs)
+	RegisterPRRoutes(r, repos, svcs)
+	RegisterAPIv1Routes(r, repos, svcs)
+	RegisterAbsenceRoutes(r, repos, svcs)
+	RegisterSCIMRoutes(r, repos, svcs)
+	RegisterBulkRoutes(r, repos, svcs)
+	return r
+}
+
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) apiError {
+	t.Helper()
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var e apiError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	return e
+}
+
+func TestValidationRejectsRequests(t *testing.T) {
+	r := newValidatedRouter(t, false)
+	called := false
+	ok := func(w http.ResponseWriter, r *http.Request) { called = true }
+	r.HandleFunc("/pullRequest/merge", ok).Methods("POST")
+	r.HandleFunc("/scim/v2/Users/{id}", ok).Methods("PATCH")
+	r.HandleFunc("/internal", ok).Methods("POST")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/pullRequest/merge", strings.NewReader(`{"force": true}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	e := decodeAPIError(t, w)
+	require.Equal(t, "BAD_REQUEST", e.Error.Code)
+	require.Equal(t, "request body: pull_request_id is required", e.Error.Message)
+	require.False(t, called)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("PATCH", "/scim/v2/Users/u1", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/scim+json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "application/scim+json", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), `"scimType":"invalidValue"`)
+	require.False(t, called)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/pullRequest/merge", strings.NewReader(`{"pull_request_id": "pr-1"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, called)
+
+	// Paths the spec does not describe are not checked.
+	called = false
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/internal", strings.NewReader("anything")))
+	require.True(t, called)
+}
+
+func TestValidationChecksResponses(t *testing.T) {
+	r := newValidatedRouter(t, true)
+	r.HandleFunc("/team/get", func(w http.ResponseWriter, r *http.Request) {
+		resp := models.TeamResp{TeamName: r.URL.Query().Get("team_name")}
+		if resp.TeamName == "empty" {
+			resp.Members = []models.TeamMemberResp{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Team", resp.TeamName)
+		_ = json.NewEncoder(w).Encode(map[string]models.TeamResp{"team": resp})
+	}).Methods("GET")
+	r.HandleFunc("/pullRequest/get", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "pull_request_id required", http.StatusBadRequest)
+	}).Methods("GET")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/team/get?team_name=empty", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "empty", w.Header().Get("X-Team"))
+	require.JSONEq(t, `{"team": {"team_name": "empty", "members": [], "archived": false}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/team/get?team_name=nil", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Empty(t, w.Header().Get("X-Team"))
+	e := decodeAPIError(t, w)
+	require.Equal(t, "INTERNAL", e.Error.Code)
+	require.Contains(t, e.Error.Message, "team.members: Invalid type")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/pullRequest/get?pull_request_id=pr-1", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, decodeAPIError(t, w).Error.Message, "is not an error response")
+}
+
+func TestValidationStreamsEvents(t *testing.T) {
+	broker := events.NewBroker(10)
+	r := newValidatedRouter(t, true)
+	RegisterEventRoutes(r, broker, time.Minute)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?team=backend")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The stream is flushed through, not held until the handler returns.
+	broker.Publish(models.Event{ID: 1, Type: models.EventPRCreated, PullRequestID: "pr-1", TeamName: "backend"})
+	require.Equal(t, "1", readEvent(t, bufio.NewReader(resp.Body))["id"])
+}
+
+func TestValidationPassesBodyOn(t *testing.T) {
+	r := newValidatedRouter(t, true)
+	r.HandleFunc("/users/setMaxOpenReviews", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}).Methods("POST")
+
+	w := httptest.NewRecorder()
+	body := `{"user_id":"u1","max_open_reviews":null}`
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/setMaxOpenReviews", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, body, w.Body.String())
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type TeamMemberResp struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
@@ -7,15 +12,56 @@ type TeamMemberResp struct {
 }
 
 type TeamResp struct {
-	TeamName string           `json:"team_name"`
-	Members  []TeamMemberResp `json:"members"`
+	TeamName      string           `json:"team_name"`
+	Members       []TeamMemberResp `json:"members"`
+	FallbackTeams []string         `json:"fallback_teams,omitempty"`
+	// DefaultMaxOpenReviews is the open review limit for members without their own.
+	DefaultMaxOpenReviews *int `json:"default_max_open_reviews,omitempty"`
+	RequiredApprovals     *int `json:"required_approvals,omitempty"`
+	// LeadUserID receives escalations of reviews that breach the team's SLA.
+	LeadUserID string       `json:"lead_user_id,omitempty"`
+	SLA        *TeamSLAResp `json:"sla,omitempty"`
+	// An archived team is kept for history but never picks reviewers.
+	Archived   bool       `json:"archived"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+}
+
+// TeamSLAResp holds durations such as "24h0m0s"; an empty value means the
+// configured default applies.
+type TeamSLAResp struct {
+	FirstResponse string `json:"first_response,omitempty"`
+	Verdict       string `json:"verdict,omitempty"`
+}
+
+type TeamFallbacksResp struct {
+	TeamName      string   `json:"team_name"`
+	FallbackTeams []string `json:"fallback_teams"`
+}
+
+type CodeownersResp struct {
+	TeamName   string `json:"team_name"`
+	Codeowners string `json:"codeowners"`
 }
 
 type UserResp struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
-	TeamName string `json:"team_name"`
-	IsActive bool   `json:"is_active"`
+	// TeamName is the first of Teams by name, kept for older clients.
+	TeamName string   `json:"team_name"`
+	Teams    []string `json:"teams"`
+	IsActive bool     `json:"is_active"`
+
+	Email       string `json:"email,omitempty"`
+	SlackUserID string `json:"slack_user_id,omitempty"`
+
+	Notifications NotificationSettings `json:"notifications"`
+}
+
+// NotificationSettings are the emails a user opted into: one per review
+// assignment and a daily digest of their open reviews.
+type NotificationSettings struct {
+	Assignments bool `json:"assignments"`
+	Digest      bool `json:"digest"`
 }
 
 type PullRequestResp struct {
@@ -25,6 +71,33 @@ type PullRequestResp struct {
 	Status            string   `json:"status" db:"status"`
 	AssignedReviewers []string `json:"assigned_reviewers" db:"-"`
 	Team_name         string   `json:"team_name" db:"team_name"`
+	// FallbackReviewers maps reviewers taken from fallback teams to that team.
+	FallbackReviewers map[string]string `json:"fallback_reviewers,omitempty" db:"-"`
+	// Reviews holds the latest verdict of each assigned reviewer who submitted one.
+	Reviews []ReviewResp `json:"reviews,omitempty" db:"-"`
+}
+
+type ReviewResp struct {
+	ReviewerID  string    `json:"reviewer_id" db:"user_id"`
+	Verdict     string    `json:"verdict" db:"verdict"`
+	Comment     string    `json:"comment,omitempty" db:"comment"`
+	SubmittedAt time.Time `json:"submitted_at" db:"submitted_at"`
+}
+
+type AuditEntryResp struct {
+	ID            int64           `json:"id" db:"id"`
+	At            time.Time       `json:"at" db:"at"`
+	Actor         string          `json:"actor" db:"actor"`
+	Action        string          `json:"action" db:"action"`
+	PullRequestID string          `json:"pull_request_id,omitempty" db:"pr_id"`
+	Details       json.RawMessage `json:"details" db:"details"`
+}
+
+// ReviewLoadResp reports how many OPEN reviews a user has against their
+// effective limit; a nil limit means unlimited.
+type ReviewLoadResp struct {
+	OpenReviews    int  `json:"open_reviews"`
+	MaxOpenReviews *int `json:"max_open_reviews"`
 }
 
 type PullRequestShortResp struct {
@@ -33,3 +106,62 @@ type PullRequestShortResp struct {
 	AuthorID        string `db:"author_id" json:"author_id"`
 	Status          string `db:"status" json:"status"`
 }
+
+type AbsenceResp struct {
+	AbsenceID   int64      `json:"absence_id" db:"id"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	StartsAt    time.Time  `json:"starts_at" db:"starts_at"`
+	EndsAt      time.Time  `json:"ends_at" db:"ends_at"`
+	Reason      string     `json:"reason" db:"reason"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty" db:"cancelled_at"`
+}
+
+type HandoffResp struct {
+	AbsenceID     int64   `json:"absence_id" db:"absence_id"`
+	PullRequestID string  `json:"pull_request_id" db:"pr_id"`
+	Status        string  `json:"status" db:"status"`
+	ReplacedBy    *string `json:"replaced_by,omitempty" db:"replaced_by"`
+	Error         string  `json:"error,omitempty" db:"-"`
+}
+
+const (
+	EventPRCreated          = "pr.created"
+	EventPRMerged           = "pr.merged"
+	EventReviewSubmitted    = "review.submitted"
+	EventReviewerReassigned = "reviewer.reassigned"
+	EventReviewOverdue      = "review.overdue"
+	EventReviewEscalated    = "review.escalated"
+)
+
+// Event is a change to a PR streamed to GET /events subscribers. TeamName,
+// AuthorID and Reviewers describe the PR after the change.
+type Event struct {
+	ID            int64     `json:"id"`
+	Type          string    `json:"type"`
+	At            time.Time `json:"at"`
+	PullRequestID string    `json:"pull_request_id"`
+	TeamName      string    `json:"team_name"`
+	AuthorID      string    `json:"author_id"`
+	Reviewers     []string  `json:"reviewers"`
+	// ReviewerID is the reviewer who submitted a review, was replaced or is
+	// overdue; NewReviewerID is their replacement and LeadUserID the team
+	// lead an overdue review was escalated to.
+	ReviewerID    string `json:"reviewer_id,omitempty"`
+	NewReviewerID string `json:"new_reviewer_id,omitempty"`
+	LeadUserID    string `json:"lead_user_id,omitempty"`
+	Verdict       string `json:"verdict,omitempty"`
+}
+
+// Involves reports whether userID authored the PR or is named by the event as
+// one of its reviewers or the lead it was escalated to.
+func (e Event) Involves(userID string) bool {
+	if e.AuthorID == userID || e.ReviewerID == userID || e.NewReviewerID == userID || e.LeadUserID == userID {
+		return true
+	}
+	for _, r := range e.Reviewers {
+		if r == userID {
+			return true
+		}
+	}
+	return false
+}
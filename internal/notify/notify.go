@@ -0,0 +1,197 @@
+// Package notify emails reviewers about their assignments and overdue reviews,
+// team leads about escalated ones, and sends reviewers a daily digest of their
+// open reviews.
+//
+// Assignment emails are queued by the services in the transaction that
+// assigns the reviewer, so nothing is sent for a change that rolls back, and
+// are sent by whichever replica claims them first.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"time"
+
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+)
+
+const (
+	batchSize = 50
+	// maxAttempts is how often a queued email is tried before it is dropped.
+	maxAttempts = 5
+)
+
+type Notifier struct {
+	repo       *repo.SQLRepo
+	templates  *Templates
+	sender     Sender
+	digest     bool
+	digestHour int
+	loc        *time.Location
+	now        func() time.Time
+}
+
+func New(r *repo.SQLRepo, cfg config.EmailConfig) (*Notifier, error) {
+	return newNotifier(r, cfg, NewSMTP(cfg))
+}
+
+func newNotifier(r *repo.SQLRepo, cfg config.EmailConfig, sender Sender) (*Notifier, error) {
+	templates, err := LoadTemplates(cfg.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{
+		repo:       r,
+		templates:  templates,
+		sender:     sender,
+		digest:     cfg.Digest,
+		digestHour: cfg.DigestHour,
+		loc:        loc,
+		now:        time.Now,
+	}, nil
+}
+
+// SendQueued sends a batch of queued assignment emails and returns how many
+// were sent. Failed emails stay queued for the next run unless the server
+// rejected them for good or they ran out of attempts; the returned error
+// lists the failures.
+func (n *Notifier) SendQueued() (int, error) {
+	tx, err := n.repo.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	emails, err := n.repo.ClaimEmailsTx(tx, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	var errs []error
+	for _, e := range emails {
+		// The user may have opted out since the email was queued.
+		if e.NotifyAssignments && e.Email != "" {
+			if err := n.sendAssignment(e); err != nil {
+				errs = append(errs, fmt.Errorf("email %d to %s: %w", e.ID, e.UserID, err))
+				if !permanent(err) && e.Attempts+1 < maxAttempts {
+					if err := n.repo.FailEmailTx(tx, e.ID, err.Error()); err != nil {
+						return sent, err
+					}
+					continue
+				}
+			} else {
+				sent++
+			}
+		}
+		if err := n.repo.DeleteEmailTx(tx, e.ID); err != nil {
+			return sent, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return sent, err
+	}
+	return sent, errors.Join(errs...)
+}
+
+// emailTemplates maps the kinds of queued emails to their templates.
+var emailTemplates = map[string]string{
+	repo.EmailAssigned:      TemplateAssigned,
+	repo.EmailReassigned:    TemplateReassigned,
+	repo.EmailSLAReminder:   TemplateSLAReminder,
+	repo.EmailSLAEscalation: TemplateSLAEscalation,
+}
+
+func (n *Notifier) sendAssignment(e repo.PendingEmail) error {
+	data := AssignmentData{
+		Username:        e.Username,
+		PullRequestID:   e.PullRequestID,
+		PullRequestName: e.PullRequestName,
+		AuthorID:        e.AuthorID,
+		TeamName:        e.TeamName,
+	}
+	if e.Kind == repo.EmailSLAEscalation {
+		data.ReviewerID = e.PreviousReviewerID
+	} else {
+		data.PreviousReviewerID = e.PreviousReviewerID
+	}
+	name, ok := emailTemplates[e.Kind]
+	if !ok {
+		return fmt.Errorf("unknown email kind %q", e.Kind)
+	}
+	subject, body, err := n.templates.Render(name, data)
+	if err != nil {
+		return err
+	}
+	return n.sender.Send(e.Email, subject, body)
+}
+
+// SendDigests sends today's digest to the users who want one and have OPEN
+// reviews, once the digest hour has passed. A user is sent at most one digest
+// a day across replicas; a digest that fails to send is retried on the next
+// run unless the server rejected it for good.
+func (n *Notifier) SendDigests() (int, error) {
+	now := n.now().In(n.loc)
+	if !n.digest || now.Hour() < n.digestHour {
+		return 0, nil
+	}
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	users, err := n.repo.DigestRecipients(day)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	var errs []error
+	for _, u := range users {
+		claimed, err := n.repo.ClaimDigest(u.UserID, day)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+		prs, err := n.repo.GetPRsForUser(u.UserID)
+		if err != nil {
+			errs = append(errs, err)
+			_ = n.repo.ReleaseDigest(u.UserID, day)
+			continue
+		}
+		var open []*models.PullRequestShortResp
+		for _, pr := range prs {
+			if pr.Status == "OPEN" {
+				open = append(open, pr)
+			}
+		}
+		if len(open) == 0 {
+			continue
+		}
+
+		subject, body, err := n.templates.Render(TemplateDigest, DigestData{Username: u.Username, Date: day, PullRequests: open})
+		if err == nil {
+			err = n.sender.Send(u.Email, subject, body)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("digest to %s: %w", u.UserID, err))
+			if !permanent(err) {
+				_ = n.repo.ReleaseDigest(u.UserID, day)
+			}
+			continue
+		}
+		sent++
+	}
+	return sent, errors.Join(errs...)
+}
+
+// permanent reports whether the SMTP server rejected an email with a 5xx
+// reply, which retrying will not fix.
+func permanent(err error) bool {
+	var tpErr *textproto.Error
+	return errors.As(err, &tpErr) && tpErr.Code >= 500
+}
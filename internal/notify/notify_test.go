@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/services"
+	"github.com/example/prreview/internal/testdb"
+)
+
+// newTestRepo migrates a fresh database; see internal/testdb.
+func newTestRepo(t *testing.T) *repo.SQLRepo {
+	return repo.NewSQLRepo(testdb.New(t, repo.RunMigrations).DB)
+}
+
+func TestNotifier(t *testing.T) {
+	r := newTestRepo(t)
+	srv := newSMTPStandIn(t, "carol@example.com")
+	cfg := srv.config()
+	cfg.DigestHour = 9
+	cfg.Timezone = "Europe/Moscow"
+
+	_, err := r.CreateTeam("backend", []models.TeamMemberResp{
+		{UserID: "u1", Username: "Alice", IsActive: true},
+		{UserID: "u2", Username: "Bob", IsActive: true},
+		{UserID: "u3", Username: "Carol", IsActive: true},
+		{UserID: "u4", Username: "Dan", IsActive: true},
+	})
+	require.NoError(t, err)
+	off := false
+	for id, upd := range map[string]repo.UserUpdate{
+		"u2": {Email: strPtr("bob@example.com")},
+		"u3": {Email: strPtr("carol@example.com")},
+		"u4": {Email: strPtr("dan@example.com"), NotifyAssignments: &off},
+	} {
+		_, err := r.UpdateUser(id, upd)
+		require.NoError(t, err)
+	}
+
+	svcs := services.NewServices(r, config.ReviewersConfig{PerPR: 3, RequiredApprovals: 1}, config.Default().SLA, cfg)
+	_, err = svcs.PR.CreatePR("pr-1", "Add search", "u1", "", nil)
+	require.NoError(t, err)
+
+	n, err := newNotifier(r, cfg, NewSMTP(cfg))
+	require.NoError(t, err)
+
+	// Bob is emailed; Carol's address is rejected for good and Dan opted out.
+	sent, err := n.SendQueued()
+	require.Equal(t, 1, sent)
+	require.ErrorContains(t, err, "to u3")
+	msgs := srv.messages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, []string{"bob@example.com"}, msgs[0].To)
+	require.Equal(t, "Review requested: Add search (pr-1)", msgs[0].Subject)
+
+	sent, err = n.SendQueued()
+	require.NoError(t, err)
+	require.Zero(t, sent, "the queue is empty")
+
+	// A reassignment that fails queues nothing: everyone else already reviews.
+	_, _, err = svcs.PR.Reassign("pr-1", "u2", nil)
+	require.ErrorIs(t, err, services.ErrNoCandidate)
+	sent, err = n.SendQueued()
+	require.NoError(t, err)
+	require.Zero(t, sent)
+
+	// Digests go out once a day after 9:00 Moscow time.
+	n.now = func() time.Time { return time.Date(2024, 5, 6, 5, 0, 0, 0, time.UTC) }
+	sent, err = n.SendDigests()
+	require.NoError(t, err)
+	require.Zero(t, sent)
+
+	n.now = func() time.Time { return time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC) }
+	sent, err = n.SendDigests()
+	require.Equal(t, 2, sent, "Bob and Dan; Carol is rejected")
+	require.ErrorContains(t, err, "digest to u3")
+	digests := srv.messages()[1:]
+	require.Len(t, digests, 2)
+	require.Equal(t, "1 open review(s) on 2024-05-06", digests[0].Subject)
+	require.Contains(t, digests[0].Body, `pr-1 "Add search" by u1`)
+
+	sent, err = n.SendDigests()
+	require.NoError(t, err)
+	require.Zero(t, sent, "already sent today")
+
+	_, err = r.UpdateUser("u2", repo.UserUpdate{NotifyDigest: &off})
+	require.NoError(t, err)
+	n.now = func() time.Time { return time.Date(2024, 5, 7, 7, 0, 0, 0, time.UTC) }
+	sent, err = n.SendDigests()
+	require.ErrorContains(t, err, "digest to u3")
+	require.Equal(t, 1, sent, "Bob opted out")
+}
+
+func TestSLANotifications(t *testing.T) {
+	r := newTestRepo(t)
+	srv := newSMTPStandIn(t)
+	cfg := srv.config()
+
+	_, err := r.CreateTeam("backend", []models.TeamMemberResp{
+		{UserID: "u1", Username: "Alice", IsActive: true},
+		{UserID: "u2", Username: "Bob", IsActive: true},
+	})
+	require.NoError(t, err)
+	_, err = r.CreateTeam("leads", []models.TeamMemberResp{{UserID: "u9", Username: "Lena", IsActive: true}})
+	require.NoError(t, err)
+	for id, email := range map[string]string{"u2": "bob@example.com", "u9": "lena@example.com"} {
+		_, err := r.UpdateUser(id, repo.UserUpdate{Email: strPtr(email)})
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.SetTeamSLA("backend", nil, nil, strPtr("u9"), nil))
+
+	sla := config.SLAConfig{FirstResponse: 4 * time.Hour, ReassignAfter: time.Hour, EscalateAfter: 2 * time.Hour}
+	svcs := services.NewServices(r, config.ReviewersConfig{PerPR: 2, RequiredApprovals: 1}, sla, cfg)
+	_, err = svcs.PR.CreatePR("pr-1", "Add search", "u1", "", nil)
+	require.NoError(t, err)
+	n, err := newNotifier(r, cfg, NewSMTP(cfg))
+	require.NoError(t, err)
+	_, err = n.SendQueued()
+	require.NoError(t, err)
+
+	backdate := func(d time.Duration) {
+		_, err := r.DB.Exec("UPDATE pr_reviewers SET assigned_at = now() - make_interval(secs => $1)", d.Seconds())
+		require.NoError(t, err)
+	}
+
+	// Bob is reminded once the first response is overdue.
+	backdate(4*time.Hour + time.Minute)
+	events, err := svcs.SLA.Check()
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, services.SLARemind, events[0].Action)
+	sent, err := n.SendQueued()
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+	msgs := srv.messages()
+	require.Equal(t, []string{"bob@example.com"}, msgs[len(msgs)-1].To)
+	require.Equal(t, "Review overdue: Add search (pr-1)", msgs[len(msgs)-1].Subject)
+
+	// Nobody can take over from Bob, so the review goes to the team lead.
+	backdate(7 * time.Hour)
+	events, err = svcs.SLA.Check()
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, services.SLAEscalate, events[0].Action)
+	sent, err = n.SendQueued()
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+	msgs = srv.messages()
+	require.Equal(t, []string{"lena@example.com"}, msgs[len(msgs)-1].To)
+	require.Equal(t, "Overdue review escalated: Add search (pr-1)", msgs[len(msgs)-1].Subject)
+	require.Contains(t, msgs[len(msgs)-1].Body, "assigned to u2")
+}
+
+func strPtr(s string) *string { return &s }
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/example/prreview/internal/config"
+)
+
+// Sender delivers one email.
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// SMTP sends plain-text UTF-8 emails through an SMTP server, upgrading the
+// connection with STARTTLS when the server offers it.
+type SMTP struct {
+	Addr string
+	From string
+	// Auth is nil for servers that do not require it.
+	Auth smtp.Auth
+}
+
+func NewSMTP(cfg config.EmailConfig) *SMTP {
+	s := &SMTP{Addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort), From: cfg.From}
+	if cfg.Username != "" {
+		s.Auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)
+	}
+	return s
+}
+
+func (s *SMTP) Send(to, subject, body string) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("from address: %w", err)
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("recipient address: %w", err)
+	}
+	msg, err := message(from, rcpt, subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, s.Auth, from.Address, []string{rcpt.Address}, msg)
+}
+
+func message(from, to *mail.Address, subject, body string, at time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", at.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body = strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
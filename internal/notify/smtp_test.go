@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/config"
+)
+
+// received is an email accepted by the SMTP stand-in.
+type received struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// smtpStandIn is an in-process SMTP server that accepts every message except
+// those for the addresses in reject, which it refuses with 550.
+type smtpStandIn struct {
+	ln     net.Listener
+	reject map[string]bool
+
+	mu   sync.Mutex
+	msgs []received
+}
+
+func newSMTPStandIn(t *testing.T, reject ...string) *smtpStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpStandIn{ln: ln, reject: map[string]bool{}}
+	for _, r := range reject {
+		s.reject[r] = true
+	}
+	go s.serve(t)
+	t.Cleanup(func() { _ = ln.Close() })
+	return s
+}
+
+func (s *smtpStandIn) config() config.EmailConfig {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	cfg := config.Default().Email
+	cfg.Enabled = true
+	cfg.SMTPHost = host
+	cfg.SMTPPort = port
+	cfg.From = "PR Review <prreview@example.com>"
+	return cfg
+}
+
+func (s *smtpStandIn) messages() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.msgs...)
+}
+
+func (s *smtpStandIn) serve(t *testing.T) {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(t, textproto.NewConn(conn))
+	}
+}
+
+func (s *smtpStandIn) handle(t *testing.T, c *textproto.Conn) {
+	defer c.Close()
+	var msg received
+	_ = c.PrintfLine("220 stand-in ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(strings.TrimPrefix(line, strings.SplitN(line, " ", 2)[0]))
+		switch verb {
+		case "EHLO", "HELO":
+			_ = c.PrintfLine("250 stand-in")
+		case "MAIL":
+			msg = received{From: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")}
+			_ = c.PrintfLine("250 OK")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if s.reject[to] {
+				_ = c.PrintfLine("550 no such user")
+				continue
+			}
+			msg.To = append(msg.To, to)
+			_ = c.PrintfLine("250 OK")
+		case "DATA":
+			_ = c.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(c.DotReader())
+			if err != nil {
+				return
+			}
+			parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+			if err != nil {
+				t.Errorf("stand-in: bad message: %v", err)
+				return
+			}
+			msg.Subject, _ = new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+			msg.Body = strings.ReplaceAll(string(body), "\r\n", "\n")
+			s.mu.Lock()
+			s.msgs = append(s.msgs, msg)
+			s.mu.Unlock()
+			_ = c.PrintfLine("250 queued")
+		case "RSET", "NOOP":
+			_ = c.PrintfLine("250 OK")
+		case "QUIT":
+			_ = c.PrintfLine("221 bye")
+			return
+		default:
+			_ = c.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	srv := newSMTPStandIn(t, "gone@example.com")
+	sender := NewSMTP(srv.config())
+
+	body := "Привет, Alice!\nA long line " + strings.Repeat("x", 100) + "\n"
+	require.NoError(t, sender.Send("Alice <alice@example.com>", "Ревью: pr-1", body))
+
+	msgs := srv.messages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, "prreview@example.com", msgs[0].From)
+	require.Equal(t, []string{"alice@example.com"}, msgs[0].To)
+	require.Equal(t, "Ревью: pr-1", msgs[0].Subject)
+	require.Equal(t, body, msgs[0].Body)
+
+	err := sender.Send("gone@example.com", "s", "b")
+	require.Error(t, err)
+	require.True(t, permanent(err))
+
+	require.Error(t, sender.Send("not an address", "s", "b"))
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/example/prreview/internal/models"
+)
+
+// Template names. The file <name>.tmpl defines a "subject" and a "body"
+// template.
+const (
+	TemplateAssigned      = "assigned"
+	TemplateReassigned    = "reassigned"
+	TemplateSLAReminder   = "sla_reminder"
+	TemplateSLAEscalation = "sla_escalation"
+	TemplateDigest        = "digest"
+)
+
+//go:embed templates/*.tmpl
+var builtin embed.FS
+
+// AssignmentData is passed to the assigned, reassigned and SLA templates.
+type AssignmentData struct {
+	Username        string
+	PullRequestID   string
+	PullRequestName string
+	AuthorID        string
+	TeamName        string
+	// PreviousReviewerID is set on reassignment, ReviewerID on escalation to
+	// the team lead.
+	PreviousReviewerID string
+	ReviewerID         string
+}
+
+// DigestData is passed to the digest template.
+type DigestData struct {
+	Username     string
+	Date         time.Time
+	PullRequests []*models.PullRequestShortResp
+}
+
+type Templates struct {
+	sets map[string]*template.Template
+}
+
+// LoadTemplates parses the templates in dir, using the built-in ones for the
+// files dir does not have. An empty dir means built-in templates only.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{sets: map[string]*template.Template{}}
+	for _, name := range []string{TemplateAssigned, TemplateReassigned, TemplateSLAReminder, TemplateSLAEscalation, TemplateDigest} {
+		file := name + ".tmpl"
+		var src []byte
+		if dir != "" {
+			data, err := os.ReadFile(filepath.Join(dir, file))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			src = data
+		}
+		if src == nil {
+			data, err := builtin.ReadFile("templates/" + file)
+			if err != nil {
+				return nil, err
+			}
+			src = data
+		}
+
+		set, err := template.New(file).Option("missingkey=error").Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("email template %s: %w", file, err)
+		}
+		if set.Lookup("subject") == nil || set.Lookup("body") == nil {
+			return nil, fmt.Errorf("email template %s: must define \"subject\" and \"body\"", file)
+		}
+		t.sets[name] = set
+	}
+	return t, nil
+}
+
+// Render executes the named template. The subject is collapsed to one line.
+func (t *Templates) Render(name string, data interface{}) (subject, body string, err error) {
+	set, ok := t.sets[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown email template %q", name)
+	}
+	var buf bytes.Buffer
+	if err := set.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", err
+	}
+	subject = strings.Join(strings.Fields(buf.String()), " ")
+	buf.Reset()
+	if err := set.ExecuteTemplate(&buf, "body", data); err != nil {
+		return "", "", err
+	}
+	return subject, strings.TrimSpace(buf.String()) + "\n", nil
+}
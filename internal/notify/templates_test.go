@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/models"
+)
+
+func TestBuiltinTemplates(t *testing.T) {
+	tmpl, err := LoadTemplates("")
+	require.NoError(t, err)
+
+	subject, body, err := tmpl.Render(TemplateReassigned, AssignmentData{
+		Username: "Bob", PullRequestID: "pr-1", PullRequestName: "Add search",
+		AuthorID: "u1", TeamName: "backend", PreviousReviewerID: "u3",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Review reassigned to you: Add search (pr-1)", subject)
+	require.Contains(t, body, "Hi Bob,")
+	require.Contains(t, body, "in team backend was handed over to you from u3.")
+
+	subject, body, err = tmpl.Render(TemplateSLAEscalation, AssignmentData{
+		Username: "Lena", PullRequestID: "pr-1", PullRequestName: "Add search",
+		AuthorID: "u1", TeamName: "backend", ReviewerID: "u3",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Overdue review escalated: Add search (pr-1)", subject)
+	require.Contains(t, body, "assigned to u3 is past its deadline")
+
+	subject, _, err = tmpl.Render(TemplateSLAReminder, AssignmentData{
+		Username: "Bob", PullRequestID: "pr-1", PullRequestName: "Add search", AuthorID: "u1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Review overdue: Add search (pr-1)", subject)
+
+	subject, body, err = tmpl.Render(TemplateDigest, DigestData{
+		Username: "Bob",
+		Date:     time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC),
+		PullRequests: []*models.PullRequestShortResp{
+			{PullRequestID: "pr-1", PullRequestName: "Add search", AuthorID: "u1"},
+			{PullRequestID: "pr-2", PullRequestName: "Fix login", AuthorID: "u3"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2 open review(s) on 2024-05-06", subject)
+	require.Contains(t, body, "  - pr-1 \"Add search\" by u1\n  - pr-2 \"Fix login\" by u3\n")
+}
+
+func TestTemplatesDirOverridesBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "assigned.tmpl"),
+		[]byte(`{{define "subject"}}Новое ревью
+{{.PullRequestID}}{{end}}{{define "body"}}{{.Username}}, посмотрите {{.PullRequestName}}{{end}}`), 0o644))
+
+	tmpl, err := LoadTemplates(dir)
+	require.NoError(t, err)
+	subject, body, err := tmpl.Render(TemplateAssigned, AssignmentData{Username: "Боб", PullRequestID: "pr-1", PullRequestName: "Поиск"})
+	require.NoError(t, err)
+	require.Equal(t, "Новое ревью pr-1", subject)
+	require.Equal(t, "Боб, посмотрите Поиск\n", body)
+
+	// Files missing from the directory fall back to the built-in templates.
+	_, _, err = tmpl.Render(TemplateDigest, DigestData{Username: "Bob"})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "digest.tmpl"), []byte(`{{define "subject"}}x{{end}}`), 0o644))
+	_, err = LoadTemplates(dir)
+	require.ErrorContains(t, err, `must define "subject" and "body"`)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "digest.tmpl"), []byte(`{{define "subject"}}{{.Nope}`), 0o644))
+	_, err = LoadTemplates(dir)
+	require.ErrorContains(t, err, "digest.tmpl")
+}
@@ -0,0 +1,587 @@
+// Package openapi validates requests and responses against the OpenAPI 3.0
+// document that describes the API (swagger-ui/openapi.yaml).
+//
+// Schemas are checked with a JSON Schema validator after translating the few
+// OpenAPI-only keywords the document uses (nullable). Parameters are checked
+// after converting their string values to the declared type; only JSON
+// bodies are checked.
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is a parsed OpenAPI document with its schemas compiled.
+type Spec struct {
+	routes []*route
+	// errorSchemas validate the bodies of error responses an operation does
+	// not declare, by media type.
+	errorSchemas map[string]*gojsonschema.Schema
+}
+
+type route struct {
+	path     string
+	segments []string
+	ops      map[string]*Operation
+}
+
+// Operation is a method on a path of the document.
+type Operation struct {
+	Method string
+	// Path is the path template, e.g. /scim/v2/Users/{id}.
+	Path string
+
+	params    []*parameter
+	body      *requestBody
+	responses map[string]*response
+	spec      *Spec
+}
+
+type parameter struct {
+	name     string
+	in       string
+	required bool
+	typ      string
+	schema   *gojsonschema.Schema
+}
+
+type requestBody struct {
+	required bool
+	content  map[string]*gojsonschema.Schema
+}
+
+type response struct {
+	// content maps media types to their schema, nil for media types that are
+	// not JSON or have no schema.
+	content map[string]*gojsonschema.Schema
+}
+
+// ValidationError lists what did not match the document.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+func invalid(format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Problems: []string{fmt.Sprintf(format, args...)}}
+}
+
+// Load reads and parses the document at path.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// Parse parses an OpenAPI 3.0 document in YAML or JSON.
+func Parse(data []byte) (*Spec, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	doc, ok := normalize(raw).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("document is not an object")
+	}
+	p := &parser{doc: doc, components: toJSONSchema(doc["components"])}
+	return p.parse()
+}
+
+type parser struct {
+	doc map[string]interface{}
+	// components is the components section in JSON Schema form; it is
+	// embedded in every compiled schema so that local $refs resolve.
+	components interface{}
+}
+
+func (p *parser) parse() (*Spec, error) {
+	spec := &Spec{errorSchemas: map[string]*gojsonschema.Schema{}}
+	for mediaType, name := range map[string]string{
+		"application/json":      "ErrorResponse",
+		"application/scim+json": "ScimError",
+	} {
+		if p.lookup("#/components/schemas/"+name) == nil {
+			continue
+		}
+		s, err := p.compile(map[string]interface{}{"$ref": "#/components/schemas/" + name})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		spec.errorSchemas[mediaType] = s
+	}
+
+	paths, _ := p.doc["paths"].(map[string]interface{})
+	for _, path := range sortedKeys(paths) {
+		item, _ := paths[path].(map[string]interface{})
+		rt := &route{path: path, segments: strings.Split(path, "/"), ops: map[string]*Operation{}}
+		shared, _ := item["parameters"].([]interface{})
+		for key, v := range item {
+			method := strings.ToUpper(key)
+			if !isMethod(method) {
+				continue
+			}
+			op, err := p.operation(spec, method, path, shared, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			rt.ops[method] = op
+		}
+		spec.routes = append(spec.routes, rt)
+	}
+	// Literal segments win over templated ones, as in the routers.
+	sort.SliceStable(spec.routes, func(i, j int) bool {
+		return strings.Count(spec.routes[i].path, "{") < strings.Count(spec.routes[j].path, "{")
+	})
+	return spec, nil
+}
+
+func (p *parser) operation(spec *Spec, method, path string, shared []interface{}, v interface{}) (*Operation, error) {
+	raw, _ := p.resolve(v).(map[string]interface{})
+	op := &Operation{Method: method, Path: path, responses: map[string]*response{}, spec: spec}
+
+	own, _ := raw["parameters"].([]interface{})
+	seen := map[string]bool{}
+	// Operation parameters override path-level ones with the same name.
+	for _, list := range [][]interface{}{own, shared} {
+		for _, pv := range list {
+			pm, _ := p.resolve(pv).(map[string]interface{})
+			name, _ := pm["name"].(string)
+			in, _ := pm["in"].(string)
+			if seen[in+" "+name] {
+				continue
+			}
+			seen[in+" "+name] = true
+			param := &parameter{name: name, in: in}
+			param.required, _ = pm["required"].(bool)
+			if schema, ok := pm["schema"]; ok {
+				s, err := p.compile(schema)
+				if err != nil {
+					return nil, fmt.Errorf("parameter %s: %w", name, err)
+				}
+				param.schema = s
+				if sm, ok := p.resolve(schema).(map[string]interface{}); ok {
+					param.typ, _ = sm["type"].(string)
+				}
+			}
+			op.params = append(op.params, param)
+		}
+	}
+
+	if rb, ok := raw["requestBody"]; ok {
+		bm, _ := p.resolve(rb).(map[string]interface{})
+		content, err := p.content(bm["content"])
+		if err != nil {
+			return nil, fmt.Errorf("request body: %w", err)
+		}
+		op.body = &requestBody{content: content}
+		op.body.required, _ = bm["required"].(bool)
+	}
+
+	responses, _ := raw["responses"].(map[string]interface{})
+	for status, rv := range responses {
+		rm, _ := p.resolve(rv).(map[string]interface{})
+		content, err := p.content(rm["content"])
+		if err != nil {
+			return nil, fmt.Errorf("response %s: %w", status, err)
+		}
+		op.responses[strings.ToUpper(status)] = &response{content: content}
+	}
+	return op, nil
+}
+
+func (p *parser) content(v interface{}) (map[string]*gojsonschema.Schema, error) {
+	cm, _ := v.(map[string]interface{})
+	out := map[string]*gojsonschema.Schema{}
+	for mediaType, mv := range cm {
+		mm, _ := mv.(map[string]interface{})
+		schema, ok := mm["schema"]
+		if !ok || !isJSON(mediaType) {
+			out[mediaType] = nil
+			continue
+		}
+		s, err := p.compile(schema)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mediaType, err)
+		}
+		out[mediaType] = s
+	}
+	return out, nil
+}
+
+func (p *parser) compile(schema interface{}) (*gojsonschema.Schema, error) {
+	doc := map[string]interface{}{
+		"allOf":      []interface{}{toJSONSchema(schema)},
+		"components": p.components,
+	}
+	return gojsonschema.NewSchema(gojsonschema.NewGoLoader(doc))
+}
+
+// resolve follows a local $ref such as #/components/parameters/X.
+func (p *parser) resolve(v interface{}) interface{} {
+	for i := 0; i < 10; i++ {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return v
+		}
+		v = p.lookup(ref)
+	}
+	return v
+}
+
+func (p *parser) lookup(ref string) interface{} {
+	var cur interface{} = p.doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")]
+	}
+	return cur
+}
+
+// toJSONSchema returns a copy of an OpenAPI schema in JSON Schema form:
+// "nullable: true" becomes a "null" type.
+func toJSONSchema(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = toJSONSchema(e)
+		}
+		if nullable, _ := v["nullable"].(bool); nullable {
+			delete(out, "nullable")
+			if t, ok := v["type"].(string); ok {
+				out["type"] = []interface{}{t, "null"}
+			}
+			if enum, ok := v["enum"].([]interface{}); ok {
+				out["enum"] = append(append([]interface{}(nil), enum...), nil)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = toJSONSchema(e)
+		}
+		return out
+	}
+	return v
+}
+
+// normalize turns YAML mappings with non-string keys, such as unquoted
+// response codes, into JSON objects.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[fmt.Sprint(k)] = normalize(e)
+		}
+		return out
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+	}
+	return v
+}
+
+// Find returns the operation for method and path with the values of its path
+// parameters, or nil if the document does not describe the path or method.
+func (s *Spec) Find(method, path string) (*Operation, map[string]string) {
+	segments := strings.Split(path, "/")
+	for _, rt := range s.routes {
+		params, ok := rt.match(segments)
+		if !ok {
+			continue
+		}
+		op := rt.ops[method]
+		if op == nil && method == http.MethodHead {
+			op = rt.ops[http.MethodGet]
+		}
+		if op == nil {
+			return nil, nil
+		}
+		return op, params
+	}
+	return nil, nil
+}
+
+func (rt *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, seg := range rt.segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = segments[i]
+			continue
+		}
+		if seg != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ValidateRequest checks the parameters and body of r. The body is read and
+// replaced, so handlers can still read it.
+func (op *Operation) ValidateRequest(r *http.Request, pathParams map[string]string) error {
+	var problems []string
+	query := r.URL.Query()
+	for _, p := range op.params {
+		var values []string
+		switch p.in {
+		case "query":
+			values = query[p.name]
+		case "header":
+			values = r.Header.Values(p.name)
+		case "path":
+			if v, ok := pathParams[p.name]; ok {
+				values = []string{v}
+			}
+		default:
+			continue
+		}
+		if len(values) == 0 || (p.in == "query" && values[0] == "" && p.required) {
+			if p.required {
+				problems = append(problems, fmt.Sprintf("%s parameter %s is required", p.in, p.name))
+			}
+			continue
+		}
+		if p.schema == nil {
+			continue
+		}
+		value, err := convert(values[0], p.typ)
+		if err == nil {
+			err = check(p.schema, value, p.name)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s parameter %s: %v", p.in, p.name, err))
+		}
+	}
+
+	if op.body != nil {
+		if err := op.validateBody(r); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (op *Operation) validateBody(r *http.Request) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		if op.body.required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+	data, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("request body: %v", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		if op.body.required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+
+	schema, ok := op.body.schemaFor(r.Header.Get("Content-Type"))
+	if !ok || schema == nil {
+		return nil
+	}
+	var v interface{}
+	if err := decodeJSON(data, &v); err != nil {
+		return fmt.Errorf("request body is not valid JSON: %v", err)
+	}
+	if err := check(schema, v, "request body"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// schemaFor picks the schema for the request's media type. Clients that send
+// JSON without a JSON Content-Type (curl -d does) are checked against the
+// JSON schema when the operation accepts nothing else.
+func (b *requestBody) schemaFor(contentType string) (*gojsonschema.Schema, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if s, ok := b.content[mediaType]; ok {
+		return s, true
+	}
+	if len(b.content) == 1 {
+		for mt, s := range b.content {
+			return s, isJSON(mt)
+		}
+	}
+	return nil, false
+}
+
+// ValidateResponse checks a response of the operation. Error responses the
+// operation does not declare must still be in the document's error format
+// (ErrorResponse, or ScimError for SCIM media types).
+func (op *Operation) ValidateResponse(status int, header http.Header, body []byte) error {
+	resp := op.responses[strconv.Itoa(status)]
+	if resp == nil {
+		resp = op.responses[fmt.Sprintf("%dXX", status/100)]
+	}
+	if resp == nil {
+		resp = op.responses["DEFAULT"]
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+
+	if resp == nil {
+		if status < 400 {
+			return invalid("status %d is not documented", status)
+		}
+		schema := op.spec.errorSchemas[mediaType]
+		if schema == nil {
+			return invalid("status %d is not documented and its %q body is not an error response", status, mediaType)
+		}
+		return checkBody(schema, body)
+	}
+
+	if len(resp.content) == 0 {
+		if len(bytes.TrimSpace(body)) > 0 {
+			return invalid("status %d is documented without a body", status)
+		}
+		return nil
+	}
+	schema, ok := resp.content[mediaType]
+	if !ok {
+		return invalid("status %d: Content-Type %q is not documented", status, mediaType)
+	}
+	if schema == nil {
+		return nil
+	}
+	return checkBody(schema, body)
+}
+
+func checkBody(schema *gojsonschema.Schema, body []byte) error {
+	var v interface{}
+	if err := decodeJSON(body, &v); err != nil {
+		return invalid("response body is not valid JSON: %v", err)
+	}
+	return check(schema, v, "response body")
+}
+
+func check(schema *gojsonschema.Schema, v interface{}, what string) error {
+	res, err := schema.Validate(gojsonschema.NewGoLoader(v))
+	if err != nil {
+		return invalid("%s: %v", what, err)
+	}
+	if res.Valid() {
+		return nil
+	}
+	e := &ValidationError{}
+	for _, re := range res.Errors() {
+		// The allOf wrapper of every schema only repeats the errors below it.
+		if re.Type() == "number_all_of" {
+			continue
+		}
+		field := re.Field()
+		if field == "(root)" {
+			e.Problems = append(e.Problems, fmt.Sprintf("%s: %s", what, re.Description()))
+			continue
+		}
+		e.Problems = append(e.Problems, fmt.Sprintf("%s: %s: %s", what, field, re.Description()))
+	}
+	return e
+}
+
+// convert turns a parameter value into the JSON value of its type.
+func convert(s, typ string) (interface{}, error) {
+	switch typ {
+	case "integer":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return n, nil
+	case "number":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return f, nil
+	case "boolean":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	}
+	return s, nil
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
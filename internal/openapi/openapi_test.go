@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func loadSpec(t *testing.T) *Spec {
+	t.Helper()
+	spec, err := Load("../../swagger-ui/openapi.yaml")
+	require.NoError(t, err)
+	return spec
+}
+
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": {"application/json"}}
+}
+
+func TestFind(t *testing.T) {
+	spec := loadSpec(t)
+
+	op, params := spec.Find("GET", "/scim/v2/Users/u1")
+	require.NotNil(t, op)
+	require.Equal(t, "/scim/v2/Users/{id}", op.Path)
+	require.Equal(t, map[string]string{"id": "u1"}, params)
+
+	op, _ = spec.Find("GET", "/scim/v2/Users")
+	require.Equal(t, "/scim/v2/Users", op.Path)
+
+	op, params = spec.Find("POST", "/api/v1/pull-requests/pr-1/merge")
+	require.Equal(t, "/api/v1/pull-requests/{id}/merge", op.Path)
+	require.Equal(t, map[string]string{"id": "pr-1"}, params)
+
+	op, _ = spec.Find("HEAD", "/team/get")
+	require.Equal(t, "GET", op.Method)
+
+	for _, c := range []struct{ method, path string }{
+		{"GET", "/ui/teams"},
+		{"GET", "/scim/v2/Users/"},
+		{"DELETE", "/team/get"},
+		{"DELETE", "/api/v1/teams/backend"},
+	} {
+		op, _ = spec.Find(c.method, c.path)
+		require.Nil(t, op, c.method+" "+c.path)
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	spec := loadSpec(t)
+	validate := func(method, target, body string, header http.Header) error {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, target, r)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		op, params := spec.Find(method, req.URL.Path)
+		require.NotNil(t, op, target)
+		return op.ValidateRequest(req, params)
+	}
+
+	require.NoError(t, validate("GET", "/team/get?team_name=backend", "", nil))
+	require.EqualError(t, validate("GET", "/team/get", "", nil), "query parameter team_name is required")
+	require.EqualError(t, validate("GET", "/users/absences/handoffs?absence_id=x", "", nil), "query parameter absence_id: must be an integer")
+	require.NoError(t, validate("GET", "/users/absences/list?user_id=u1&include_past=true", "", nil))
+	require.Error(t, validate("GET", "/bulk/export?format=xml", "", nil))
+
+	require.EqualError(t, validate("POST", "/pullRequest/merge", "", jsonHeader()), "request body is required")
+	require.EqualError(t, validate("POST", "/pullRequest/merge", "{", jsonHeader()), "request body is not valid JSON: unexpected EOF")
+	require.EqualError(t, validate("POST", "/pullRequest/merge", `{"pull_request_id": 1}`, jsonHeader()),
+		"request body: pull_request_id: Invalid type. Expected: string, given: integer")
+	require.EqualError(t, validate("POST", "/pullRequest/reassign", `{"pull_request_id": "pr-1"}`, jsonHeader()),
+		"request body: old_reviewer_id is required")
+	require.NoError(t, validate("POST", "/pullRequest/reassign", `{"pull_request_id": "pr-1", "old_reviewer_id": "u2"}`, jsonHeader()))
+
+	// curl -d sends JSON as a form.
+	require.Error(t, validate("POST", "/pullRequest/merge", `{}`, http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}))
+
+	// nullable
+	require.NoError(t, validate("POST", "/team/setMaxOpenReviews", `{"team_name": "backend", "max_open_reviews": null}`, jsonHeader()))
+	require.Error(t, validate("POST", "/team/setMaxOpenReviews", `{"team_name": "backend", "max_open_reviews": -1}`, jsonHeader()))
+
+	require.NoError(t, validate("POST", "/api/v1/pull-requests/pr-1/merge", "", nil))
+	require.EqualError(t, validate("PUT", "/api/v1/teams/backend", `{"required_approvals": 2}`, jsonHeader()),
+		"request body: members is required")
+
+	longKey := http.Header{"Content-Type": {"application/json"}, "Idempotency-Key": {strings.Repeat("k", 256)}}
+	require.Error(t, validate("POST", "/pullRequest/merge", `{"pull_request_id": "pr-1"}`, longKey))
+
+	// Only JSON bodies are checked.
+	require.NoError(t, validate("POST", "/bulk/import", "team_name,user_id\n", http.Header{"Content-Type": {"text/csv"}}))
+	require.Error(t, validate("POST", "/bulk/import", `{"team_name": "backend"}`, jsonHeader()))
+	require.Error(t, validate("PATCH", "/scim/v2/Users/u1", `{"Operations": [{"op": "move"}]}`,
+		http.Header{"Content-Type": {"application/scim+json"}}))
+}
+
+func TestValidateRequestKeepsBody(t *testing.T) {
+	spec := loadSpec(t)
+	body := `{"pull_request_id": "pr-1"}`
+	req := httptest.NewRequest("POST", "/pullRequest/merge", strings.NewReader(body))
+	op, params := spec.Find(req.Method, req.URL.Path)
+	require.NoError(t, op.ValidateRequest(req, params))
+
+	got, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, string(got))
+}
+
+func TestValidateResponse(t *testing.T) {
+	spec := loadSpec(t)
+	validate := func(method, path string, status int, header http.Header, body string) error {
+		op, _ := spec.Find(method, path)
+		require.NotNil(t, op, path)
+		return op.ValidateResponse(status, header, []byte(body))
+	}
+
+	team := `{"team": {"team_name": "backend", "members": [{"user_id": "u1", "username": "Alice", "is_active": true}]}}`
+	require.NoError(t, validate("GET", "/team/get", 200, jsonHeader(), team))
+	require.EqualError(t, validate("GET", "/team/get", 200, jsonHeader(), `{"team": {"team_name": "backend", "members": null}}`),
+		"response body: team.members: Invalid type. Expected: array, given: null")
+	require.EqualError(t, validate("GET", "/team/get", 200, http.Header{"Content-Type": {"text/plain"}}, "backend"),
+		`status 200: Content-Type "text/plain" is not documented`)
+
+	// Undocumented errors must still be ErrorResponse.
+	require.NoError(t, validate("GET", "/team/get", 500, jsonHeader(), `{"error": {"code": "INTERNAL", "message": "db is down"}}`))
+	require.Error(t, validate("GET", "/team/get", 500, jsonHeader(), `{"error": {"code": "OOPS", "message": "db is down"}}`))
+	require.Error(t, validate("GET", "/team/get", 400, http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, "team_name required\n"))
+	require.EqualError(t, validate("GET", "/team/get", 204, nil, ""), "status 204 is not documented")
+
+	require.NoError(t, validate("DELETE", "/scim/v2/Users/u1", 204, nil, ""))
+	require.EqualError(t, validate("DELETE", "/scim/v2/Users/u1", 204, nil, "{}"), "status 204 is documented without a body")
+	require.NoError(t, validate("DELETE", "/scim/v2/Users/u1", 403, http.Header{"Content-Type": {"application/scim+json"}},
+		`{"schemas": ["urn:ietf:params:scim:api:messages:2.0:Error"], "status": "403", "detail": "SCIM requires an admin token"}`))
+
+	// nullable
+	require.NoError(t, validate("POST", "/team/setRequiredApprovals", 200, jsonHeader(), `{"team_name": "backend", "required_approvals": null}`))
+
+	require.NoError(t, validate("GET", "/bulk/export", 200, http.Header{"Content-Type": {"text/csv"}}, "team_name,user_id\n"))
+}
@@ -0,0 +1,25 @@
+package ratelimit
+
+import "github.com/example/prreview/internal/repo"
+
+// Postgres keeps buckets in the rate_limit_buckets table so that all replicas
+// share the same limits.
+type Postgres struct {
+	repos *repo.SQLRepo
+}
+
+func NewPostgres(repos *repo.SQLRepo) *Postgres {
+	return &Postgres{repos: repos}
+}
+
+func (p *Postgres) Allow(key string, rule Rule) (Result, error) {
+	var allowed bool
+	tokens, err := p.repos.UpdateRateLimitBucket(key, float64(rule.Burst), func(tokens float64, elapsedSeconds float64) float64 {
+		tokens, allowed = Take(rule, tokens, secondsToDuration(elapsedSeconds))
+		return tokens
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result(rule, tokens, allowed), nil
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/example/prreview/internal/config"
+)
+
+// Rule describes a token bucket: Requests tokens are refilled every Per and the
+// bucket holds at most Burst tokens.
+type Rule struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func FromConfig(r config.RateLimitRule) Rule {
+	return Rule{Requests: r.Requests, Per: r.Per, Burst: r.Burst}
+}
+
+func (r Rule) ratePerSecond() float64 {
+	return float64(r.Requests) / r.Per.Seconds()
+}
+
+// RefillTime is how long an empty bucket takes to fill up completely.
+func (r Rule) RefillTime() time.Duration {
+	return secondsToDuration(float64(r.Burst) / r.ratePerSecond())
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token is available. Zero when allowed.
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(key string, rule Rule) (Result, error)
+}
+
+// result converts the bucket state after a take attempt into a Result.
+func result(rule Rule, tokens float64, allowed bool) Result {
+	rate := rule.ratePerSecond()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     rule.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     secondsToDuration((float64(rule.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// Take refills a bucket that held tokens elapsed ago and tries to take one.
+// It returns the new token count and whether the take succeeded.
+func Take(rule Rule, tokens float64, elapsed time.Duration) (float64, bool) {
+	tokens = math.Min(float64(rule.Burst), tokens+elapsed.Seconds()*rule.ratePerSecond())
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// Memory is a process-local limiter. Limits are not shared between replicas.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	swept   time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Allow(key string, rule Rule) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		m.buckets[key] = b
+	}
+	tokens, allowed := Take(rule, b.tokens, now.Sub(b.last))
+	res := result(rule, tokens, allowed)
+	b.tokens, b.last, b.full = tokens, now, now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again, so
+// one-off clients do not accumulate forever.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for k, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTokenBucket(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	rule := Rule{Requests: 60, Per: time.Minute, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		res, err := m.Allow("k", rule)
+		require.NoError(t, err)
+		require.True(t, res.Allowed)
+		require.Equal(t, 2-i, res.Remaining)
+	}
+
+	res, err := m.Allow("k", rule)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, time.Second, res.RetryAfter)
+	require.Equal(t, 3*time.Second, res.Reset)
+
+	other, err := m.Allow("other", rule)
+	require.NoError(t, err)
+	require.True(t, other.Allowed)
+
+	now = now.Add(time.Second)
+	res, err = m.Allow("k", rule)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Equal(t, 0, res.Remaining)
+
+	now = now.Add(time.Hour)
+	res, err = m.Allow("k", rule)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Equal(t, 2, res.Remaining)
+}
@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/prreview/internal/models"
+)
+
+const absenceColumns = "id, user_id, starts_at, ends_at, reason, cancelled_at"
+
+func (r *SQLRepo) CreateAbsence(userID string, startsAt, endsAt time.Time, reason string) (*models.AbsenceResp, error) {
+	var exists bool
+	if err := r.DB.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id=$1)", userID); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	var a models.AbsenceResp
+	err := r.DB.Get(&a, `
+		INSERT INTO user_absences(user_id, starts_at, ends_at, reason) VALUES($1,$2,$3,$4)
+		RETURNING `+absenceColumns, userID, startsAt, endsAt, reason)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *SQLRepo) GetAbsence(id int64) (*models.AbsenceResp, error) {
+	var a models.AbsenceResp
+	err := r.DB.Get(&a, "SELECT "+absenceColumns+" FROM user_absences WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAbsenceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListAbsences returns the user's absences ordered by start. Unless
+// includePast is set, cancelled and finished absences are left out.
+func (r *SQLRepo) ListAbsences(userID string, includePast bool) ([]models.AbsenceResp, error) {
+	absences := []models.AbsenceResp{}
+	err := r.DB.Select(&absences, `
+		SELECT `+absenceColumns+`
+		FROM user_absences
+		WHERE user_id=$1 AND ($2 OR (cancelled_at IS NULL AND ends_at > now()))
+		ORDER BY starts_at
+	`, userID, includePast)
+	return absences, err
+}
+
+func (r *SQLRepo) CancelAbsence(id int64) (*models.AbsenceResp, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var a models.AbsenceResp
+	err = tx.Get(&a, `
+		UPDATE user_absences SET cancelled_at = COALESCE(cancelled_at, now())
+		WHERE id=$1
+		RETURNING `+absenceColumns, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAbsenceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE absence_handoffs SET status='OBSOLETE', resolved_at=now()
+		WHERE absence_id=$1 AND status='PENDING'
+	`, id); err != nil {
+		return nil, err
+	}
+	return &a, tx.Commit()
+}
+
+// OfferHandoffs records a pending handoff offer for every OPEN review assigned
+// to a user whose absence is in progress or starts within lookahead. Reviews
+// that already have an offer for the absence are skipped.
+func (r *SQLRepo) OfferHandoffs(lookahead time.Duration) ([]models.HandoffResp, error) {
+	offers := []models.HandoffResp{}
+	err := r.DB.Select(&offers, `
+		INSERT INTO absence_handoffs(absence_id, pr_id)
+		SELECT a.id, rv.pr_id
+		FROM user_absences a
+		JOIN pr_reviewers rv ON rv.user_id = a.user_id
+		JOIN prs p ON p.id = rv.pr_id AND p.status = 'OPEN'
+		WHERE a.cancelled_at IS NULL
+			AND a.ends_at > now()
+			AND a.starts_at < now() + $1 * interval '1 second'
+		ON CONFLICT DO NOTHING
+		RETURNING absence_id, pr_id, status, replaced_by
+	`, lookahead.Seconds())
+	return offers, err
+}
+
+func (r *SQLRepo) ListHandoffs(absenceID int64, statuses []string) ([]models.HandoffResp, error) {
+	handoffs := []models.HandoffResp{}
+	err := r.DB.Select(&handoffs, `
+		SELECT absence_id, pr_id, status, replaced_by
+		FROM absence_handoffs
+		WHERE absence_id=$1 AND (cardinality($2::text[]) = 0 OR status = ANY($2::text[]))
+		ORDER BY created_at, pr_id
+	`, absenceID, pq.Array(statuses))
+	return handoffs, err
+}
+
+func (r *SQLRepo) ResolveHandoff(absenceID int64, prID, status string, replacedBy *string) error {
+	_, err := r.DB.Exec(`
+		UPDATE absence_handoffs SET status=$3, replaced_by=$4, resolved_at=now()
+		WHERE absence_id=$1 AND pr_id=$2
+	`, absenceID, prID, status, replacedBy)
+	return err
+}
@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// effectiveLimitSQL resolves a user's review limit: the user's own limit, else
+// the lowest default among the user's teams, else the global default ($N).
+// NULL means unlimited.
+const effectiveLimitSQL = `COALESCE(
+	u.max_open_reviews,
+	(SELECT MIN(t.default_max_open_reviews) FROM teams t JOIN team_members m ON m.team_name = t.name WHERE m.user_id = u.id),
+	NULLIF(%s::int, 0)
+)`
+
+const openReviewsSQL = `(SELECT count(*) FROM pr_reviewers rv JOIN prs p ON p.id = rv.pr_id WHERE rv.user_id = u.id AND p.status = 'OPEN')`
+
+type UserLoad struct {
+	OpenReviews    int           `db:"open_reviews"`
+	MaxOpenReviews sql.NullInt64 `db:"max_open_reviews"`
+}
+
+func (r *SQLRepo) SetUserMaxOpenReviews(userID string, limit *int, ifMatch IfMatch) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := r.CheckUserVersionTx(tx, userID, ifMatch); err != nil {
+		return err
+	}
+	res, err := tx.Exec("UPDATE users SET max_open_reviews=$2, version = version + 1 WHERE id=$1", userID, limit)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+	return tx.Commit()
+}
+
+func (r *SQLRepo) SetTeamMaxOpenReviews(teamName string, limit *int, ifMatch IfMatch) error {
+	return r.updateTeam(teamName, ifMatch, "UPDATE teams SET default_max_open_reviews=$2, version = version + 1 WHERE name=$1", limit)
+}
+
+// updateTeam runs a single UPDATE of the team's row, query with the team
+// name as $1, if the team's version matches ifMatch.
+func (r *SQLRepo) updateTeam(teamName string, ifMatch IfMatch, query string, args ...interface{}) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := r.CheckTeamVersionTx(tx, teamName, ifMatch); err != nil {
+		return err
+	}
+	res, err := tx.Exec(query, append([]interface{}{teamName}, args...)...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTeamNotFound
+	}
+	return tx.Commit()
+}
+
+type teamSettings struct {
+	MaxOpenReviews    sql.NullInt64  `db:"default_max_open_reviews"`
+	RequiredApprovals sql.NullInt64  `db:"required_approvals"`
+	FirstResponseSLA  sql.NullInt64  `db:"sla_first_response_seconds"`
+	VerdictSLA        sql.NullInt64  `db:"sla_verdict_seconds"`
+	LeadUserID        sql.NullString `db:"lead_user_id"`
+	ArchivedAt        *time.Time     `db:"archived_at"`
+}
+
+func (r *SQLRepo) getTeamSettings(teamName string) (*teamSettings, error) {
+	var ts teamSettings
+	err := r.DB.Get(&ts, `
+		SELECT default_max_open_reviews, required_approvals,
+			sla_first_response_seconds, sla_verdict_seconds, lead_user_id, archived_at
+		FROM teams WHERE name=$1`, teamName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTeamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+func (r *SQLRepo) GetUserLoad(userID string, globalLimit int) (*UserLoad, error) {
+	var load UserLoad
+	err := r.DB.Get(&load, `
+		SELECT `+openReviewsSQL+` AS open_reviews, `+effectiveLimit("$2")+` AS max_open_reviews
+		FROM users u WHERE u.id=$1
+	`, userID, globalLimit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &load, nil
+}
+
+// LockReviewerPoolTx locks the user rows of every member of teams, in id
+// order. Candidate selection holds these locks until commit so concurrent
+// assignments see each other's reviews and cannot exceed a reviewer's limit.
+func (r *SQLRepo) LockReviewerPoolTx(tx *sqlx.Tx, teams []string) error {
+	_, err := tx.Exec(`
+		SELECT u.id FROM users u
+		WHERE u.id IN (SELECT user_id FROM team_members WHERE team_name = ANY($1::text[]))
+		ORDER BY u.id
+		FOR UPDATE
+	`, pq.Array(teams))
+	return err
+}
+
+func effectiveLimit(param string) string {
+	return fmt.Sprintf(effectiveLimitSQL, param)
+}
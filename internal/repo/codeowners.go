@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+func (r *SQLRepo) SetTeamCodeowners(teamName, content string) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var exists bool
+	if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM teams WHERE name=$1)", teamName); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTeamNotFound
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO team_codeowners(team_name, content) VALUES($1,$2)
+		ON CONFLICT (team_name) DO UPDATE SET content=EXCLUDED.content, updated_at=now()
+	`, teamName, content); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLRepo) GetTeamCodeowners(teamName string) (string, error) {
+	var exists bool
+	if err := r.DB.Get(&exists, "SELECT EXISTS(SELECT 1 FROM teams WHERE name=$1)", teamName); err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", ErrTeamNotFound
+	}
+	var content string
+	err := r.DB.Get(&content, "SELECT content FROM team_codeowners WHERE team_name=$1", teamName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return content, err
+}
+
+func (r *SQLRepo) GetTeamCodeownersTx(tx *sqlx.Tx, teamName string) (string, error) {
+	var content string
+	err := tx.Get(&content, "SELECT content FROM team_codeowners WHERE team_name=$1", teamName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return content, err
+}
+
+func (r *SQLRepo) MissingUsers(userIDs []string) ([]string, error) {
+	var missing []string
+	err := r.DB.Select(&missing, `
+		SELECT t.id FROM unnest($1::text[]) AS t(id)
+		WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = t.id)
+	`, pq.Array(userIDs))
+	return missing, err
+}
+
+func (r *SQLRepo) InsertPRFilesTx(tx *sqlx.Tx, prID string, paths []string) error {
+	_, err := tx.Exec(`
+		INSERT INTO pr_files(pr_id, path)
+		SELECT $1, p FROM unnest($2::text[]) AS p
+		ON CONFLICT DO NOTHING
+	`, prID, pq.Array(paths))
+	return err
+}
+
+func (r *SQLRepo) GetPRFilesTx(tx *sqlx.Tx, prID string) ([]string, error) {
+	var paths []string
+	err := tx.Select(&paths, "SELECT path FROM pr_files WHERE pr_id=$1 ORDER BY path", prID)
+	return paths, err
+}
@@ -0,0 +1,16 @@
+package repo
+
+import "errors"
+
+var (
+	ErrTeamNotFound    = errors.New("team not found")
+	ErrTeamArchived    = errors.New("team is archived")
+	ErrTeamExists      = errors.New("team already exists")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrUserExists      = errors.New("user already exists")
+	ErrPRNotFound      = errors.New("PR not found")
+	ErrAbsenceNotFound = errors.New("absence not found")
+	ErrFallbackCycle   = errors.New("fallback cycle")
+	// ErrVersionMismatch means the resource changed since the client read it.
+	ErrVersionMismatch = errors.New("resource was modified, fetch it again and retry")
+)
@@ -0,0 +1,38 @@
+package repo
+
+import (
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/example/prreview/internal/models"
+)
+
+// EventsChannel is the NOTIFY channel PR events are published on.
+const EventsChannel = "pr_events"
+
+// PublishEventTx fills in e from the PR as tx sees it, assigns it an id and
+// queues it on EventsChannel. Postgres delivers the notification to every
+// listening replica when tx commits, in commit order, and drops it if tx
+// rolls back.
+func (r *SQLRepo) PublishEventTx(tx *sqlx.Tx, e *models.Event) error {
+	err := tx.QueryRowx(`
+		SELECT nextval('pr_event_ids'), now(), COALESCE(team_name, ''), author_id
+		FROM prs WHERE id=$1
+	`, e.PullRequestID).Scan(&e.ID, &e.At, &e.TeamName, &e.AuthorID)
+	if err != nil {
+		return err
+	}
+	e.Reviewers = []string{}
+	if err := tx.Select(&e.Reviewers, "SELECT user_id FROM pr_reviewers WHERE pr_id=$1 ORDER BY user_id", e.PullRequestID); err != nil {
+		return err
+	}
+	e.At = e.At.UTC()
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("SELECT pg_notify($1, $2)", EventsChannel, string(payload))
+	return err
+}
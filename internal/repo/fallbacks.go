@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SetTeamFallbacks replaces the ordered fallback list of a team. The change is
+// rejected if it would make the fallback graph cyclic.
+func (r *SQLRepo) SetTeamFallbacks(teamName string, fallbacks []string, ifMatch IfMatch) error {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := r.CheckTeamVersionTx(tx, teamName, ifMatch); err != nil {
+		return err
+	}
+	if err := r.SetTeamFallbacksTx(tx, teamName, fallbacks); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetTeamFallbacksTx is SetTeamFallbacks within tx.
+func (r *SQLRepo) SetTeamFallbacksTx(tx *sqlx.Tx, teamName string, fallbacks []string) error {
+	// Serialize fallback updates so two concurrent changes cannot form a cycle
+	// that neither of them sees.
+	if _, err := tx.Exec("LOCK TABLE team_fallbacks IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, t := range append([]string{teamName}, fallbacks...) {
+		var exists bool
+		if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM teams WHERE name=$1)", t); err != nil {
+			return err
+		}
+		if !exists {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrTeamNotFound, strings.Join(missing, ", "))
+	}
+
+	var edges []struct {
+		Team     string `db:"team_name"`
+		Fallback string `db:"fallback_team"`
+	}
+	if err := tx.Select(&edges, "SELECT team_name, fallback_team FROM team_fallbacks WHERE team_name <> $1", teamName); err != nil {
+		return err
+	}
+	graph := map[string][]string{teamName: fallbacks}
+	for _, e := range edges {
+		graph[e.Team] = append(graph[e.Team], e.Fallback)
+	}
+	if path := findCycle(graph, teamName); path != nil {
+		return fmt.Errorf("%w: %s", ErrFallbackCycle, strings.Join(path, " -> "))
+	}
+
+	if _, err := tx.Exec("DELETE FROM team_fallbacks WHERE team_name=$1", teamName); err != nil {
+		return err
+	}
+	for i, f := range fallbacks {
+		if _, err := tx.Exec(
+			"INSERT INTO team_fallbacks(team_name, position, fallback_team) VALUES($1,$2,$3)",
+			teamName, i, f,
+		); err != nil {
+			return err
+		}
+	}
+	return bumpTeamVersionTx(tx, teamName)
+}
+
+// findCycle returns the first cycle reachable from start, or nil.
+func findCycle(graph map[string][]string, start string) []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var stack []string
+	var visit func(string) []string
+	visit = func(n string) []string {
+		state[n] = visiting
+		stack = append(stack, n)
+		for _, next := range graph[n] {
+			switch state[next] {
+			case visiting:
+				for i, s := range stack {
+					if s == next {
+						return append(append([]string{}, stack[i:]...), next)
+					}
+				}
+			case 0:
+				if c := visit(next); c != nil {
+					return c
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = done
+		return nil
+	}
+	return visit(start)
+}
+
+func (r *SQLRepo) GetTeamFallbacks(teamName string) ([]string, error) {
+	fallbacks := []string{}
+	err := r.DB.Select(&fallbacks, "SELECT fallback_team FROM team_fallbacks WHERE team_name=$1 ORDER BY position", teamName)
+	return fallbacks, err
+}
+
+// FallbackChainTx returns the teams to try after teamName, in order: each
+// fallback team is followed by its own fallbacks before the next sibling.
+// Archived teams are left out together with their own fallbacks.
+func (r *SQLRepo) FallbackChainTx(tx *sqlx.Tx, teamName string) ([]string, error) {
+	seen := map[string]bool{teamName: true}
+	var chain []string
+	var walk func(string) error
+	walk = func(t string) error {
+		var next []string
+		if err := tx.Select(&next, `
+			SELECT f.fallback_team FROM team_fallbacks f JOIN teams ft ON ft.name = f.fallback_team
+			WHERE f.team_name=$1 AND ft.archived_at IS NULL
+			ORDER BY f.position
+		`, t); err != nil {
+			return err
+		}
+		for _, n := range next {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			chain = append(chain, n)
+			if err := walk(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return chain, walk(teamName)
+}
+
+func (r *SQLRepo) AddFallbackReviewerTx(tx *sqlx.Tx, prID, userID, sourceTeam string) error {
+	if _, err := tx.Exec("INSERT INTO pr_reviewers(pr_id,user_id,source_team) VALUES($1,$2,$3)", prID, userID, sourceTeam); err != nil {
+		return err
+	}
+	return bumpPRVersionTx(tx, prID)
+}
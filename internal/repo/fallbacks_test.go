@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindCycle(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		graph map[string][]string
+		start string
+		want  []string
+	}{
+		{"self-loop", map[string][]string{"a": {"a"}}, "a", []string{"a", "a"}},
+		{"two teams", map[string][]string{"a": {"b"}, "b": {"a"}}, "a", []string{"a", "b", "a"}},
+		{
+			"cycle past the start",
+			map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"b"}},
+			"a", []string{"b", "c", "d", "b"},
+		},
+		{
+			"second sibling",
+			map[string][]string{"a": {"b", "c"}, "c": {"a"}},
+			"a", []string{"a", "c", "a"},
+		},
+		{"chain", map[string][]string{"a": {"b"}, "b": {"c"}}, "a", nil},
+		{"shared fallback", map[string][]string{"a": {"b", "c"}, "b": {"d"}, "c": {"d"}}, "a", nil},
+		{"cycle not reachable", map[string][]string{"a": {"b"}, "c": {"d"}, "d": {"c"}}, "a", nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, findCycle(c.graph, c.start))
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type IdempotencyRecord struct {
+	RequestHash string        `db:"request_hash"`
+	StatusCode  sql.NullInt64 `db:"status_code"`
+	ContentType string        `db:"content_type"`
+	Body        []byte        `db:"response_body"`
+}
+
+// ReserveIdempotencyKey claims key for client. It returns false if the key is
+// already taken by an unexpired request.
+func (r *SQLRepo) ReserveIdempotencyKey(client, key, requestHash string, ttl time.Duration) (bool, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("DELETE FROM idempotency_keys WHERE client=$1 AND key=$2 AND expires_at < now()", client, key); err != nil {
+		return false, err
+	}
+	res, err := tx.Exec(`
+		INSERT INTO idempotency_keys(client, key, request_hash, expires_at)
+		VALUES($1, $2, $3, now() + $4 * interval '1 second')
+		ON CONFLICT DO NOTHING
+	`, client, key, requestHash, ttl.Seconds())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, tx.Commit()
+}
+
+func (r *SQLRepo) GetIdempotencyKey(client, key string) (*IdempotencyRecord, error) {
+	var rec IdempotencyRecord
+	err := r.DB.Get(&rec, `
+		SELECT request_hash, status_code, content_type, response_body
+		FROM idempotency_keys
+		WHERE client=$1 AND key=$2 AND expires_at >= now()
+	`, client, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (r *SQLRepo) CompleteIdempotencyKey(client, key string, status int, contentType string, body []byte) error {
+	_, err := r.DB.Exec(`
+		UPDATE idempotency_keys SET status_code=$3, content_type=$4, response_body=$5
+		WHERE client=$1 AND key=$2
+	`, client, key, status, contentType, body)
+	return err
+}
+
+func (r *SQLRepo) ReleaseIdempotencyKey(client, key string) error {
+	_, err := r.DB.Exec("DELETE FROM idempotency_keys WHERE client=$1 AND key=$2", client, key)
+	return err
+}
+
+func (r *SQLRepo) PurgeExpiredIdempotencyKeys() (int64, error) {
+	res, err := r.DB.Exec("DELETE FROM idempotency_keys WHERE expires_at < now()")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
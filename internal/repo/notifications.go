@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of queued assignment emails. An SLA escalation is sent to the team
+// lead and names the overdue reviewer in previous_reviewer_id.
+const (
+	EmailAssigned      = "assigned"
+	EmailReassigned    = "reassigned"
+	EmailSLAReminder   = "sla_reminder"
+	EmailSLAEscalation = "sla_escalation"
+)
+
+// PendingEmail is a queued assignment email with what its template needs.
+type PendingEmail struct {
+	ID                 int64  `db:"id"`
+	Kind               string `db:"kind"`
+	Attempts           int    `db:"attempts"`
+	UserID             string `db:"user_id"`
+	Username           string `db:"username"`
+	Email              string `db:"email"`
+	NotifyAssignments  bool   `db:"notify_assignments"`
+	PullRequestID      string `db:"pr_id"`
+	PullRequestName    string `db:"title"`
+	AuthorID           string `db:"author_id"`
+	TeamName           string `db:"team_name"`
+	PreviousReviewerID string `db:"previous_reviewer_id"`
+}
+
+// EnqueueEmailTx queues an email of kind to userID about prID unless the user
+// has no address or opted out of assignment emails.
+func (r *SQLRepo) EnqueueEmailTx(tx *sqlx.Tx, kind, userID, prID, previousReviewerID string) error {
+	_, err := tx.Exec(`
+		INSERT INTO email_outbox(kind, user_id, pr_id, previous_reviewer_id)
+		SELECT $1, id, $3, NULLIF($4, '') FROM users
+		WHERE id=$2 AND email <> '' AND notify_assignments
+	`, kind, userID, prID, previousReviewerID)
+	return err
+}
+
+// ClaimEmailsTx locks up to limit queued emails, oldest first, skipping the
+// ones another replica is sending.
+func (r *SQLRepo) ClaimEmailsTx(tx *sqlx.Tx, limit int) ([]PendingEmail, error) {
+	var out []PendingEmail
+	err := tx.Select(&out, `
+		SELECT o.id, o.kind, o.attempts, o.user_id, u.name AS username, u.email, u.notify_assignments,
+		       o.pr_id, p.title, p.author_id, COALESCE(p.team_name, '') AS team_name,
+		       COALESCE(o.previous_reviewer_id, '') AS previous_reviewer_id
+		FROM email_outbox o
+		JOIN users u ON u.id = o.user_id
+		JOIN prs p ON p.id = o.pr_id
+		ORDER BY o.id
+		LIMIT $1
+		FOR UPDATE OF o SKIP LOCKED
+	`, limit)
+	return out, err
+}
+
+func (r *SQLRepo) DeleteEmailTx(tx *sqlx.Tx, id int64) error {
+	_, err := tx.Exec("DELETE FROM email_outbox WHERE id=$1", id)
+	return err
+}
+
+// FailEmailTx records a failed attempt to send a queued email.
+func (r *SQLRepo) FailEmailTx(tx *sqlx.Tx, id int64, sendErr string) error {
+	_, err := tx.Exec("UPDATE email_outbox SET attempts = attempts + 1, last_error = $2 WHERE id=$1", id, sendErr)
+	return err
+}
+
+// DigestRecipient is a user due a daily digest.
+type DigestRecipient struct {
+	UserID   string `db:"id"`
+	Username string `db:"name"`
+	Email    string `db:"email"`
+}
+
+// DigestRecipients lists the active users with an address who want digests
+// and have not been sent one for day yet.
+func (r *SQLRepo) DigestRecipients(day time.Time) ([]DigestRecipient, error) {
+	var out []DigestRecipient
+	err := r.DB.Select(&out, `
+		SELECT id, name, email FROM users
+		WHERE is_active AND notify_digest AND email <> ''
+		  AND (digest_sent_on IS NULL OR digest_sent_on < $1::date)
+		ORDER BY id
+	`, day.Format(time.DateOnly))
+	return out, err
+}
+
+// ClaimDigest marks the digest for day as sent to the user and reports
+// whether this call did so, making sure only one replica sends it.
+func (r *SQLRepo) ClaimDigest(userID string, day time.Time) (bool, error) {
+	res, err := r.DB.Exec(`
+		UPDATE users SET digest_sent_on = $2::date
+		WHERE id=$1 AND (digest_sent_on IS NULL OR digest_sent_on < $2::date)
+	`, userID, day.Format(time.DateOnly))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseDigest undoes ClaimDigest after the digest could not be sent.
+func (r *SQLRepo) ReleaseDigest(userID string, day time.Time) error {
+	_, err := r.DB.Exec("UPDATE users SET digest_sent_on = NULL WHERE id=$1 AND digest_sent_on = $2::date",
+		userID, day.Format(time.DateOnly))
+	return err
+}
@@ -0,0 +1,55 @@
+package repo
+
+import "time"
+
+// UpdateRateLimitBucket locks the bucket for key (creating it with initial
+// tokens if missing), passes its token count and the seconds since its last
+// update to update, and stores the returned count. Elapsed time is measured by
+// the database clock so replicas with skewed clocks agree.
+func (r *SQLRepo) UpdateRateLimitBucket(key string, initial float64, update func(tokens, elapsedSeconds float64) float64) (float64, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`
+		INSERT INTO rate_limit_buckets(key, tokens) VALUES($1, $2)
+		ON CONFLICT (key) DO NOTHING
+	`, key, initial); err != nil {
+		return 0, err
+	}
+
+	var state struct {
+		Tokens  float64   `db:"tokens"`
+		Elapsed float64   `db:"elapsed"`
+		Now     time.Time `db:"now"`
+	}
+	if err := tx.Get(&state, `
+		SELECT tokens, EXTRACT(EPOCH FROM (c.now - updated_at))::float8 AS elapsed, c.now
+		FROM rate_limit_buckets, (SELECT clock_timestamp() AS now) c
+		WHERE key=$1 FOR UPDATE OF rate_limit_buckets
+	`, key); err != nil {
+		return 0, err
+	}
+
+	tokens := update(state.Tokens, state.Elapsed)
+	if _, err := tx.Exec(
+		"UPDATE rate_limit_buckets SET tokens=$2, updated_at=$3 WHERE key=$1",
+		key, tokens, state.Now,
+	); err != nil {
+		return 0, err
+	}
+	return tokens, tx.Commit()
+}
+
+func (r *SQLRepo) PurgeIdleRateLimitBuckets(olderThanSeconds float64) (int64, error) {
+	res, err := r.DB.Exec(
+		"DELETE FROM rate_limit_buckets WHERE updated_at < clock_timestamp() - $1 * interval '1 second'",
+		olderThanSeconds,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/example/prreview/internal/models"
+)
+
+type ApprovalState struct {
+	Approvals         int `db:"approvals"`
+	ChangesRequested  int `db:"changes_requested"`
+	RequiredApprovals int `db:"required_approvals"`
+}
+
+func (s ApprovalState) Satisfied() bool {
+	return s.ChangesRequested == 0 && s.Approvals >= s.RequiredApprovals
+}
+
+func (r *SQLRepo) InsertReviewTx(tx *sqlx.Tx, prID, userID, verdict, comment string) error {
+	_, err := tx.Exec(
+		"INSERT INTO pr_reviews(pr_id, user_id, verdict, comment) VALUES($1,$2,$3,$4)",
+		prID, userID, verdict, comment,
+	)
+	if err != nil {
+		return err
+	}
+	return bumpPRVersionTx(tx, prID)
+}
+
+// latestVerdictsSQL selects the latest verdict of every currently assigned
+// reviewer of PR $1. Verdicts of reviewers who were reassigned away are ignored.
+const latestVerdictsSQL = `
+	SELECT DISTINCT ON (rv.user_id) rv.user_id, rv.verdict, rv.comment, rv.submitted_at
+	FROM pr_reviews rv
+	JOIN pr_reviewers a ON a.pr_id = rv.pr_id AND a.user_id = rv.user_id
+	WHERE rv.pr_id = $1
+	ORDER BY rv.user_id, rv.submitted_at DESC, rv.id DESC`
+
+func (r *SQLRepo) GetLatestReviews(prID string) ([]models.ReviewResp, error) {
+	reviews := []models.ReviewResp{}
+	err := r.DB.Select(&reviews, latestVerdictsSQL, prID)
+	return reviews, err
+}
+
+// ApprovalStateTx counts the latest verdicts of the assigned reviewers against
+// the approvals the PR's team requires (globalRequired if the team sets none).
+func (r *SQLRepo) ApprovalStateTx(tx *sqlx.Tx, prID string, globalRequired int) (*ApprovalState, error) {
+	var st ApprovalState
+	err := tx.Get(&st, `
+		SELECT
+			(SELECT count(*) FROM (`+latestVerdictsSQL+`) v WHERE v.verdict = 'APPROVED') AS approvals,
+			(SELECT count(*) FROM (`+latestVerdictsSQL+`) v WHERE v.verdict = 'CHANGES_REQUESTED') AS changes_requested,
+			COALESCE(t.required_approvals, $2) AS required_approvals
+		FROM prs p JOIN teams t ON t.name = p.team_name
+		WHERE p.id = $1
+	`, prID, globalRequired)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPRNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (r *SQLRepo) SetTeamRequiredApprovals(teamName string, required *int, ifMatch IfMatch) error {
+	return r.updateTeam(teamName, ifMatch, "UPDATE teams SET required_approvals=$2, version = version + 1 WHERE name=$1", required)
+}
+
+func (r *SQLRepo) InsertAuditTx(tx *sqlx.Tx, actor, action, prID string, details interface{}) error {
+	raw, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO audit_log(actor, action, pr_id, details) VALUES($1,$2,NULLIF($3, ''),$4)",
+		actor, action, prID, raw,
+	)
+	return err
+}
+
+func (r *SQLRepo) ListAudit(prID string) ([]models.AuditEntryResp, error) {
+	entries := []models.AuditEntryResp{}
+	err := r.DB.Select(&entries, `
+		SELECT id, at, actor, action, COALESCE(pr_id, '') AS pr_id, details
+		FROM audit_log
+		WHERE $1 = '' OR pr_id = $1
+		ORDER BY at, id
+	`, prID)
+	return entries, err
+}
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReviewAssignment is an assignment on an OPEN PR together with what the
+// reviewer has done since being assigned and the SLAs of the PR's team.
+type ReviewAssignment struct {
+	PRID            string         `db:"pr_id"`
+	UserID          string         `db:"user_id"`
+	TeamName        string         `db:"team_name"`
+	LeadUserID      sql.NullString `db:"lead_user_id"`
+	AssignedAt      time.Time      `db:"assigned_at"`
+	FirstResponseAt *time.Time     `db:"first_response_at"`
+	VerdictAt       *time.Time     `db:"verdict_at"`
+	RemindedAt      *time.Time     `db:"sla_reminded_at"`
+	EscalatedAt     *time.Time     `db:"sla_escalated_at"`
+	// FirstResponseSLA and VerdictSLA are the team's own SLAs in seconds.
+	FirstResponseSLA sql.NullInt64 `db:"sla_first_response_seconds"`
+	VerdictSLA       sql.NullInt64 `db:"sla_verdict_seconds"`
+}
+
+const assignmentsSQL = `
+	SELECT a.pr_id, a.user_id, p.team_name, t.lead_user_id, a.assigned_at,
+		a.sla_reminded_at, a.sla_escalated_at,
+		t.sla_first_response_seconds, t.sla_verdict_seconds,
+		(SELECT min(rv.submitted_at) FROM pr_reviews rv
+			WHERE rv.pr_id = a.pr_id AND rv.user_id = a.user_id AND rv.submitted_at >= a.assigned_at) AS first_response_at,
+		(SELECT min(rv.submitted_at) FROM pr_reviews rv
+			WHERE rv.pr_id = a.pr_id AND rv.user_id = a.user_id AND rv.submitted_at >= a.assigned_at
+			AND rv.verdict IN ('APPROVED', 'CHANGES_REQUESTED')) AS verdict_at
+	FROM pr_reviewers a
+	JOIN prs p ON p.id = a.pr_id
+	JOIN teams t ON t.name = p.team_name
+	WHERE p.status = 'OPEN' AND a.sla_escalated_at IS NULL`
+
+// ListOpenAssignments returns the assignments the SLA scheduler still has to
+// look at, oldest first.
+func (r *SQLRepo) ListOpenAssignments() ([]ReviewAssignment, error) {
+	var out []ReviewAssignment
+	err := r.DB.Select(&out, assignmentsSQL+" ORDER BY a.assigned_at, a.pr_id, a.user_id")
+	return out, err
+}
+
+// GetAssignmentTx re-reads one assignment and locks it, so a review or
+// reassignment racing with the scheduler is seen before acting on it.
+// It returns nil if the assignment is gone or no longer tracked.
+func (r *SQLRepo) GetAssignmentTx(tx *sqlx.Tx, prID, userID string) (*ReviewAssignment, error) {
+	var a ReviewAssignment
+	err := tx.Get(&a, assignmentsSQL+" AND a.pr_id = $1 AND a.user_id = $2 FOR UPDATE OF a", prID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *SQLRepo) MarkRemindedTx(tx *sqlx.Tx, prID, userID string, at time.Time) error {
+	_, err := tx.Exec("UPDATE pr_reviewers SET sla_reminded_at=$3 WHERE pr_id=$1 AND user_id=$2", prID, userID, at)
+	return err
+}
+
+func (r *SQLRepo) MarkEscalatedTx(tx *sqlx.Tx, prID, userID string, at time.Time) error {
+	_, err := tx.Exec("UPDATE pr_reviewers SET sla_escalated_at=$3 WHERE pr_id=$1 AND user_id=$2", prID, userID, at)
+	return err
+}
+
+// SetTeamSLA replaces the team's SLAs and lead. A nil SLA falls back to the
+// configured default; a nil lead leaves escalations without a recipient.
+func (r *SQLRepo) SetTeamSLA(teamName string, firstResponse, verdict *time.Duration, leadUserID *string, ifMatch IfMatch) error {
+	if leadUserID != nil {
+		var exists bool
+		if err := r.DB.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id=$1)", *leadUserID); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+	}
+	return r.updateTeam(teamName, ifMatch, `
+		UPDATE teams SET sla_first_response_seconds=$2, sla_verdict_seconds=$3, lead_user_id=$4, version = version + 1
+		WHERE name=$1
+	`, durationSeconds(firstResponse), durationSeconds(verdict), leadUserID)
+}
+
+func durationSeconds(d *time.Duration) *int64 {
+	if d == nil {
+		return nil
+	}
+	s := int64(d.Seconds())
+	return &s
+}
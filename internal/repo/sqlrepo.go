@@ -2,30 +2,87 @@ package repo
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 
 	"github.com/example/prreview/internal/models"
 )
 
-func RunMigrations(db *sqlx.DB) error {
-	var exists bool
-	err := db.Get(&exists, "SELECT to_regclass('public.prs') IS NOT NULL")
+// RunMigrations applies every *.sql file in dir that is not yet recorded in
+// the migrations table, in lexical order, each in its own transaction.
+func RunMigrations(db *sqlx.DB, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
 	if err != nil {
 		return err
 	}
-	if exists {
-		return nil
+	if len(files) == 0 {
+		return fmt.Errorf("no migrations found in %s", dir)
 	}
-	sqlBytes, err := os.ReadFile("migrations/0001_init.sql")
-	if err != nil {
-		return err
+	sort.Strings(files)
+
+	for _, f := range files {
+		id := strings.TrimSuffix(filepath.Base(f), ".sql")
+		applied, err := migrationApplied(db, id)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+		sqlBytes, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(sqlBytes)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %s: %w", id, err)
+		}
+		if _, err := tx.Exec("INSERT INTO migrations(id) VALUES($1)", id); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
 	}
-	_, err = db.Exec(string(sqlBytes))
-	return err
+	return nil
+}
+
+func migrationApplied(db *sqlx.DB, id string) (bool, error) {
+	var exists bool
+	if err := db.Get(&exists, "SELECT to_regclass('public.migrations') IS NOT NULL"); err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, nil
+	}
+	if err := db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM migrations WHERE id=$1)", id); err != nil {
+		return false, err
+	}
+	if exists || id != "0001_init" {
+		return exists, nil
+	}
+
+	// Databases created before migrations were tracked have the schema but
+	// no record of the initial migration.
+	if err := db.Get(&exists, "SELECT to_regclass('public.prs') IS NOT NULL"); err != nil {
+		return false, err
+	}
+	if exists {
+		_, err := db.Exec("INSERT INTO migrations(id) VALUES($1)", id)
+		return true, err
+	}
+	return false, nil
 }
 
 // --- Team ---
@@ -36,7 +93,7 @@ func (r *SQLRepo) GetTeamByName(teamName string) (*models.TeamResp, error) {
 		return nil, err
 	}
 	if !exists {
-		return nil, errors.New("team not found")
+		return nil, ErrTeamNotFound
 	}
 
 	rows, err := r.DB.Queryx(`
@@ -50,7 +107,7 @@ func (r *SQLRepo) GetTeamByName(teamName string) (*models.TeamResp, error) {
 	}
 	defer func() { _ = rows.Close() }()
 
-	var members []models.TeamMemberResp
+	members := []models.TeamMemberResp{}
 	for rows.Next() {
 		var m models.TeamMemberResp
 		if err := rows.Scan(&m.UserID, &m.Username, &m.IsActive); err != nil {
@@ -59,10 +116,34 @@ func (r *SQLRepo) GetTeamByName(teamName string) (*models.TeamResp, error) {
 		members = append(members, m)
 	}
 
-	return &models.TeamResp{
-		TeamName: teamName,
-		Members:  members,
-	}, nil
+	fallbacks, err := r.GetTeamFallbacks(teamName)
+	if err != nil {
+		return nil, err
+	}
+
+	team := &models.TeamResp{
+		TeamName:      teamName,
+		Members:       members,
+		FallbackTeams: fallbacks,
+	}
+	settings, err := r.getTeamSettings(teamName)
+	if err != nil {
+		return nil, err
+	}
+	team.DefaultMaxOpenReviews = nullIntPtr(settings.MaxOpenReviews)
+	team.RequiredApprovals = nullIntPtr(settings.RequiredApprovals)
+	team.LeadUserID = settings.LeadUserID.String
+	if settings.ArchivedAt != nil {
+		team.Archived = true
+		team.ArchivedAt = settings.ArchivedAt
+	}
+	if settings.FirstResponseSLA.Valid || settings.VerdictSLA.Valid {
+		team.SLA = &models.TeamSLAResp{
+			FirstResponse: secondsString(settings.FirstResponseSLA),
+			Verdict:       secondsString(settings.VerdictSLA),
+		}
+	}
+	return team, nil
 }
 
 func (r *SQLRepo) CreateTeam(teamName string, members []models.TeamMemberResp) (*models.TeamResp, error) {
@@ -77,7 +158,7 @@ func (r *SQLRepo) CreateTeam(teamName string, members []models.TeamMemberResp) (
 		return nil, err
 	}
 	if exists {
-		return nil, errors.New("team already exists")
+		return nil, ErrTeamExists
 	}
 
 	if _, err := tx.Exec("INSERT INTO teams(name) VALUES($1)", teamName); err != nil {
@@ -88,20 +169,10 @@ func (r *SQLRepo) CreateTeam(teamName string, members []models.TeamMemberResp) (
 		if m.UserID == "" {
 			continue
 		}
-		_, err := tx.Exec(`
-			INSERT INTO users(id, name, is_active)
-			VALUES($1,$2,$3)
-			ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, is_active=EXCLUDED.is_active
-		`, m.UserID, m.Username, m.IsActive)
-		if err != nil {
+		if err := r.UpsertUserTx(tx, m.UserID, m.Username, m.IsActive); err != nil {
 			return nil, err
 		}
-
-		_, err = tx.Exec(`
-			INSERT INTO team_members(team_name, user_id) VALUES($1,$2)
-			ON CONFLICT DO NOTHING
-		`, teamName, m.UserID)
-		if err != nil {
+		if err := r.AddTeamMemberTx(tx, teamName, m.UserID); err != nil {
 			return nil, err
 		}
 	}
@@ -113,53 +184,84 @@ func (r *SQLRepo) CreateTeam(teamName string, members []models.TeamMemberResp) (
 	return r.GetTeamByName(teamName)
 }
 
-// --- Users ---
+// UpsertUserTx creates the user or overwrites their name and active flag.
+func (r *SQLRepo) UpsertUserTx(tx *sqlx.Tx, userID, name string, isActive bool) error {
+	_, err := tx.Exec(`
+		INSERT INTO users(id, name, is_active)
+		VALUES($1,$2,$3)
+		ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, is_active=EXCLUDED.is_active, version=users.version + 1
+		WHERE (users.name, users.is_active) IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.is_active)
+	`, userID, name, isActive)
+	return err
+}
 
-func (r *SQLRepo) SetUserActive(userID string, isActive bool) (*models.UserResp, error) {
-	tx, err := r.DB.Beginx()
+func (r *SQLRepo) AddTeamMemberTx(tx *sqlx.Tx, teamName, userID string) error {
+	res, err := tx.Exec(`
+		INSERT INTO team_members(team_name, user_id) VALUES($1,$2)
+		ON CONFLICT DO NOTHING
+	`, teamName, userID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer func() { _ = tx.Rollback() }()
+	return bumpMembershipTx(tx, res, teamName, userID)
+}
 
-	var exists bool
-	if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id=$1)", userID); err != nil {
-		return nil, err
-	}
-	if !exists {
-		return nil, errors.New("user not found")
+func (r *SQLRepo) RemoveTeamMemberTx(tx *sqlx.Tx, teamName, userID string) error {
+	res, err := tx.Exec("DELETE FROM team_members WHERE team_name=$1 AND user_id=$2", teamName, userID)
+	if err != nil {
+		return err
 	}
+	return bumpMembershipTx(tx, res, teamName, userID)
+}
 
-	if _, err := tx.Exec("UPDATE users SET is_active=$1 WHERE id=$2", isActive, userID); err != nil {
-		return nil, err
+// bumpMembershipTx increments the versions of the team and the user if the
+// membership statement res changed anything: both show their memberships.
+func bumpMembershipTx(tx *sqlx.Tx, res sql.Result, teamName, userID string) error {
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
 	}
-
-	var username string
-	if err := tx.Get(&username, "SELECT name FROM users WHERE id=$1", userID); err != nil {
-		return nil, err
+	if err := bumpTeamVersionTx(tx, teamName); err != nil {
+		return err
 	}
+	return bumpUserVersionTx(tx, userID)
+}
+
+// --- Users ---
+
+func (r *SQLRepo) SetUserActiveTx(tx *sqlx.Tx, userID string, isActive bool) error {
+	_, err := tx.Exec("UPDATE users SET is_active=$1, version = version + 1 WHERE id=$2", isActive, userID)
+	return err
+}
 
-	var teamName sql.NullString
-	if err := tx.Get(&teamName, "SELECT team_name FROM team_members WHERE user_id=$1 LIMIT 1", userID); err != nil && err != sql.ErrNoRows {
+func (r *SQLRepo) SetUserActive(userID string, isActive bool) (*models.UserResp, error) {
+	res, err := r.DB.Exec("UPDATE users SET is_active=$1, version = version + 1 WHERE id=$2", isActive, userID)
+	if err != nil {
 		return nil, err
 	}
-
-	if err := tx.Commit(); err != nil {
+	if n, err := res.RowsAffected(); err != nil {
 		return nil, err
+	} else if n == 0 {
+		return nil, ErrUserNotFound
 	}
+	return r.GetUser(userID)
+}
 
-	u := &models.UserResp{
-		UserID:   userID,
-		Username: username,
-		IsActive: isActive,
-	}
-	if teamName.Valid {
-		u.TeamName = teamName.String
-	} else {
-		u.TeamName = ""
-	}
+// GetUserTeamsTx returns the names of all teams the user belongs to, sorted.
+func (r *SQLRepo) GetUserTeamsTx(tx *sqlx.Tx, userID string) ([]string, error) {
+	teams := []string{}
+	err := tx.Select(&teams, "SELECT team_name FROM team_members WHERE user_id=$1 ORDER BY team_name", userID)
+	return teams, err
+}
 
-	return u, nil
+// GetUserActiveTeamsTx is GetUserTeamsTx without archived teams.
+func (r *SQLRepo) GetUserActiveTeamsTx(tx *sqlx.Tx, userID string) ([]string, error) {
+	teams := []string{}
+	err := tx.Select(&teams, `
+		SELECT tm.team_name FROM team_members tm JOIN teams t ON t.name = tm.team_name
+		WHERE tm.user_id=$1 AND t.archived_at IS NULL
+		ORDER BY tm.team_name
+	`, userID)
+	return teams, err
 }
 
 // --- Pull Requests ---
@@ -203,34 +305,67 @@ func (r *SQLRepo) InsertPRTx(tx *sqlx.Tx, prID, title, authorID, team string, cr
 
 func (r *SQLRepo) GetPR(prID string) (*models.PullRequestResp, error) {
 	var pr models.PullRequestResp
-	err := r.DB.Get(&pr, "SELECT id, title, author_id, team_name, status FROM prs WHERE id=$1", prID)
+	err := r.DB.Get(&pr, "SELECT id, title, author_id, COALESCE(team_name, '') AS team_name, status FROM prs WHERE id=$1", prID)
 	if err != nil {
 		return nil, err
 	}
 
-	var reviewers []string
-	err = r.DB.Select(&reviewers, "SELECT user_id FROM pr_reviewers WHERE pr_id=$1", prID)
+	var reviewers []struct {
+		UserID     string         `db:"user_id"`
+		SourceTeam sql.NullString `db:"source_team"`
+	}
+	err = r.DB.Select(&reviewers, "SELECT user_id, source_team FROM pr_reviewers WHERE pr_id=$1", prID)
 	if err != nil {
 		return nil, err
 	}
-	pr.AssignedReviewers = reviewers
+	pr.AssignedReviewers = make([]string, 0, len(reviewers))
+	for _, rv := range reviewers {
+		pr.AssignedReviewers = append(pr.AssignedReviewers, rv.UserID)
+		if rv.SourceTeam.Valid {
+			if pr.FallbackReviewers == nil {
+				pr.FallbackReviewers = map[string]string{}
+			}
+			pr.FallbackReviewers[rv.UserID] = rv.SourceTeam.String
+		}
+	}
+
+	reviews, err := r.GetLatestReviews(prID)
+	if err != nil {
+		return nil, err
+	}
+	if len(reviews) > 0 {
+		pr.Reviews = reviews
+	}
 	return &pr, nil
 }
 
-func (r *SQLRepo) SelectActiveReviewersTx(tx *sqlx.Tx, teamName, authorID string) ([]string, error) {
+// SelectActiveReviewersTx returns the members of teamName other than authorID
+// who are active, not away and below their open review limit. globalLimit is
+// the limit for users and teams without their own; 0 means unlimited. An
+// archived team has no reviewers.
+func (r *SQLRepo) SelectActiveReviewersTx(tx *sqlx.Tx, teamName, authorID string, globalLimit int) ([]string, error) {
 	var users []string
-	err := tx.Select(&users, "SELECT user_id FROM team_members WHERE team_name=$1 AND user_id<>$2", teamName, authorID)
+	err := tx.Select(&users, `
+		SELECT tm.user_id
+		FROM team_members tm
+		JOIN users u ON u.id = tm.user_id
+		JOIN teams t ON t.name = tm.team_name
+		WHERE tm.team_name=$1 AND tm.user_id<>$2 AND u.is_active = true AND t.archived_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM user_absences a
+				WHERE a.user_id = u.id AND a.cancelled_at IS NULL
+					AND a.starts_at <= now() AND a.ends_at > now()
+			)
+			AND `+openReviewsSQL+` < COALESCE(`+effectiveLimit("$3")+`, 2147483647)
+	`, teamName, authorID, globalLimit)
 	return users, err
 }
 
 func (r *SQLRepo) AddPRReviewerTx(tx *sqlx.Tx, prID, userID string) error {
-	_, err := tx.Exec("INSERT INTO pr_reviewers(pr_id,user_id) VALUES($1,$2)", prID, userID)
-	return err
-}
-
-func (r *SQLRepo) SetUserIsActive(userID string, isActive bool) error {
-	_, err := r.DB.Exec(`UPDATE users SET is_active=$1 WHERE id=$2`, isActive, userID)
-	return err
+	if _, err := tx.Exec("INSERT INTO pr_reviewers(pr_id,user_id) VALUES($1,$2)", prID, userID); err != nil {
+		return err
+	}
+	return bumpPRVersionTx(tx, prID)
 }
 
 func (r *SQLRepo) GetPRsForUser(userID string) ([]*models.PullRequestShortResp, error) {
@@ -258,3 +393,18 @@ func (r *SQLRepo) GetPRsForUser(userID string) ([]*models.PullRequestShortResp,
 
 	return prs, nil
 }
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+func secondsString(v sql.NullInt64) string {
+	if !v.Valid {
+		return ""
+	}
+	return (time.Duration(v.Int64) * time.Second).String()
+}
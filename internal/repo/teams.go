@@ -0,0 +1,224 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/example/prreview/internal/models"
+)
+
+// LockTeamTx locks the team row, which also blocks new PRs for the team until
+// tx ends, and reports whether the team is archived.
+func (r *SQLRepo) LockTeamTx(tx *sqlx.Tx, teamName string) (archived bool, err error) {
+	var archivedAt *time.Time
+	err = tx.Get(&archivedAt, "SELECT archived_at FROM teams WHERE name=$1 FOR UPDATE", teamName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrTeamNotFound
+	}
+	return archivedAt != nil, err
+}
+
+func (r *SQLRepo) SetTeamArchivedTx(tx *sqlx.Tx, teamName string, archived bool) error {
+	_, err := tx.Exec(`
+		UPDATE teams SET archived_at = CASE WHEN $2 THEN COALESCE(archived_at, now()) END, version = version + 1
+		WHERE name=$1
+	`, teamName, archived)
+	return err
+}
+
+// TransferOpenPRsTx moves the OPEN PRs of one team to another. Assigned
+// reviewers are kept.
+func (r *SQLRepo) TransferOpenPRsTx(tx *sqlx.Tx, from, to string) ([]string, error) {
+	var ids []string
+	err := tx.Select(&ids, `
+		UPDATE prs SET team_name=$2, version = version + 1 WHERE team_name=$1 AND status='OPEN'
+		RETURNING id
+	`, from, to)
+	return ids, err
+}
+
+func (r *SQLRepo) CountOpenPRsTx(tx *sqlx.Tx, teamName string) (int, error) {
+	var n int
+	err := tx.Get(&n, "SELECT count(*) FROM prs WHERE team_name=$1 AND status='OPEN'", teamName)
+	return n, err
+}
+
+// ListOpenPRs returns the OPEN PRs of teamName with their reviewers, ordered
+// by id.
+func (r *SQLRepo) ListOpenPRs(teamName string) ([]*models.PullRequestResp, error) {
+	var ids []string
+	err := r.DB.Select(&ids, "SELECT id FROM prs WHERE team_name=$1 AND status='OPEN' ORDER BY id", teamName)
+	if err != nil {
+		return nil, err
+	}
+	prs := make([]*models.PullRequestResp, 0, len(ids))
+	for _, id := range ids {
+		pr, err := r.GetPR(id)
+		if err != nil {
+			return nil, err
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
+
+// DeleteTeamTx removes the team with its memberships, CODEOWNERS and fallback
+// settings. Merged PRs of the team are kept without a team.
+func (r *SQLRepo) DeleteTeamTx(tx *sqlx.Tx, teamName string) error {
+	if _, err := tx.Exec(`
+		UPDATE users SET version = version + 1
+		WHERE id IN (SELECT user_id FROM team_members WHERE team_name=$1)
+	`, teamName); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE prs SET version = version + 1 WHERE team_name=$1", teamName); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM teams WHERE name=$1", teamName)
+	return err
+}
+
+// TeamSnapshot is the stored state of a team that a declarative team file
+// can describe.
+type TeamSnapshot struct {
+	Name              string
+	Members           []string
+	FallbackTeams     []string
+	MaxOpenReviews    *int
+	RequiredApprovals *int
+	LeadUserID        string
+	FirstResponseSLA  *time.Duration
+	VerdictSLA        *time.Duration
+}
+
+// TeamSnapshotTx returns the team's state, or nil if there is no such team.
+func (r *SQLRepo) TeamSnapshotTx(tx *sqlx.Tx, teamName string) (*TeamSnapshot, error) {
+	var ts teamSettings
+	err := tx.Get(&ts, `
+		SELECT default_max_open_reviews, required_approvals,
+			sla_first_response_seconds, sla_verdict_seconds, lead_user_id, archived_at
+		FROM teams WHERE name=$1`, teamName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &TeamSnapshot{
+		Name:              teamName,
+		MaxOpenReviews:    nullIntPtr(ts.MaxOpenReviews),
+		RequiredApprovals: nullIntPtr(ts.RequiredApprovals),
+		LeadUserID:        ts.LeadUserID.String,
+		FirstResponseSLA:  nullSecondsPtr(ts.FirstResponseSLA),
+		VerdictSLA:        nullSecondsPtr(ts.VerdictSLA),
+	}
+	if err := tx.Select(&snap.Members, "SELECT user_id FROM team_members WHERE team_name=$1 ORDER BY user_id", teamName); err != nil {
+		return nil, err
+	}
+	if err := tx.Select(&snap.FallbackTeams, "SELECT fallback_team FROM team_fallbacks WHERE team_name=$1 ORDER BY position", teamName); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+type UserSnapshot struct {
+	Name        string `db:"name"`
+	IsActive    bool   `db:"is_active"`
+	Email       string `db:"email"`
+	SlackUserID string `db:"slack_user_id"`
+}
+
+// UserSnapshotsTx returns the stored users among ids, keyed by id.
+func (r *SQLRepo) UserSnapshotsTx(tx *sqlx.Tx, ids []string) (map[string]UserSnapshot, error) {
+	var rows []struct {
+		ID string `db:"id"`
+		UserSnapshot
+	}
+	if err := tx.Select(&rows, "SELECT id, name, is_active, email, slack_user_id FROM users WHERE id = ANY($1::text[])", pq.Array(ids)); err != nil {
+		return nil, err
+	}
+	out := make(map[string]UserSnapshot, len(rows))
+	for _, row := range rows {
+		out[row.ID] = row.UserSnapshot
+	}
+	return out, nil
+}
+
+// TeamSettingsUpdate lists team settings to change; nil fields are kept and
+// an empty LeadUserID clears the lead.
+type TeamSettingsUpdate struct {
+	MaxOpenReviews    *int
+	RequiredApprovals *int
+	LeadUserID        *string
+	FirstResponseSLA  *time.Duration
+	VerdictSLA        *time.Duration
+}
+
+func (r *SQLRepo) UpdateTeamSettingsTx(tx *sqlx.Tx, teamName string, upd TeamSettingsUpdate) error {
+	_, err := tx.Exec(`
+		UPDATE teams SET
+			version = version + 1,
+			default_max_open_reviews = COALESCE($2, default_max_open_reviews),
+			required_approvals = COALESCE($3, required_approvals),
+			sla_first_response_seconds = COALESCE($4, sla_first_response_seconds),
+			sla_verdict_seconds = COALESCE($5, sla_verdict_seconds),
+			lead_user_id = CASE WHEN $6::text IS NULL THEN lead_user_id ELSE NULLIF($6, '') END
+		WHERE name=$1
+	`, teamName, upd.MaxOpenReviews, upd.RequiredApprovals,
+		durationSeconds(upd.FirstResponseSLA), durationSeconds(upd.VerdictSLA), upd.LeadUserID)
+	return err
+}
+
+func (r *SQLRepo) InsertTeamTx(tx *sqlx.Tx, teamName string) error {
+	_, err := tx.Exec("INSERT INTO teams(name) VALUES($1)", teamName)
+	return err
+}
+
+func nullSecondsPtr(v sql.NullInt64) *time.Duration {
+	if !v.Valid {
+		return nil
+	}
+	d := time.Duration(v.Int64) * time.Second
+	return &d
+}
+
+// ListTeamNames returns a page of team names, all of them or only name if it
+// is set, and the number of matches overall.
+func (r *SQLRepo) ListTeamNames(name string, offset, limit int) ([]string, int, error) {
+	const where = `WHERE ($1 = '' OR name = $1)`
+	var total int
+	if err := r.DB.Get(&total, "SELECT count(*) FROM teams "+where, name); err != nil {
+		return nil, 0, err
+	}
+	names := []string{}
+	err := r.DB.Select(&names, "SELECT name FROM teams "+where+" ORDER BY name OFFSET $2 LIMIT $3", name, offset, limit)
+	return names, total, err
+}
+
+// DirectoryEntry is a team membership, a team without members (empty UserID)
+// or a user without teams (empty TeamName).
+type DirectoryEntry struct {
+	TeamName string `db:"team_name"`
+	UserID   string `db:"user_id"`
+	UserSnapshot
+}
+
+// DirectoryTx lists every team and user, ordered by team and user id.
+func (r *SQLRepo) DirectoryTx(tx *sqlx.Tx) ([]DirectoryEntry, error) {
+	var out []DirectoryEntry
+	err := tx.Select(&out, `
+		SELECT COALESCE(tm.team_name, '') AS team_name, u.id AS user_id,
+			u.name, u.is_active, u.email, u.slack_user_id
+		FROM users u LEFT JOIN team_members tm ON tm.user_id = u.id
+		UNION ALL
+		SELECT t.name, '', '', false, '', '' FROM teams t
+		WHERE NOT EXISTS (SELECT 1 FROM team_members tm WHERE tm.team_name = t.name)
+		ORDER BY team_name, user_id
+	`)
+	return out, err
+}
@@ -0,0 +1,249 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/example/prreview/internal/models"
+)
+
+// UserUpdate holds the profile fields to change; nil fields are kept.
+type UserUpdate struct {
+	Username    *string
+	Email       *string
+	SlackUserID *string
+
+	NotifyAssignments *bool
+	NotifyDigest      *bool
+
+	// IfMatch makes the update conditional on the user's version.
+	IfMatch IfMatch
+}
+
+// CreateUser adds a user and makes them a member of teams.
+func (r *SQLRepo) CreateUser(u models.UserResp) (*models.UserResp, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var missing []string
+	if err := tx.Select(&missing, `
+		SELECT t.name FROM unnest($1::text[]) AS t(name)
+		WHERE NOT EXISTS (SELECT 1 FROM teams WHERE teams.name = t.name)
+	`, pq.Array(u.Teams)); err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, ErrTeamNotFound
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO users(id, name, is_active, email, slack_user_id) VALUES($1,$2,$3,$4,$5)
+		ON CONFLICT (id) DO NOTHING
+	`, u.UserID, u.Username, u.IsActive, u.Email, u.SlackUserID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrUserExists
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO team_members(team_name, user_id) SELECT unnest($1::text[]), $2
+		ON CONFLICT DO NOTHING
+	`, pq.Array(u.Teams), u.UserID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE teams SET version = version + 1 WHERE name = ANY($1)", pq.Array(u.Teams)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetUser(u.UserID)
+}
+
+func (r *SQLRepo) GetUser(userID string) (*models.UserResp, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	return r.GetUserTx(tx, userID)
+}
+
+func (r *SQLRepo) GetUserTx(tx *sqlx.Tx, userID string) (*models.UserResp, error) {
+	var row struct {
+		Name              string `db:"name"`
+		IsActive          bool   `db:"is_active"`
+		Email             string `db:"email"`
+		SlackUserID       string `db:"slack_user_id"`
+		NotifyAssignments bool   `db:"notify_assignments"`
+		NotifyDigest      bool   `db:"notify_digest"`
+	}
+	err := tx.Get(&row, `
+		SELECT name, is_active, email, slack_user_id, notify_assignments, notify_digest
+		FROM users WHERE id=$1
+	`, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := r.GetUserTeamsTx(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	u := &models.UserResp{
+		UserID:      userID,
+		Username:    row.Name,
+		Teams:       teams,
+		IsActive:    row.IsActive,
+		Email:       row.Email,
+		SlackUserID: row.SlackUserID,
+		Notifications: models.NotificationSettings{
+			Assignments: row.NotifyAssignments,
+			Digest:      row.NotifyDigest,
+		},
+	}
+	if len(teams) > 0 {
+		u.TeamName = teams[0]
+	}
+	return u, nil
+}
+
+func (r *SQLRepo) UpdateUser(userID string, upd UserUpdate) (*models.UserResp, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := r.UpdateUserTx(tx, userID, upd); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetUser(userID)
+}
+
+func (r *SQLRepo) UpdateUserTx(tx *sqlx.Tx, userID string, upd UserUpdate) error {
+	if err := r.CheckUserVersionTx(tx, userID, upd.IfMatch); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`
+		UPDATE users SET
+			version = version + 1,
+			name = COALESCE($2, name),
+			email = COALESCE($3, email),
+			slack_user_id = COALESCE($4, slack_user_id),
+			notify_assignments = COALESCE($5, notify_assignments),
+			notify_digest = COALESCE($6, notify_digest)
+		WHERE id=$1
+	`, userID, upd.Username, upd.Email, upd.SlackUserID, upd.NotifyAssignments, upd.NotifyDigest)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UserFilter narrows ListUsers down; empty fields match every user.
+type UserFilter struct {
+	UserID   string
+	Username string
+	Email    string
+	// SlackUserID is the chat user id linked through slack_user_id.
+	SlackUserID string
+}
+
+// ListUsers returns a page of matching users in id order and the number of
+// matches overall.
+func (r *SQLRepo) ListUsers(f UserFilter, offset, limit int) ([]models.UserResp, int, error) {
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const where = `WHERE ($1 = '' OR id = $1) AND ($2 = '' OR name = $2) AND ($3 = '' OR email = $3)
+		AND ($4 = '' OR slack_user_id = $4)`
+	var total int
+	if err := tx.Get(&total, "SELECT count(*) FROM users "+where, f.UserID, f.Username, f.Email, f.SlackUserID); err != nil {
+		return nil, 0, err
+	}
+	var ids []string
+	if err := tx.Select(&ids, "SELECT id FROM users "+where+" ORDER BY id OFFSET $5 LIMIT $6",
+		f.UserID, f.Username, f.Email, f.SlackUserID, offset, limit); err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]models.UserResp, 0, len(ids))
+	for _, id := range ids {
+		u, err := r.GetUserTx(tx, id)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *u)
+	}
+	return users, total, nil
+}
+
+// CountAuthoredPRsTx counts the PRs authored by the user, which keep the user
+// from being deleted.
+func (r *SQLRepo) CountAuthoredPRsTx(tx *sqlx.Tx, userID string) (int, error) {
+	var n int
+	err := tx.Get(&n, "SELECT count(*) FROM prs WHERE author_id=$1", userID)
+	return n, err
+}
+
+// OpenReviewPRsTx returns the OPEN PRs the user is assigned to, in id order.
+func (r *SQLRepo) OpenReviewPRsTx(tx *sqlx.Tx, userID string) ([]string, error) {
+	var ids []string
+	err := tx.Select(&ids, `
+		SELECT p.id FROM prs p JOIN pr_reviewers a ON a.pr_id = p.id
+		WHERE a.user_id=$1 AND p.status='OPEN'
+		ORDER BY p.id
+	`, userID)
+	return ids, err
+}
+
+func (r *SQLRepo) DeleteUserTx(tx *sqlx.Tx, userID string) error {
+	// The user's memberships, assignments and verdicts go away with them.
+	if _, err := tx.Exec(`
+		UPDATE teams SET version = version + 1
+		WHERE name IN (SELECT team_name FROM team_members WHERE user_id=$1)
+	`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE prs SET version = version + 1
+		WHERE id IN (SELECT pr_id FROM pr_reviewers WHERE user_id=$1 UNION SELECT pr_id FROM pr_reviews WHERE user_id=$1)
+	`, userID); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM users WHERE id=$1", userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Teams, users and PRs carry a version that every write changing what the API
+// returns for them increments; it is sent to clients as the ETag. A team also
+// shows its members' names and active flags, so its version includes theirs.
+//
+// Reads take the version before the data: if a write lands in between, the
+// client holds an older version than the data it saw, and its conditional
+// write fails instead of overwriting the change.
+
+// IfMatch holds the versions a write is conditional on, from an If-Match
+// header. An empty IfMatch makes the write unconditional.
+type IfMatch []string
+
+func (m IfMatch) check(current string) error {
+	if len(m) == 0 {
+		return nil
+	}
+	for _, v := range m {
+		if v == current {
+			return nil
+		}
+	}
+	return ErrVersionMismatch
+}
+
+func (r *SQLRepo) TeamVersion(teamName string) (string, error) {
+	return teamVersion(r.DB, teamName, false)
+}
+
+func (r *SQLRepo) UserVersion(userID string) (string, error) {
+	return rowVersion(r.DB, "SELECT version FROM users WHERE id=$1", userID, ErrUserNotFound)
+}
+
+func (r *SQLRepo) PRVersion(prID string) (string, error) {
+	return rowVersion(r.DB, "SELECT version FROM prs WHERE id=$1", prID, ErrPRNotFound)
+}
+
+// CheckTeamVersionTx fails with ErrVersionMismatch unless the team exists and
+// its version is one of ifMatch. The team row and its members stay locked
+// until tx ends, so the version cannot change before the write.
+func (r *SQLRepo) CheckTeamVersionTx(tx *sqlx.Tx, teamName string, ifMatch IfMatch) error {
+	if len(ifMatch) == 0 {
+		return nil
+	}
+	v, err := teamVersion(tx, teamName, true)
+	if errors.Is(err, ErrTeamNotFound) {
+		return ErrVersionMismatch
+	}
+	if err != nil {
+		return err
+	}
+	return ifMatch.check(v)
+}
+
+func (r *SQLRepo) CheckUserVersionTx(tx *sqlx.Tx, userID string, ifMatch IfMatch) error {
+	return checkRowVersionTx(tx, "SELECT version FROM users WHERE id=$1 FOR UPDATE", userID, ifMatch)
+}
+
+func (r *SQLRepo) CheckPRVersionTx(tx *sqlx.Tx, prID string, ifMatch IfMatch) error {
+	return checkRowVersionTx(tx, "SELECT version FROM prs WHERE id=$1 FOR UPDATE", prID, ifMatch)
+}
+
+func teamVersion(q sqlx.Queryer, teamName string, lock bool) (string, error) {
+	teamLock, memberLock := "", ""
+	if lock {
+		teamLock, memberLock = " FOR UPDATE", " FOR SHARE OF u"
+	}
+	var team int64
+	err := sqlx.Get(q, &team, "SELECT version FROM teams WHERE name=$1"+teamLock, teamName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrTeamNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	var members []int64
+	if err := sqlx.Select(q, &members, `
+		SELECT u.version FROM users u JOIN team_members tm ON tm.user_id = u.id
+		WHERE tm.team_name=$1`+memberLock, teamName); err != nil {
+		return "", err
+	}
+	// Memberships only change together with the team's own version, so the
+	// sum of the members' versions grows with every change to one of them.
+	var sum int64
+	for _, v := range members {
+		sum += v
+	}
+	return strconv.FormatInt(team, 10) + "." + strconv.FormatInt(sum, 10), nil
+}
+
+func rowVersion(q sqlx.Queryer, query, id string, notFound error) (string, error) {
+	var v int64
+	err := sqlx.Get(q, &v, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", notFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+func checkRowVersionTx(tx *sqlx.Tx, query, id string, ifMatch IfMatch) error {
+	if len(ifMatch) == 0 {
+		return nil
+	}
+	v, err := rowVersion(tx, query, id, ErrVersionMismatch)
+	if err != nil {
+		return err
+	}
+	return ifMatch.check(v)
+}
+
+func bumpTeamVersionTx(tx *sqlx.Tx, teamName string) error {
+	_, err := tx.Exec("UPDATE teams SET version = version + 1 WHERE name=$1", teamName)
+	return err
+}
+
+func bumpUserVersionTx(tx *sqlx.Tx, userID string) error {
+	_, err := tx.Exec("UPDATE users SET version = version + 1 WHERE id=$1", userID)
+	return err
+}
+
+func bumpPRVersionTx(tx *sqlx.Tx, prID string) error {
+	_, err := tx.Exec("UPDATE prs SET version = version + 1 WHERE id=$1", prID)
+	return err
+}
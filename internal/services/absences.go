@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+)
+
+var (
+	ErrInvalidAbsence = errors.New("ends_at must be after starts_at and in the future")
+	ErrAbsenceClosed  = errors.New("absence is cancelled or already over")
+)
+
+type AbsenceService struct {
+	repo *repo.SQLRepo
+	pr   *PRService
+}
+
+func (s *AbsenceService) Create(userID string, startsAt, endsAt time.Time, reason string) (*models.AbsenceResp, error) {
+	if !endsAt.After(startsAt) || !endsAt.After(time.Now()) {
+		return nil, ErrInvalidAbsence
+	}
+	return s.repo.CreateAbsence(userID, startsAt.UTC(), endsAt.UTC(), reason)
+}
+
+func (s *AbsenceService) List(userID string, includePast bool) ([]models.AbsenceResp, error) {
+	return s.repo.ListAbsences(userID, includePast)
+}
+
+func (s *AbsenceService) Cancel(id int64) (*models.AbsenceResp, error) {
+	return s.repo.CancelAbsence(id)
+}
+
+// OfferHandoffs is run periodically and records handoff offers for the open
+// reviews of users who are away now or will be within lookahead.
+func (s *AbsenceService) OfferHandoffs(lookahead time.Duration) ([]models.HandoffResp, error) {
+	return s.repo.OfferHandoffs(lookahead)
+}
+
+func (s *AbsenceService) Handoffs(absenceID int64) ([]models.HandoffResp, error) {
+	if _, err := s.repo.GetAbsence(absenceID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListHandoffs(absenceID, nil)
+}
+
+// AcceptHandoffs reassigns the pending offered reviews of an absence, or only
+// those in prIDs when it is not empty. Reviews that can no longer be handed
+// off (merged PR, reviewer already replaced) become OBSOLETE; reviews with no
+// replacement candidate stay PENDING and carry the error.
+func (s *AbsenceService) AcceptHandoffs(absenceID int64, prIDs []string) ([]models.HandoffResp, error) {
+	a, pending, err := s.pendingHandoffs(absenceID, prIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]models.HandoffResp, 0, len(pending))
+	for _, h := range pending {
+		newID, _, err := s.pr.Reassign(h.PullRequestID, a.UserID, nil)
+		switch {
+		case err == nil:
+			h.Status, h.ReplacedBy = "ACCEPTED", &newID
+		case errors.Is(err, ErrPRMerged), errors.Is(err, ErrNotAssigned):
+			h.Status, h.Error = "OBSOLETE", err.Error()
+		default:
+			h.Error = err.Error()
+			out = append(out, h)
+			continue
+		}
+		if err := s.repo.ResolveHandoff(absenceID, h.PullRequestID, h.Status, h.ReplacedBy); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+func (s *AbsenceService) DeclineHandoffs(absenceID int64, prIDs []string) ([]models.HandoffResp, error) {
+	_, pending, err := s.pendingHandoffs(absenceID, prIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		pending[i].Status = "DECLINED"
+		if err := s.repo.ResolveHandoff(absenceID, pending[i].PullRequestID, "DECLINED", nil); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+func (s *AbsenceService) pendingHandoffs(absenceID int64, prIDs []string) (*models.AbsenceResp, []models.HandoffResp, error) {
+	a, err := s.repo.GetAbsence(absenceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a.CancelledAt != nil || !a.EndsAt.After(time.Now()) {
+		return nil, nil, ErrAbsenceClosed
+	}
+	pending, err := s.repo.ListHandoffs(absenceID, []string{"PENDING"})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(prIDs) == 0 {
+		return a, pending, nil
+	}
+	want := map[string]bool{}
+	for _, id := range prIDs {
+		want[id] = true
+	}
+	filtered := pending[:0]
+	for _, h := range pending {
+		if want[h.PullRequestID] {
+			filtered = append(filtered, h)
+		}
+	}
+	return a, filtered, nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/example/prreview/internal/bulk"
+	"github.com/example/prreview/internal/repo"
+)
+
+// ImportSummary counts what an import changed, or would change on a dry run.
+type ImportSummary struct {
+	TeamsCreated     int `json:"teams_created"`
+	UsersCreated     int `json:"users_created"`
+	UsersUpdated     int `json:"users_updated"`
+	MembershipsAdded int `json:"memberships_added"`
+	// Reassigned maps PRs of users deactivated by the import to the new
+	// reviewer, "" where the user stays for lack of a candidate.
+	Reassigned map[string]string `json:"reassigned,omitempty"`
+}
+
+type BulkService struct {
+	repo  *repo.SQLRepo
+	users *UserService
+}
+
+// Import creates missing teams and users, updates changed users and adds
+// missing memberships in one transaction. Nothing is removed. Rows must have
+// passed bulk.Validate. With dryRun the transaction is rolled back.
+func (s *BulkService) Import(rows []bulk.Row, dryRun bool) (*ImportSummary, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("LOCK TABLE teams, team_members IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, r := range rows {
+		if r.UserID != "" {
+			ids = append(ids, r.UserID)
+		}
+	}
+	users, err := s.repo.UserSnapshotsTx(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &ImportSummary{Reassigned: map[string]string{}}
+	teams := map[string]map[string]bool{}
+	seen := map[string]bool{}
+	for _, r := range rows {
+		if err := s.importRow(tx, r, users, teams, seen, sum); err != nil {
+			return nil, fmt.Errorf("row %d: %w", r.Line, err)
+		}
+	}
+
+	if dryRun {
+		return sum, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+func (s *BulkService) importRow(tx *sqlx.Tx, r bulk.Row, users map[string]repo.UserSnapshot, teams map[string]map[string]bool, seen map[string]bool, sum *ImportSummary) error {
+	if r.TeamName != "" && teams[r.TeamName] == nil {
+		snap, err := s.repo.TeamSnapshotTx(tx, r.TeamName)
+		if err != nil {
+			return err
+		}
+		members := map[string]bool{}
+		if snap == nil {
+			if err := s.repo.InsertTeamTx(tx, r.TeamName); err != nil {
+				return err
+			}
+			sum.TeamsCreated++
+		} else {
+			for _, id := range snap.Members {
+				members[id] = true
+			}
+		}
+		teams[r.TeamName] = members
+	}
+	if r.UserID == "" {
+		return nil
+	}
+
+	if !seen[r.UserID] {
+		seen[r.UserID] = true
+		cur, exists := users[r.UserID]
+		switch {
+		case !exists:
+			if err := s.repo.UpsertUserTx(tx, r.UserID, r.Username, r.Active()); err != nil {
+				return err
+			}
+			if err := s.repo.UpdateUserTx(tx, r.UserID, repo.UserUpdate{Email: &r.Email, SlackUserID: &r.SlackUserID}); err != nil {
+				return err
+			}
+			sum.UsersCreated++
+		case cur.Name != r.Username || cur.Email != r.Email || cur.SlackUserID != r.SlackUserID || cur.IsActive != r.Active():
+			upd := repo.UserUpdate{Username: &r.Username, Email: &r.Email, SlackUserID: &r.SlackUserID}
+			if err := s.repo.UpdateUserTx(tx, r.UserID, upd); err != nil {
+				return err
+			}
+			if cur.IsActive != r.Active() {
+				replaced, err := s.users.setActiveTx(tx, r.UserID, r.Active())
+				if err != nil {
+					return err
+				}
+				for pr, to := range replaced {
+					sum.Reassigned[pr] = to
+				}
+			}
+			sum.UsersUpdated++
+		}
+	}
+
+	if r.TeamName != "" && !teams[r.TeamName][r.UserID] {
+		if err := s.repo.AddTeamMemberTx(tx, r.TeamName, r.UserID); err != nil {
+			return err
+		}
+		teams[r.TeamName][r.UserID] = true
+		sum.MembershipsAdded++
+	}
+	return nil
+}
+
+// Export returns every team and user in the form Import reads back.
+func (s *BulkService) Export() ([]bulk.Row, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	entries, err := s.repo.DirectoryTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]bulk.Row, 0, len(entries))
+	for _, e := range entries {
+		row := bulk.Row{TeamName: e.TeamName, UserID: e.UserID}
+		if e.UserID != "" {
+			active := e.IsActive
+			row.Username = e.Name
+			row.IsActive = &active
+			row.Email = e.Email
+			row.SlackUserID = e.SlackUserID
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -5,32 +5,76 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/jmoiron/sqlx"
+
+	"github.com/example/prreview/internal/codeowners"
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/models"
 	"github.com/example/prreview/internal/repo"
-	"github.com/lib/pq"
 )
 
 type Services struct {
-	PR *PRService
+	PR       *PRService
+	Absences *AbsenceService
+	SLA      *SLAService
+	Users    *UserService
+	Teams    *TeamService
+	TeamSync *TeamSyncService
+	Bulk     *BulkService
 }
 
-var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
-
-func NewServices(r *repo.SQLRepo) *Services {
-	return &Services{PR: &PRService{repo: r}}
+func NewServices(r *repo.SQLRepo, policy config.ReviewersConfig, sla config.SLAConfig, email config.EmailConfig) *Services {
+	pr := &PRService{repo: r, policy: policy, notify: email.Enabled}
+	users := &UserService{repo: r, pr: pr}
+	return &Services{
+		PR:       pr,
+		Absences: &AbsenceService{repo: r, pr: pr},
+		SLA:      &SLAService{repo: r, pr: pr, policy: sla, now: time.Now},
+		Users:    users,
+		Teams:    &TeamService{repo: r},
+		TeamSync: &TeamSyncService{repo: r, users: users},
+		Bulk:     &BulkService{repo: r, users: users},
+	}
 }
 
 type PRService struct {
-	repo *repo.SQLRepo
+	repo   *repo.SQLRepo
+	policy config.ReviewersConfig
+	// notify queues an email to every reviewer assigned.
+	notify bool
 }
 
 var (
-	ErrPRExists      = errors.New("pr exists")
-	ErrAuthorMissing = errors.New("author not found or has no team")
+	ErrPRExists       = errors.New("pr exists")
+	ErrAuthorMissing  = errors.New("author not found or has no team")
+	ErrNotTeamMember  = errors.New("author is not a member of the team")
+	ErrAmbiguousTeam  = errors.New("author belongs to several teams, team_name required")
+	ErrPRMerged       = errors.New("PR_MERGED")
+	ErrNotAssigned    = errors.New("NOT_ASSIGNED")
+	ErrNoCandidate    = errors.New("NO_CANDIDATE")
+	ErrNotApproved    = errors.New("NOT_APPROVED")
+	ErrInvalidVerdict = errors.New("verdict must be APPROVED, CHANGES_REQUESTED or COMMENTED")
 )
 
-func (s *PRService) CreatePR(prID, title, authorID string) (map[string]interface{}, error) {
+var verdicts = map[string]bool{"APPROVED": true, "CHANGES_REQUESTED": true, "COMMENTED": true}
+
+// MergeOptions controls MergePR. Force skips the approval check; it must only
+// be set for admins and is recorded in the audit log with Actor and Reason.
+type MergeOptions struct {
+	Force  bool
+	Actor  string
+	Reason string
+	// IfMatch makes the merge conditional on the PR's version.
+	IfMatch repo.IfMatch
+}
+
+// CreatePR opens a PR for teamName, or for the author's only team when
+// teamName is empty.
+func (s *PRService) CreatePR(prID, title, authorID, teamName string, changedFiles []string) (map[string]interface{}, error) {
 	tx, err := s.repo.Beginx()
 	if err != nil {
 		return nil, err
@@ -53,32 +97,55 @@ func (s *PRService) CreatePR(prID, title, authorID string) (map[string]interface
 		return nil, ErrAuthorMissing
 	}
 
-	var team sql.NullString
-	if err := tx.Get(&team, "SELECT team_name FROM team_members WHERE user_id=$1 LIMIT 1", authorID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrAuthorMissing
-		}
+	teams, err := s.repo.GetUserActiveTeamsTx(tx, authorID)
+	if err != nil {
 		return nil, err
 	}
-	if !team.Valid {
+	team := teamName
+	switch {
+	case team == "" && len(teams) == 0:
 		return nil, ErrAuthorMissing
+	case team == "" && len(teams) > 1:
+		return nil, fmt.Errorf("%w: %s", ErrAmbiguousTeam, strings.Join(teams, ", "))
+	case team == "":
+		team = teams[0]
+	case !contains(teams, team):
+		all, err := s.repo.GetUserTeamsTx(tx, authorID)
+		if err != nil {
+			return nil, err
+		}
+		if contains(all, team) {
+			return nil, repo.ErrTeamArchived
+		}
+		return nil, ErrNotTeamMember
 	}
 
 	createdAt := sql.NullTime{Time: time.Now().UTC(), Valid: true}
-	if err := s.repo.InsertPRTx(tx, prID, title, authorID, team.String, createdAt); err != nil {
+	if err := s.repo.InsertPRTx(tx, prID, title, authorID, team, createdAt); err != nil {
 		return nil, err
 	}
 
-	candidates, err := s.repo.SelectActiveReviewersTx(tx, team.String, authorID)
+	if len(changedFiles) > 0 {
+		if err := s.repo.InsertPRFilesTx(tx, prID, changedFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	picks, err := s.selectReviewersTx(tx, team, authorID, nil, changedFiles, s.policy.PerPR)
 	if err != nil {
 		return nil, err
 	}
-	pick := pickRandomN(candidates, 2)
-	for _, uid := range pick {
-		if err := s.repo.AddPRReviewerTx(tx, prID, uid); err != nil {
+	for _, p := range picks {
+		if err := s.addReviewerTx(tx, prID, p); err != nil {
+			return nil, err
+		}
+		if err := s.enqueueEmailTx(tx, repo.EmailAssigned, p.UserID, prID, ""); err != nil {
 			return nil, err
 		}
 	}
+	if err := s.repo.PublishEventTx(tx, &models.Event{Type: models.EventPRCreated, PullRequestID: prID}); err != nil {
+		return nil, err
+	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, err
@@ -92,27 +159,52 @@ func (s *PRService) CreatePR(prID, title, authorID string) (map[string]interface
 		"status":             prModel.Status,
 		"assigned_reviewers": prModel.AssignedReviewers,
 		"team_name":          prModel.Team_name,
+		"fallback_reviewers": prModel.FallbackReviewers,
 	}
 	return pr, err
 }
 
-func (s *PRService) MergePR(prID string) (map[string]interface{}, error) {
+func (s *PRService) MergePR(prID string, opts MergeOptions) (map[string]interface{}, error) {
 	tx, err := s.repo.Beginx()
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	if err := s.repo.CheckPRVersionTx(tx, prID, opts.IfMatch); err != nil {
+		return nil, err
+	}
 	var status string
 	if err := tx.Get(&status, "SELECT status FROM prs WHERE id=$1 FOR UPDATE", prID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("PR not found")
+			return nil, repo.ErrPRNotFound
 		}
 		return nil, err
 	}
 
 	if status != "MERGED" {
-		if _, err := tx.Exec("UPDATE prs SET status='MERGED' WHERE id=$1", prID); err != nil {
+		approval, err := s.repo.ApprovalStateTx(tx, prID, s.policy.RequiredApprovals)
+		if err != nil {
+			return nil, err
+		}
+		if !approval.Satisfied() {
+			if !opts.Force {
+				return nil, fmt.Errorf("%w: %d of %d required approvals, %d change requests",
+					ErrNotApproved, approval.Approvals, approval.RequiredApprovals, approval.ChangesRequested)
+			}
+			if err := s.repo.InsertAuditTx(tx, opts.Actor, "FORCE_MERGE", prID, map[string]interface{}{
+				"reason":             opts.Reason,
+				"approvals":          approval.Approvals,
+				"required_approvals": approval.RequiredApprovals,
+				"changes_requested":  approval.ChangesRequested,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec("UPDATE prs SET status='MERGED', version = version + 1 WHERE id=$1", prID); err != nil {
+			return nil, err
+		}
+		if err := s.repo.PublishEventTx(tx, &models.Event{Type: models.EventPRMerged, PullRequestID: prID}); err != nil {
 			return nil, err
 		}
 	}
@@ -126,101 +218,308 @@ func (s *PRService) MergePR(prID string) (map[string]interface{}, error) {
 		return nil, err
 	}
 
+	reviews := prModel.Reviews
+	if reviews == nil {
+		reviews = []models.ReviewResp{}
+	}
 	pr := map[string]interface{}{
 		"id":        prModel.PullRequestID,
 		"title":     prModel.PullRequestName,
 		"author":    prModel.AuthorID,
 		"status":    prModel.Status,
 		"reviewers": prModel.AssignedReviewers,
+		"reviews":   reviews,
 	}
 
 	return pr, nil
 }
 
-func (s *PRService) Reassign(prID, oldUser string) (string, map[string]interface{}, error) {
+// SubmitReview records a verdict from one of the PR's assigned reviewers.
+// Only the latest verdict of each reviewer counts towards approval. A
+// non-empty ifMatch makes it conditional on the PR's version.
+func (s *PRService) SubmitReview(prID, reviewerID, verdict, comment string, ifMatch repo.IfMatch) (*models.PullRequestResp, error) {
+	if !verdicts[verdict] {
+		return nil, ErrInvalidVerdict
+	}
+
 	tx, err := s.repo.Beginx()
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	if err := s.repo.CheckPRVersionTx(tx, prID, ifMatch); err != nil {
+		return nil, err
+	}
 	var status string
 	if err := tx.Get(&status, "SELECT status FROM prs WHERE id=$1 FOR UPDATE", prID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repo.ErrPRNotFound
+		}
+		return nil, err
+	}
+	if status == "MERGED" {
+		return nil, ErrPRMerged
+	}
+
+	var isAssigned bool
+	if err := tx.Get(&isAssigned, "SELECT EXISTS(SELECT 1 FROM pr_reviewers WHERE pr_id=$1 AND user_id=$2)", prID, reviewerID); err != nil {
+		return nil, err
+	}
+	if !isAssigned {
+		return nil, ErrNotAssigned
+	}
+
+	if err := s.repo.InsertReviewTx(tx, prID, reviewerID, verdict, comment); err != nil {
+		return nil, err
+	}
+	if err := s.repo.PublishEventTx(tx, &models.Event{
+		Type: models.EventReviewSubmitted, PullRequestID: prID, ReviewerID: reviewerID, Verdict: verdict,
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPR(prID)
+}
+
+// Reassign replaces oldUser on the PR; a non-empty ifMatch makes it
+// conditional on the PR's version.
+func (s *PRService) Reassign(prID, oldUser string, ifMatch repo.IfMatch) (string, map[string]interface{}, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := s.repo.CheckPRVersionTx(tx, prID, ifMatch); err != nil {
 		return "", nil, err
 	}
+	newID, err := s.reassignTx(tx, prID, oldUser)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", nil, err
+	}
+	prModel, err := s.repo.GetPR(prID)
+	if err != nil {
+		return "", nil, err
+	}
+	pr := map[string]interface{}{
+		"id":     prModel.PullRequestID,
+		"title":  prModel.PullRequestName,
+		"author": prModel.AuthorID,
+	}
+	if len(prModel.FallbackReviewers) > 0 {
+		pr["fallback_reviewers"] = prModel.FallbackReviewers
+	}
+	return newID, pr, nil
+}
+
+// reassignTx replaces oldUser on the PR with a new reviewer picked the same
+// way as on creation and returns the new reviewer's id.
+func (s *PRService) reassignTx(tx *sqlx.Tx, prID, oldUser string) (string, error) {
+	var status string
+	if err := tx.Get(&status, "SELECT status FROM prs WHERE id=$1 FOR UPDATE", prID); err != nil {
+		return "", err
+	}
 	if status == "MERGED" {
-		return "", nil, errors.New("PR_MERGED")
+		return "", ErrPRMerged
 	}
 
 	var team string
 	if err := tx.Get(&team, "SELECT team_name FROM prs WHERE id=$1", prID); err != nil {
-		return "", nil, err
+		return "", err
 	}
 
 	var authorID string
 	if err := tx.Get(&authorID, "SELECT author_id FROM prs WHERE id=$1", prID); err != nil {
-		return "", nil, err
+		return "", err
 	}
 
 	var isAssigned bool
 	if err := tx.Get(&isAssigned, "SELECT EXISTS(SELECT 1 FROM pr_reviewers WHERE pr_id=$1 AND user_id=$2)", prID, oldUser); err != nil {
-		return "", nil, err
+		return "", err
 	}
 	if !isAssigned {
-		return "", nil, errors.New("NOT_ASSIGNED")
+		return "", ErrNotAssigned
 	}
 
 	var current []string
 	if err := tx.Select(&current, "SELECT user_id FROM pr_reviewers WHERE pr_id=$1", prID); err != nil {
-		return "", nil, err
+		return "", err
 	}
 
-	var candidates []string
-	query := `SELECT u.id
-			FROM users u
-			JOIN team_members tm ON tm.user_id = u.id
-			WHERE tm.team_name = $1
-				AND u.is_active = true
-				AND u.id <> ALL($2::text[])
-				AND u.id <> $3`
-
-	if err := tx.Select(&candidates, query, team, pq.Array(current), authorID); err != nil {
-		return "", nil, err
+	files, err := s.repo.GetPRFilesTx(tx, prID)
+	if err != nil {
+		return "", err
 	}
-	if len(candidates) == 0 {
-		return "", nil, errors.New("NO_CANDIDATE")
+	picks, err := s.selectReviewersTx(tx, team, authorID, current, files, 1)
+	if err != nil {
+		return "", err
 	}
-	newID := candidates[rnd.Intn(len(candidates))]
+	if len(picks) == 0 {
+		return "", ErrNoCandidate
+	}
+	newID := picks[0].UserID
 
 	if _, err := tx.Exec("DELETE FROM pr_reviewers WHERE pr_id=$1 AND user_id=$2", prID, oldUser); err != nil {
-		return "", nil, err
+		return "", err
 	}
-	if _, err := tx.Exec("INSERT INTO pr_reviewers(pr_id,user_id) VALUES($1,$2)", prID, newID); err != nil {
-		return "", nil, err
+	if err := s.addReviewerTx(tx, prID, picks[0]); err != nil {
+		return "", err
+	}
+	if err := s.enqueueEmailTx(tx, repo.EmailReassigned, newID, prID, oldUser); err != nil {
+		return "", err
 	}
+	if err := s.repo.PublishEventTx(tx, &models.Event{
+		Type: models.EventReviewerReassigned, PullRequestID: prID, ReviewerID: oldUser, NewReviewerID: newID,
+	}); err != nil {
+		return "", err
+	}
+	return newID, nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return "", nil, err
+func (s *PRService) enqueueEmailTx(tx *sqlx.Tx, kind, userID, prID, previousReviewerID string) error {
+	if !s.notify {
+		return nil
 	}
-	prModel, err := s.repo.GetPR(prID)
-	pr := map[string]interface{}{
-		"id":     prModel.PullRequestID,
-		"title":  prModel.PullRequestName,
-		"author": prModel.AuthorID,
+	return s.repo.EnqueueEmailTx(tx, kind, userID, prID, previousReviewerID)
+}
+
+// ReviewLoad reports the user's OPEN reviews against their effective limit.
+func (s *PRService) ReviewLoad(userID string) (*models.ReviewLoadResp, error) {
+	load, err := s.repo.GetUserLoad(userID, s.policy.MaxOpenReviews)
+	if err != nil {
+		return nil, err
 	}
-	return newID, pr, err
+	resp := &models.ReviewLoadResp{OpenReviews: load.OpenReviews}
+	if load.MaxOpenReviews.Valid {
+		n := int(load.MaxOpenReviews.Int64)
+		resp.MaxOpenReviews = &n
+	}
+	return resp, nil
 }
 
-func pickRandomN(src []string, n int) []string {
-	if len(src) <= n {
-		out := make([]string, len(src))
-		copy(out, src)
-		return out
+type reviewerPick struct {
+	UserID string
+	// FromTeam is set when the reviewer comes from a fallback team.
+	FromTeam string
+}
+
+// selectReviewersTx picks up to n active reviewers for a PR of team, never the
+// author or anyone in exclude, and never someone at their open review limit.
+// Team members come first, owners of the changed files ahead of the rest; if
+// the team cannot fill all n seats, the team's fallback chain is walked in
+// order. The whole candidate pool stays locked until tx ends.
+func (s *PRService) selectReviewersTx(tx *sqlx.Tx, team, authorID string, exclude, files []string, n int) ([]reviewerPick, error) {
+	taken := map[string]bool{}
+	for _, id := range exclude {
+		taken[id] = true
 	}
-	out := make([]string, 0, n)
-	idx := rnd.Perm(len(src))[:n]
-	for _, i := range idx {
-		out = append(out, src[i])
+
+	chain, err := s.repo.FallbackChainTx(tx, team)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.LockReviewerPoolTx(tx, append([]string{team}, chain...)); err != nil {
+		return nil, err
+	}
+
+	var picks []reviewerPick
+	fill := func(fromTeam string) error {
+		name := team
+		if fromTeam != "" {
+			name = fromTeam
+		}
+		all, err := s.repo.SelectActiveReviewersTx(tx, name, authorID, s.policy.MaxOpenReviews)
+		if err != nil {
+			return err
+		}
+		var candidates []string
+		for _, id := range all {
+			if !taken[id] {
+				candidates = append(candidates, id)
+			}
+		}
+		owned, err := s.pathOwnersTx(tx, name, files)
+		if err != nil {
+			return err
+		}
+		for _, id := range pickPreferred(candidates, owned, n-len(picks)) {
+			picks = append(picks, reviewerPick{UserID: id, FromTeam: fromTeam})
+			taken[id] = true
+		}
+		return nil
+	}
+
+	if err := fill(""); err != nil {
+		return nil, err
+	}
+	if len(picks) >= n {
+		return picks, nil
+	}
+	for _, fallback := range chain {
+		if err := fill(fallback); err != nil {
+			return nil, err
+		}
+		if len(picks) >= n {
+			break
+		}
+	}
+	return picks, nil
+}
+
+func (s *PRService) addReviewerTx(tx *sqlx.Tx, prID string, p reviewerPick) error {
+	if p.FromTeam != "" {
+		return s.repo.AddFallbackReviewerTx(tx, prID, p.UserID, p.FromTeam)
+	}
+	return s.repo.AddPRReviewerTx(tx, prID, p.UserID)
+}
+
+// pathOwnersTx counts how many of paths each owner from the team's CODEOWNERS
+// rules owns.
+func (s *PRService) pathOwnersTx(tx *sqlx.Tx, team string, paths []string) (map[string]int, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	content, err := s.repo.GetTeamCodeownersTx(tx, team)
+	if err != nil || content == "" {
+		return nil, err
+	}
+	rules, err := codeowners.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	owned := map[string]int{}
+	for _, p := range paths {
+		for _, o := range rules.Owners(p) {
+			owned[o]++
+		}
+	}
+	return owned, nil
+}
+
+// pickPreferred picks up to n ids from src. Ids with a higher weight come
+// first; the rest of the order is random.
+func pickPreferred(src []string, weight map[string]int, n int) []string {
+	out := make([]string, len(src))
+	copy(out, src)
+	rand.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	sort.SliceStable(out, func(i, j int) bool { return weight[out[i]] > weight[out[j]] })
+	if len(out) > n {
+		out = out[:n]
 	}
 	return out
 }
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
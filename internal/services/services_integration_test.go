@@ -0,0 +1,149 @@
+package services
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/testdb"
+)
+
+// newTestRepo migrates a fresh database; see internal/testdb.
+func newTestRepo(t *testing.T) *repo.SQLRepo {
+	return repo.NewSQLRepo(testdb.New(t, repo.RunMigrations).DB)
+}
+
+func reviewers(t *testing.T, r *repo.SQLRepo, prID string) []string {
+	t.Helper()
+	pr, err := r.GetPR(prID)
+	require.NoError(t, err)
+	ids := append([]string(nil), pr.AssignedReviewers...)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestAbsences(t *testing.T) {
+	r := newTestRepo(t)
+	svcs := NewServices(r, config.ReviewersConfig{PerPR: 2, RequiredApprovals: 1}, config.Default().SLA, config.EmailConfig{})
+	_, err := r.CreateTeam("backend", []models.TeamMemberResp{
+		{UserID: "u1", Username: "Alice", IsActive: true},
+		{UserID: "u2", Username: "Bob", IsActive: true},
+		{UserID: "u3", Username: "Carol", IsActive: true},
+		{UserID: "u4", Username: "Dan", IsActive: true},
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	away, err := svcs.Absences.Create("u2", now.Add(-time.Hour), now.Add(24*time.Hour), "vacation")
+	require.NoError(t, err)
+	_, err = svcs.Absences.Create("u2", now, now.Add(-time.Minute), "")
+	require.ErrorIs(t, err, ErrInvalidAbsence)
+
+	// Bob is away, so he is neither assigned nor taken as a replacement.
+	_, err = svcs.PR.CreatePR("pr-1", "Add search", "u1", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"u3", "u4"}, reviewers(t, r, "pr-1"))
+	_, _, err = svcs.PR.Reassign("pr-1", "u3", nil)
+	require.ErrorIs(t, err, ErrNoCandidate)
+
+	_, err = svcs.Absences.Cancel(away.AbsenceID)
+	require.NoError(t, err)
+	newID, _, err := svcs.PR.Reassign("pr-1", "u3", nil)
+	require.NoError(t, err)
+	require.Equal(t, "u2", newID)
+
+	// Dan leaves in three days: offers are made only once that is within the
+	// lookahead, and only once.
+	later, err := svcs.Absences.Create("u4", now.Add(72*time.Hour), now.Add(96*time.Hour), "")
+	require.NoError(t, err)
+	offers, err := svcs.Absences.OfferHandoffs(24 * time.Hour)
+	require.NoError(t, err)
+	require.Empty(t, offers)
+	offers, err = svcs.Absences.OfferHandoffs(96 * time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, []models.HandoffResp{{AbsenceID: later.AbsenceID, PullRequestID: "pr-1", Status: "PENDING"}}, offers)
+	offers, err = svcs.Absences.OfferHandoffs(96 * time.Hour)
+	require.NoError(t, err)
+	require.Empty(t, offers)
+
+	accepted, err := svcs.Absences.AcceptHandoffs(later.AbsenceID, nil)
+	require.NoError(t, err)
+	require.Len(t, accepted, 1)
+	require.Equal(t, "ACCEPTED", accepted[0].Status)
+	require.Equal(t, "u3", *accepted[0].ReplacedBy)
+	require.Equal(t, []string{"u2", "u3"}, reviewers(t, r, "pr-1"))
+
+	_, err = svcs.Absences.Cancel(later.AbsenceID)
+	require.NoError(t, err)
+	_, err = svcs.Absences.AcceptHandoffs(later.AbsenceID, nil)
+	require.ErrorIs(t, err, ErrAbsenceClosed)
+	_, err = svcs.Absences.AcceptHandoffs(away.AbsenceID, nil)
+	require.ErrorIs(t, err, ErrAbsenceClosed)
+}
+
+func TestMergeRequiresApprovals(t *testing.T) {
+	r := newTestRepo(t)
+	svcs := NewServices(r, config.ReviewersConfig{PerPR: 2, RequiredApprovals: 1}, config.Default().SLA, config.EmailConfig{})
+	_, err := r.CreateTeam("backend", []models.TeamMemberResp{
+		{UserID: "u1", Username: "Alice", IsActive: true},
+		{UserID: "u2", Username: "Bob", IsActive: true},
+		{UserID: "u3", Username: "Carol", IsActive: true},
+	})
+	require.NoError(t, err)
+	for _, id := range []string{"pr-1", "pr-2"} {
+		_, err = svcs.PR.CreatePR(id, "Add search", "u1", "", nil)
+		require.NoError(t, err)
+	}
+	review := func(reviewerID, verdict string) {
+		t.Helper()
+		_, err := svcs.PR.SubmitReview("pr-1", reviewerID, verdict, "", nil)
+		require.NoError(t, err)
+	}
+
+	_, err = svcs.PR.MergePR("pr-1", MergeOptions{})
+	require.ErrorIs(t, err, ErrNotApproved)
+
+	// Only the latest verdict of a reviewer counts.
+	review("u2", "APPROVED")
+	review("u2", "CHANGES_REQUESTED")
+	_, err = svcs.PR.MergePR("pr-1", MergeOptions{})
+	require.ErrorIs(t, err, ErrNotApproved)
+	require.ErrorContains(t, err, "1 change requests")
+	review("u2", "APPROVED")
+
+	// The team's quorum overrides the configured one.
+	two := 2
+	require.NoError(t, r.SetTeamRequiredApprovals("backend", &two, nil))
+	_, err = svcs.PR.MergePR("pr-1", MergeOptions{})
+	require.ErrorContains(t, err, "1 of 2 required approvals")
+
+	review("u3", "COMMENTED")
+	_, err = svcs.PR.MergePR("pr-1", MergeOptions{})
+	require.ErrorIs(t, err, ErrNotApproved)
+	review("u3", "APPROVED")
+	pr, err := svcs.PR.MergePR("pr-1", MergeOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "MERGED", pr["status"])
+	_, err = svcs.PR.MergePR("pr-1", MergeOptions{})
+	require.NoError(t, err, "merging again is a no-op")
+
+	// A force merge goes through without approvals and is audited.
+	pr, err = svcs.PR.MergePR("pr-2", MergeOptions{Force: true, Actor: "ops", Reason: "hotfix"})
+	require.NoError(t, err)
+	require.Equal(t, "MERGED", pr["status"])
+	audit, err := r.ListAudit("pr-2")
+	require.NoError(t, err)
+	require.Len(t, audit, 1)
+	require.Equal(t, "ops", audit[0].Actor)
+	require.Equal(t, "FORCE_MERGE", audit[0].Action)
+	require.JSONEq(t, `{"reason":"hotfix","approvals":0,"required_approvals":2,"changes_requested":0}`, string(audit[0].Details))
+
+	audit, err = r.ListAudit("pr-1")
+	require.NoError(t, err)
+	require.Empty(t, audit, "a regular merge is not audited")
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+)
+
+// slaActor is recorded in the audit log for actions taken by the scheduler.
+const slaActor = "sla-scheduler"
+
+type SLAAction string
+
+const (
+	SLANone     SLAAction = ""
+	SLARemind   SLAAction = "SLA_REMIND"
+	SLAReassign SLAAction = "SLA_REASSIGN"
+	SLAEscalate SLAAction = "SLA_ESCALATE"
+)
+
+// SLAEvent describes one action taken on an overdue assignment.
+type SLAEvent struct {
+	Action     SLAAction `json:"action"`
+	PRID       string    `json:"pull_request_id"`
+	ReviewerID string    `json:"reviewer_id"`
+	BreachedAt time.Time `json:"breached_at"`
+	// NewReviewerID is set for reassignments, LeadUserID for escalations.
+	NewReviewerID string `json:"new_reviewer_id,omitempty"`
+	LeadUserID    string `json:"lead_user_id,omitempty"`
+}
+
+// SLAService enforces the review SLAs: an assignment that breaches one is
+// first reminded, then reassigned, then escalated to the team lead. Reminders
+// and escalations are emailed and published to GET /events in the
+// transaction that records them.
+type SLAService struct {
+	repo   *repo.SQLRepo
+	pr     *PRService
+	policy config.SLAConfig
+	now    func() time.Time
+}
+
+// Check acts on every overdue assignment and returns what it did. An
+// assignment that fails is skipped and reported in the joined error.
+func (s *SLAService) Check() ([]SLAEvent, error) {
+	now := s.now()
+	assignments, err := s.repo.ListOpenAssignments()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []SLAEvent
+	var errs []error
+	for _, a := range assignments {
+		if action, _ := slaStep(a, s.policy, now); action == SLANone {
+			continue
+		}
+		ev, err := s.apply(a.PRID, a.UserID, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sla %s/%s: %w", a.PRID, a.UserID, err))
+			continue
+		}
+		if ev != nil {
+			events = append(events, *ev)
+		}
+	}
+	return events, errors.Join(errs...)
+}
+
+// apply re-evaluates the assignment under the PR lock, so a verdict or a
+// manual reassignment that raced with Check wins, and takes the next step.
+func (s *SLAService) apply(prID, userID string, now time.Time) (*SLAEvent, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var status string
+	if err := tx.Get(&status, "SELECT status FROM prs WHERE id=$1 FOR UPDATE", prID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	a, err := s.repo.GetAssignmentTx(tx, prID, userID)
+	if err != nil || a == nil {
+		return nil, err
+	}
+
+	action, breach := slaStep(*a, s.policy, now)
+	ev := &SLAEvent{Action: action, PRID: prID, ReviewerID: userID, BreachedAt: breach}
+	switch action {
+	case SLANone:
+		return nil, nil
+	case SLARemind:
+		err = s.repo.MarkRemindedTx(tx, prID, userID, now)
+		if err == nil {
+			err = s.pr.enqueueEmailTx(tx, repo.EmailSLAReminder, userID, prID, "")
+		}
+		if err == nil {
+			err = s.repo.PublishEventTx(tx, &models.Event{Type: models.EventReviewOverdue, PullRequestID: prID, ReviewerID: userID})
+		}
+	case SLAReassign:
+		ev.NewReviewerID, err = s.pr.reassignTx(tx, prID, userID)
+		if errors.Is(err, ErrNoCandidate) {
+			// Retried on the next run until someone frees up or the
+			// assignment is escalated.
+			return nil, nil
+		}
+	case SLAEscalate:
+		ev.LeadUserID = a.LeadUserID.String
+		err = s.repo.MarkEscalatedTx(tx, prID, userID, now)
+		if err == nil && ev.LeadUserID != "" {
+			err = s.pr.enqueueEmailTx(tx, repo.EmailSLAEscalation, ev.LeadUserID, prID, userID)
+		}
+		if err == nil {
+			err = s.repo.PublishEventTx(tx, &models.Event{
+				Type: models.EventReviewEscalated, PullRequestID: prID, ReviewerID: userID, LeadUserID: ev.LeadUserID,
+			})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.InsertAuditTx(tx, slaActor, string(action), prID, ev); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// slaStep decides what to do with an assignment at now. The assignment breaches
+// when the first response or the verdict deadline passes without it; the team's
+// own SLAs override the configured ones, and a zero SLA is not enforced. The
+// steps are counted from the earliest breach.
+func slaStep(a repo.ReviewAssignment, p config.SLAConfig, now time.Time) (SLAAction, time.Time) {
+	firstResponse, verdict := p.FirstResponse, p.Verdict
+	if a.FirstResponseSLA.Valid {
+		firstResponse = time.Duration(a.FirstResponseSLA.Int64) * time.Second
+	}
+	if a.VerdictSLA.Valid {
+		verdict = time.Duration(a.VerdictSLA.Int64) * time.Second
+	}
+
+	var breach time.Time
+	for _, sla := range []struct {
+		limit time.Duration
+		done  *time.Time
+	}{{firstResponse, a.FirstResponseAt}, {verdict, a.VerdictAt}} {
+		if sla.limit <= 0 || sla.done != nil {
+			continue
+		}
+		deadline := a.AssignedAt.Add(sla.limit)
+		if deadline.After(now) {
+			continue
+		}
+		if breach.IsZero() || deadline.Before(breach) {
+			breach = deadline
+		}
+	}
+	if breach.IsZero() || a.EscalatedAt != nil {
+		return SLANone, breach
+	}
+
+	overdue := now.Sub(breach)
+	switch {
+	case p.EscalateAfter > 0 && overdue >= p.EscalateAfter:
+		return SLAEscalate, breach
+	case p.ReassignAfter > 0 && overdue >= p.ReassignAfter:
+		return SLAReassign, breach
+	case a.RemindedAt == nil && overdue >= p.RemindAfter:
+		return SLARemind, breach
+	}
+	return SLANone, breach
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/repo"
+)
+
+func TestSLAStepEscalationLadder(t *testing.T) {
+	assigned := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	policy := config.SLAConfig{
+		FirstResponse: 24 * time.Hour,
+		Verdict:       72 * time.Hour,
+		ReassignAfter: 24 * time.Hour,
+		EscalateAfter: 48 * time.Hour,
+	}
+	a := repo.ReviewAssignment{PRID: "pr1", UserID: "u2", AssignedAt: assigned}
+
+	cases := []struct {
+		after time.Duration
+		want  SLAAction
+	}{
+		{23 * time.Hour, SLANone},
+		{24 * time.Hour, SLARemind},
+		{47 * time.Hour, SLARemind},
+		{48 * time.Hour, SLAReassign},
+		{72 * time.Hour, SLAEscalate},
+	}
+	for _, c := range cases {
+		action, breach := slaStep(a, policy, assigned.Add(c.after))
+		require.Equal(t, c.want, action, "after %s", c.after)
+		if c.want != SLANone {
+			require.Equal(t, assigned.Add(24*time.Hour), breach)
+		}
+	}
+
+	reminded := assigned.Add(25 * time.Hour)
+	a.RemindedAt = &reminded
+	action, _ := slaStep(a, policy, assigned.Add(30*time.Hour))
+	require.Equal(t, SLANone, action)
+
+	escalated := assigned.Add(72 * time.Hour)
+	a.EscalatedAt = &escalated
+	action, _ = slaStep(a, policy, assigned.Add(200*time.Hour))
+	require.Equal(t, SLANone, action)
+}
+
+func TestSLAStepResponsesAndTeamOverrides(t *testing.T) {
+	assigned := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	policy := config.SLAConfig{FirstResponse: 24 * time.Hour, Verdict: 72 * time.Hour, ReassignAfter: 24 * time.Hour}
+
+	// A comment answers the first response SLA but not the verdict SLA.
+	commented := assigned.Add(time.Hour)
+	a := repo.ReviewAssignment{AssignedAt: assigned, FirstResponseAt: &commented}
+	action, _ := slaStep(a, policy, assigned.Add(71*time.Hour))
+	require.Equal(t, SLANone, action)
+	action, breach := slaStep(a, policy, assigned.Add(72*time.Hour))
+	require.Equal(t, SLARemind, action)
+	require.Equal(t, assigned.Add(72*time.Hour), breach)
+
+	approved := assigned.Add(2 * time.Hour)
+	a.VerdictAt = &approved
+	action, _ = slaStep(a, policy, assigned.Add(500*time.Hour))
+	require.Equal(t, SLANone, action)
+
+	// The team's own SLA wins; zero switches it off for the team.
+	a = repo.ReviewAssignment{
+		AssignedAt:       assigned,
+		FirstResponseSLA: sql.NullInt64{Int64: 3600, Valid: true},
+		VerdictSLA:       sql.NullInt64{Int64: 0, Valid: true},
+	}
+	action, _ = slaStep(a, policy, assigned.Add(2*time.Hour))
+	require.Equal(t, SLARemind, action)
+	first := assigned.Add(90 * time.Minute)
+	a.FirstResponseAt = &first
+	action, _ = slaStep(a, policy, assigned.Add(500*time.Hour))
+	require.Equal(t, SLANone, action)
+}
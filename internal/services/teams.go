@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/example/prreview/internal/repo"
+)
+
+var (
+	ErrTeamHasOpenPRs   = errors.New("team has open PRs, pass successor_team to transfer them")
+	ErrInvalidSuccessor = errors.New("successor must be another, not archived team")
+)
+
+type TeamService struct {
+	repo *repo.SQLRepo
+}
+
+// Archive hides the team from reviewer selection and, if successor is set,
+// moves its OPEN PRs there. It returns the moved PR ids.
+func (s *TeamService) Archive(team, successor, actor string, ifMatch repo.IfMatch) ([]string, error) {
+	return s.retire(team, successor, actor, false, ifMatch)
+}
+
+// Delete removes the team once it has no OPEN PRs, moving them to successor
+// first if one is given. Merged PRs stay without a team.
+func (s *TeamService) Delete(team, successor, actor string, ifMatch repo.IfMatch) ([]string, error) {
+	return s.retire(team, successor, actor, true, ifMatch)
+}
+
+func (s *TeamService) Unarchive(team, actor string, ifMatch repo.IfMatch) error {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := s.repo.LockTeamTx(tx, team); err != nil {
+		return err
+	}
+	if err := s.repo.CheckTeamVersionTx(tx, team, ifMatch); err != nil {
+		return err
+	}
+	if err := s.repo.SetTeamArchivedTx(tx, team, false); err != nil {
+		return err
+	}
+	if err := s.repo.InsertAuditTx(tx, actor, "TEAM_UNARCHIVE", "", map[string]string{"team_name": team}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *TeamService) retire(team, successor, actor string, remove bool, ifMatch repo.IfMatch) ([]string, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := s.lockTeams(tx, team, successor); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CheckTeamVersionTx(tx, team, ifMatch); err != nil {
+		return nil, err
+	}
+
+	moved := []string{}
+	if successor != "" {
+		if moved, err = s.repo.TransferOpenPRsTx(tx, team, successor); err != nil {
+			return nil, err
+		}
+		sort.Strings(moved)
+	}
+
+	action := "TEAM_ARCHIVE"
+	if remove {
+		action = "TEAM_DELETE"
+		open, err := s.repo.CountOpenPRsTx(tx, team)
+		if err != nil {
+			return nil, err
+		}
+		if open > 0 {
+			return nil, ErrTeamHasOpenPRs
+		}
+		err = s.repo.DeleteTeamTx(tx, team)
+	} else {
+		err = s.repo.SetTeamArchivedTx(tx, team, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{"team_name": team, "successor_team": successor, "transferred_prs": moved}
+	if err := s.repo.InsertAuditTx(tx, actor, action, "", details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// lockTeams locks team and successor in name order so that two requests
+// retiring teams into each other cannot deadlock.
+func (s *TeamService) lockTeams(tx *sqlx.Tx, team, successor string) error {
+	if successor == team {
+		return ErrInvalidSuccessor
+	}
+	names := []string{team}
+	if successor != "" {
+		names = append(names, successor)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		archived, err := s.repo.LockTeamTx(tx, name)
+		if err != nil {
+			return err
+		}
+		if name == successor && archived {
+			return ErrInvalidSuccessor
+		}
+	}
+	return nil
+}
+
+// Create adds a team of existing users.
+func (s *TeamService) Create(team string, members []string) error {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	snap, err := s.repo.TeamSnapshotTx(tx, team)
+	if err != nil {
+		return err
+	}
+	if snap != nil {
+		return repo.ErrTeamExists
+	}
+	if err := s.repo.InsertTeamTx(tx, team); err != nil {
+		return err
+	}
+	if err := s.setMembersTx(tx, team, nil, members); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ChangeMembers replaces the team's members with what change returns for the
+// current ones, in id order. All members must be existing users.
+func (s *TeamService) ChangeMembers(team string, ifMatch repo.IfMatch, change func(current []string) ([]string, error)) error {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := s.repo.LockTeamTx(tx, team); err != nil {
+		return err
+	}
+	if err := s.repo.CheckTeamVersionTx(tx, team, ifMatch); err != nil {
+		return err
+	}
+	snap, err := s.repo.TeamSnapshotTx(tx, team)
+	if err != nil {
+		return err
+	}
+	next, err := change(snap.Members)
+	if err != nil {
+		return err
+	}
+	if err := s.setMembersTx(tx, team, snap.Members, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *TeamService) setMembersTx(tx *sqlx.Tx, team string, current, next []string) error {
+	users, err := s.repo.UserSnapshotsTx(tx, next)
+	if err != nil {
+		return err
+	}
+	want := make(map[string]bool, len(next))
+	for _, id := range next {
+		if _, ok := users[id]; !ok {
+			return fmt.Errorf("%w: %s", repo.ErrUserNotFound, id)
+		}
+		want[id] = true
+	}
+
+	have := make(map[string]bool, len(current))
+	for _, id := range current {
+		have[id] = true
+		if !want[id] {
+			if err := s.repo.RemoveTeamMemberTx(tx, team, id); err != nil {
+				return err
+			}
+		}
+	}
+	for id := range want {
+		if !have[id] {
+			if err := s.repo.AddTeamMemberTx(tx, team, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
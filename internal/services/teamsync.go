@@ -0,0 +1,355 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/teamspec"
+)
+
+// PruneMode says what to do with stored members of a managed team that the
+// team file no longer lists.
+type PruneMode string
+
+const (
+	PruneNone       PruneMode = ""
+	PruneDeactivate PruneMode = "deactivate"
+	PruneRemove     PruneMode = "remove"
+)
+
+func ParsePruneMode(s string) (PruneMode, error) {
+	switch m := PruneMode(s); m {
+	case PruneNone, PruneDeactivate, PruneRemove:
+		return m, nil
+	}
+	return "", fmt.Errorf("prune mode %q is not one of deactivate, remove", s)
+}
+
+// ChangeOp marks a planned change the way it is printed.
+type ChangeOp string
+
+const (
+	OpAdd    ChangeOp = "+"
+	OpUpdate ChangeOp = "~"
+	OpRemove ChangeOp = "-"
+	// OpSkip is a difference that is reported but left alone.
+	OpSkip ChangeOp = "!"
+)
+
+type Change struct {
+	Op          ChangeOp
+	Description string
+	apply       func(tx *sqlx.Tx) error
+}
+
+// SyncPlan is the ordered list of changes that brings the stored teams in
+// line with a team file.
+type SyncPlan struct {
+	Changes []Change
+}
+
+// Counts returns how many changes of each applied kind the plan holds.
+func (p *SyncPlan) Counts() (add, update, remove int) {
+	for _, c := range p.Changes {
+		switch c.Op {
+		case OpAdd:
+			add++
+		case OpUpdate:
+			update++
+		case OpRemove:
+			remove++
+		}
+	}
+	return add, update, remove
+}
+
+// Print writes the plan in a form meant for review before apply.
+func (p *SyncPlan) Print(w io.Writer) error {
+	for _, c := range p.Changes {
+		if _, err := fmt.Fprintf(w, "%s %s\n", c.Op, c.Description); err != nil {
+			return err
+		}
+	}
+	add, update, remove := p.Counts()
+	if add+update+remove == 0 {
+		_, err := fmt.Fprintln(w, "No changes.")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nPlan: %d to add, %d to change, %d to remove.\n", add, update, remove)
+	return err
+}
+
+type TeamSyncService struct {
+	repo  *repo.SQLRepo
+	users *UserService
+}
+
+// Plan compares the team file with the database without changing anything.
+func (s *TeamSyncService) Plan(f *teamspec.File, prune PruneMode) (*SyncPlan, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	return s.planTx(tx, f, prune)
+}
+
+// Apply plans and applies the changes in one transaction and returns the plan
+// that was applied.
+func (s *TeamSyncService) Apply(f *teamspec.File, prune PruneMode) (*SyncPlan, error) {
+	return s.apply(f, prune, nil)
+}
+
+// ApplyTeam replaces a single team the way Apply with PruneRemove does. A
+// non-empty ifMatch makes it conditional on the team's version.
+func (s *TeamSyncService) ApplyTeam(t teamspec.Team, ifMatch repo.IfMatch) (*SyncPlan, error) {
+	return s.apply(&teamspec.File{Teams: []teamspec.Team{t}}, PruneRemove, func(tx *sqlx.Tx) error {
+		return s.repo.CheckTeamVersionTx(tx, t.Name, ifMatch)
+	})
+}
+
+func (s *TeamSyncService) apply(f *teamspec.File, prune PruneMode, check func(tx *sqlx.Tx) error) (*SyncPlan, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Keep the state the plan is built from until the changes are written.
+	if _, err := tx.Exec("LOCK TABLE teams, team_members IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(tx); err != nil {
+			return nil, err
+		}
+	}
+	plan, err := s.planTx(tx, f, prune)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range plan.Changes {
+		if c.apply == nil {
+			continue
+		}
+		if err := c.apply(tx); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", c.Op, c.Description, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *TeamSyncService) planTx(tx *sqlx.Tx, f *teamspec.File, prune PruneMode) (*SyncPlan, error) {
+	teams := map[string]*repo.TeamSnapshot{}
+	var ids []string
+	for _, t := range f.Teams {
+		snap, err := s.repo.TeamSnapshotTx(tx, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		teams[t.Name] = snap
+		for _, m := range t.Members {
+			ids = append(ids, m.UserID)
+		}
+		if snap != nil {
+			ids = append(ids, snap.Members...)
+		}
+	}
+	users, err := s.repo.UserSnapshotsTx(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildPlan(f, teams, users, prune), nil
+}
+
+// buildPlan diffs the file against the stored state. Changes are ordered so
+// that each one only depends on earlier ones: teams, users, memberships,
+// settings, fallbacks and finally pruning.
+func (s *TeamSyncService) buildPlan(f *teamspec.File, teams map[string]*repo.TeamSnapshot, users map[string]repo.UserSnapshot, prune PruneMode) *SyncPlan {
+	var newTeams, userChanges, members, settings, fallbacks, pruned []Change
+
+	listed := map[string]bool{}
+	for _, t := range f.Teams {
+		for _, m := range t.Members {
+			listed[m.UserID] = true
+		}
+	}
+
+	seenUsers := map[string]bool{}
+	deactivated := map[string]bool{}
+	for _, t := range f.Teams {
+		team := t.Name
+		cur := teams[team]
+		if cur == nil {
+			cur = &repo.TeamSnapshot{Name: team}
+			newTeams = append(newTeams, Change{OpAdd, "team " + team, func(tx *sqlx.Tx) error {
+				return s.repo.InsertTeamTx(tx, team)
+			}})
+		}
+
+		current := map[string]bool{}
+		for _, id := range cur.Members {
+			current[id] = true
+		}
+		for _, m := range t.Members {
+			m := m
+			if !seenUsers[m.UserID] {
+				seenUsers[m.UserID] = true
+				upsert := func(tx *sqlx.Tx) error {
+					return s.repo.UpsertUserTx(tx, m.UserID, m.Username, m.Active())
+				}
+				if u, ok := users[m.UserID]; !ok {
+					userChanges = append(userChanges, Change{OpAdd, fmt.Sprintf("user %s %q%s", m.UserID, m.Username, inactiveSuffix(m.Active())), upsert})
+				} else if diff := userDiff(u, m); diff != "" {
+					deactivate := u.IsActive && !m.Active()
+					userChanges = append(userChanges, Change{OpUpdate, fmt.Sprintf("user %s: %s", m.UserID, diff), func(tx *sqlx.Tx) error {
+						if err := upsert(tx); err != nil || !deactivate {
+							return err
+						}
+						_, err := s.users.handOffReviewsTx(tx, m.UserID)
+						return err
+					}})
+				}
+			}
+			if !current[m.UserID] {
+				members = append(members, Change{OpAdd, fmt.Sprintf("%s: member %s", team, m.UserID), func(tx *sqlx.Tx) error {
+					return s.repo.AddTeamMemberTx(tx, team, m.UserID)
+				}})
+			}
+		}
+
+		settings = append(settings, settingChanges(s, t, cur)...)
+
+		if t.FallbackTeams != nil && !equalStrings(t.FallbackTeams, cur.FallbackTeams) {
+			want := t.FallbackTeams
+			fallbacks = append(fallbacks, Change{OpUpdate, fmt.Sprintf("%s: fallback_teams: %s -> %s", team, listString(cur.FallbackTeams), listString(want)), func(tx *sqlx.Tx) error {
+				return s.repo.SetTeamFallbacksTx(tx, team, want)
+			}})
+		}
+
+		inFile := map[string]bool{}
+		for _, m := range t.Members {
+			inFile[m.UserID] = true
+		}
+		for _, id := range cur.Members {
+			id := id
+			if inFile[id] {
+				continue
+			}
+			switch {
+			case prune == PruneRemove:
+				pruned = append(pruned, Change{OpRemove, fmt.Sprintf("%s: member %s", team, id), func(tx *sqlx.Tx) error {
+					return s.repo.RemoveTeamMemberTx(tx, team, id)
+				}})
+			case prune == PruneDeactivate && !listed[id] && users[id].IsActive && !deactivated[id]:
+				deactivated[id] = true
+				pruned = append(pruned, Change{OpUpdate, fmt.Sprintf("user %s: is_active true -> false (not listed in %s)", id, team), func(tx *sqlx.Tx) error {
+					_, err := s.users.setActiveTx(tx, id, false)
+					return err
+				}})
+			case prune == PruneNone:
+				pruned = append(pruned, Change{Op: OpSkip, Description: fmt.Sprintf("%s: member %s is not in the file, kept (use -prune=remove or -prune=deactivate)", team, id)})
+			}
+		}
+	}
+
+	plan := &SyncPlan{}
+	for _, phase := range [][]Change{newTeams, userChanges, members, settings, fallbacks, pruned} {
+		plan.Changes = append(plan.Changes, phase...)
+	}
+	return plan
+}
+
+func settingChanges(s *TeamSyncService, t teamspec.Team, cur *repo.TeamSnapshot) []Change {
+	var out []Change
+	add := func(field, from, to string, upd repo.TeamSettingsUpdate) {
+		if from == to {
+			return
+		}
+		team := t.Name
+		out = append(out, Change{OpUpdate, fmt.Sprintf("%s: %s: %s -> %s", team, field, from, to), func(tx *sqlx.Tx) error {
+			return s.repo.UpdateTeamSettingsTx(tx, team, upd)
+		}})
+	}
+
+	if t.MaxOpenReviews != nil {
+		add("max_open_reviews", intString(cur.MaxOpenReviews), intString(t.MaxOpenReviews), repo.TeamSettingsUpdate{MaxOpenReviews: t.MaxOpenReviews})
+	}
+	if t.RequiredApprovals != nil {
+		add("required_approvals", intString(cur.RequiredApprovals), intString(t.RequiredApprovals), repo.TeamSettingsUpdate{RequiredApprovals: t.RequiredApprovals})
+	}
+	if t.Lead != nil {
+		add("lead", orDash(cur.LeadUserID), orDash(*t.Lead), repo.TeamSettingsUpdate{LeadUserID: t.Lead})
+	}
+	if t.SLA != nil && t.SLA.FirstResponse != nil {
+		add("sla.first_response", durationString(cur.FirstResponseSLA), durationString(t.SLA.FirstResponse), repo.TeamSettingsUpdate{FirstResponseSLA: t.SLA.FirstResponse})
+	}
+	if t.SLA != nil && t.SLA.Verdict != nil {
+		add("sla.verdict", durationString(cur.VerdictSLA), durationString(t.SLA.Verdict), repo.TeamSettingsUpdate{VerdictSLA: t.SLA.Verdict})
+	}
+	return out
+}
+
+func userDiff(u repo.UserSnapshot, m teamspec.Member) string {
+	var diffs []string
+	if u.Name != m.Username {
+		diffs = append(diffs, fmt.Sprintf("username %q -> %q", u.Name, m.Username))
+	}
+	if u.IsActive != m.Active() {
+		diffs = append(diffs, fmt.Sprintf("is_active %t -> %t", u.IsActive, m.Active()))
+	}
+	return strings.Join(diffs, ", ")
+}
+
+func inactiveSuffix(active bool) string {
+	if active {
+		return ""
+	}
+	return " (inactive)"
+}
+
+func intString(v *int) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.Itoa(*v)
+}
+
+func durationString(d *time.Duration) string {
+	if d == nil {
+		return "-"
+	}
+	return d.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func listString(list []string) string {
+	return "[" + strings.Join(list, ", ") + "]"
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
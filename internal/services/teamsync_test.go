@@ -0,0 +1,94 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/repo"
+	"github.com/example/prreview/internal/teamspec"
+)
+
+func planLines(p *SyncPlan) []string {
+	var out []string
+	for _, c := range p.Changes {
+		out = append(out, string(c.Op)+" "+c.Description)
+	}
+	return out
+}
+
+func TestBuildPlan(t *testing.T) {
+	f, err := teamspec.Parse(strings.NewReader(`
+teams:
+  - name: backend
+    members:
+      - {user_id: u1, username: Alice}
+      - {user_id: u2, username: Bob, is_active: false}
+      - {user_id: u4, username: Dan}
+    fallback_teams: [platform]
+    required_approvals: 2
+    sla: {first_response: 8h}
+  - name: platform
+    members:
+      - {user_id: u4, username: Dan}
+`))
+	require.NoError(t, err)
+
+	two, one := 2, 1
+	first := 8 * time.Hour
+	teams := map[string]*repo.TeamSnapshot{
+		"backend": {
+			Name:              "backend",
+			Members:           []string{"u1", "u2", "u3"},
+			RequiredApprovals: &one,
+			FirstResponseSLA:  &first,
+		},
+	}
+	users := map[string]repo.UserSnapshot{
+		"u1": {Name: "Alice", IsActive: true},
+		"u2": {Name: "Bobby", IsActive: true},
+		"u3": {Name: "Carol", IsActive: true},
+	}
+	s := &TeamSyncService{}
+
+	plan := s.buildPlan(f, teams, users, PruneNone)
+	require.Equal(t, []string{
+		"+ team platform",
+		`~ user u2: username "Bobby" -> "Bob", is_active true -> false`,
+		`+ user u4 "Dan"`,
+		"+ backend: member u4",
+		"+ platform: member u4",
+		"~ backend: required_approvals: 1 -> 2",
+		"~ backend: fallback_teams: [] -> [platform]",
+		"! backend: member u3 is not in the file, kept (use -prune=remove or -prune=deactivate)",
+	}, planLines(plan))
+	add, update, remove := plan.Counts()
+	require.Equal(t, [3]int{4, 3, 0}, [3]int{add, update, remove})
+
+	var out bytes.Buffer
+	require.NoError(t, plan.Print(&out))
+	require.True(t, strings.HasSuffix(out.String(), "Plan: 4 to add, 3 to change, 0 to remove.\n"))
+
+	plan = s.buildPlan(f, teams, users, PruneRemove)
+	require.Equal(t, "- backend: member u3", planLines(plan)[len(plan.Changes)-1])
+
+	plan = s.buildPlan(f, teams, users, PruneDeactivate)
+	require.Equal(t, "~ user u3: is_active true -> false (not listed in backend)", planLines(plan)[len(plan.Changes)-1])
+
+	// A member moved to another team in the file keeps being active.
+	teams["platform"] = &repo.TeamSnapshot{Name: "platform", Members: []string{"u4", "u1"}}
+	users["u4"] = repo.UserSnapshot{Name: "Dan", IsActive: true}
+	teams["backend"].Members = []string{"u1", "u2", "u4"}
+	teams["backend"].RequiredApprovals = &two
+	teams["backend"].FallbackTeams = []string{"platform"}
+	users["u2"] = repo.UserSnapshot{Name: "Bob"}
+	plan = s.buildPlan(f, teams, users, PruneDeactivate)
+	require.Empty(t, plan.Changes)
+
+	out.Reset()
+	require.NoError(t, plan.Print(&out))
+	require.Equal(t, "No changes.\n", out.String())
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/example/prreview/internal/models"
+	"github.com/example/prreview/internal/repo"
+)
+
+var ErrUserHasPRs = errors.New("user is the author of PRs")
+
+type UserService struct {
+	repo *repo.SQLRepo
+	pr   *PRService
+}
+
+// Delete removes a user who has not authored any PR; such users can only be
+// deactivated. The user's OPEN reviews are reassigned first, or dropped when
+// there is no candidate. It returns the new reviewer per PR, "" for dropped.
+func (s *UserService) Delete(userID string, ifMatch repo.IfMatch) (map[string]string, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := s.repo.GetUserTx(tx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CheckUserVersionTx(tx, userID, ifMatch); err != nil {
+		return nil, err
+	}
+	authored, err := s.repo.CountAuthoredPRsTx(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if authored > 0 {
+		return nil, fmt.Errorf("%w: %d, deactivate the user instead", ErrUserHasPRs, authored)
+	}
+
+	// Reviews left without a candidate go away with the user.
+	replaced, err := s.handOffReviewsTx(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.DeleteUserTx(tx, userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+// Update changes the user's profile and, when active is set, the active flag.
+// Deactivating a user reassigns their OPEN reviews the way
+// /pullRequest/reassign does; a review without a candidate stays assigned.
+// It returns the user and the new reviewer per PR, "" for kept reviews.
+func (s *UserService) Update(userID string, upd repo.UserUpdate, active *bool) (*models.UserResp, map[string]string, error) {
+	tx, err := s.repo.Beginx()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	cur, err := s.repo.GetUserTx(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.repo.UpdateUserTx(tx, userID, upd); err != nil {
+		return nil, nil, err
+	}
+	replaced := map[string]string{}
+	if active != nil && *active != cur.IsActive {
+		if replaced, err = s.setActiveTx(tx, userID, *active); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.repo.GetUser(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, replaced, nil
+}
+
+func (s *UserService) setActiveTx(tx *sqlx.Tx, userID string, active bool) (map[string]string, error) {
+	if err := s.repo.SetUserActiveTx(tx, userID, active); err != nil {
+		return nil, err
+	}
+	if active {
+		return map[string]string{}, nil
+	}
+	return s.handOffReviewsTx(tx, userID)
+}
+
+// handOffReviewsTx reassigns the user's OPEN reviews. It returns the new
+// reviewer per PR, "" where there was no candidate and the user stays.
+func (s *UserService) handOffReviewsTx(tx *sqlx.Tx, userID string) (map[string]string, error) {
+	prIDs, err := s.repo.OpenReviewPRsTx(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	replaced := make(map[string]string, len(prIDs))
+	for _, prID := range prIDs {
+		newID, err := s.pr.reassignTx(tx, prID, userID)
+		if err != nil && !errors.Is(err, ErrNoCandidate) {
+			return nil, err
+		}
+		replaced[prID] = newID
+	}
+	return replaced, nil
+}
@@ -0,0 +1,93 @@
+// Package slack verifies Slack slash-command requests and builds the
+// block-formatted messages sent back in reply.
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSkew is how old a request may be before it is rejected as a replay.
+const MaxSkew = 5 * time.Minute
+
+var (
+	ErrBadSignature = errors.New("invalid request signature")
+	ErrStale        = errors.New("request timestamp too old")
+)
+
+// Verify checks the X-Slack-Signature of a request with body, as described in
+// https://api.slack.com/authentication/verifying-requests-from-slack.
+func Verify(secret string, h http.Header, body []byte, now time.Time) error {
+	ts := h.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > MaxSkew || d < -MaxSkew {
+		return ErrStale
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(h.Get("X-Slack-Signature"), "v0="))
+	if err != nil || !hmac.Equal(got, sign(secret, ts, body)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Sign returns the X-Slack-Signature header value for body sent at ts.
+func Sign(secret string, ts time.Time, body []byte) string {
+	return "v0=" + hex.EncodeToString(sign(secret, strconv.FormatInt(ts.Unix(), 10), body))
+}
+
+func sign(secret, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+const (
+	Ephemeral = "ephemeral"
+	InChannel = "in_channel"
+)
+
+// Message is a slash-command response. Text is the fallback shown in
+// notifications.
+type Message struct {
+	ResponseType string  `json:"response_type"`
+	Text         string  `json:"text"`
+	Blocks       []Block `json:"blocks,omitempty"`
+}
+
+type Block struct {
+	Type     string  `json:"type"`
+	Text     *Text   `json:"text,omitempty"`
+	Elements []*Text `json:"elements,omitempty"`
+}
+
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func Header(text string) Block {
+	return Block{Type: "header", Text: &Text{Type: "plain_text", Text: text}}
+}
+
+func Section(mrkdwn string) Block {
+	return Block{Type: "section", Text: &Text{Type: "mrkdwn", Text: mrkdwn}}
+}
+
+func Context(mrkdwn string) Block {
+	return Block{Type: "context", Elements: []*Text{{Type: "mrkdwn", Text: mrkdwn}}}
+}
+
+// Escape makes s safe to embed in mrkdwn text.
+func Escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
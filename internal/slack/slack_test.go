@@ -0,0 +1,34 @@
+package slack
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	// Example from Slack's documentation.
+	body := []byte("token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c")
+	h := http.Header{}
+	h.Set("X-Slack-Request-Timestamp", "1531420618")
+	h.Set("X-Slack-Signature", "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503")
+	secret := "8f742231b10e8888abcd99yyyzzz85a5"
+	at := time.Unix(1531420618, 0)
+
+	require.NoError(t, Verify(secret, h, body, at.Add(time.Minute)))
+	require.ErrorIs(t, Verify("other", h, body, at), ErrBadSignature)
+	require.ErrorIs(t, Verify(secret, h, append(body, 'x'), at), ErrBadSignature)
+	require.ErrorIs(t, Verify(secret, h, body, at.Add(MaxSkew+time.Second)), ErrStale)
+
+	h.Set("X-Slack-Signature", Sign(secret, at, body))
+	require.NoError(t, Verify(secret, h, body, at))
+
+	h.Del("X-Slack-Request-Timestamp")
+	require.ErrorIs(t, Verify(secret, h, body, at), ErrBadSignature)
+}
+
+func TestEscape(t *testing.T) {
+	require.Equal(t, "a &lt;b&gt; &amp; &lt;!channel&gt;", Escape("a <b> & <!channel>"))
+}
@@ -0,0 +1,133 @@
+// Package teamspec reads declarative team files: the desired teams, their
+// members and settings, kept in git and applied with `prreview apply`.
+package teamspec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a team file. Only the teams it lists are managed.
+type File struct {
+	Teams []Team `yaml:"teams"`
+}
+
+// Team describes one team. Settings left out of the file are not managed and
+// keep whatever value is stored; an empty fallback_teams list or lead clears it.
+type Team struct {
+	Name              string   `yaml:"name"`
+	Members           []Member `yaml:"members"`
+	FallbackTeams     []string `yaml:"fallback_teams"`
+	MaxOpenReviews    *int     `yaml:"max_open_reviews"`
+	RequiredApprovals *int     `yaml:"required_approvals"`
+	Lead              *string  `yaml:"lead"`
+	SLA               *SLA     `yaml:"sla"`
+}
+
+type SLA struct {
+	FirstResponse *time.Duration `yaml:"first_response"`
+	Verdict       *time.Duration `yaml:"verdict"`
+}
+
+type Member struct {
+	UserID   string `yaml:"user_id"`
+	Username string `yaml:"username"`
+	// IsActive defaults to true.
+	IsActive *bool `yaml:"is_active"`
+}
+
+func (m Member) Active() bool {
+	return m.IsActive == nil || *m.IsActive
+}
+
+// Load reads and validates the team file at path.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Parse decodes a team file, rejecting unknown keys, and validates it.
+func Parse(r io.Reader) (*File, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var f File
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Validate reports every problem in the file at once.
+func (f *File) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	teams := map[string]bool{}
+	usernames := map[string]string{}
+	active := map[string]bool{}
+	for i, t := range f.Teams {
+		where := fmt.Sprintf("teams[%d]", i)
+		if t.Name == "" {
+			add("%s: name is required", where)
+		} else if teams[t.Name] {
+			add("%s: team %q is listed twice", where, t.Name)
+		}
+		teams[t.Name] = true
+
+		members := map[string]bool{}
+		for j, m := range t.Members {
+			at := fmt.Sprintf("%s.members[%d]", where, j)
+			if m.UserID == "" || m.Username == "" {
+				add("%s: user_id and username are required", at)
+				continue
+			}
+			if members[m.UserID] {
+				add("%s: %s is listed twice in team %q", at, m.UserID, t.Name)
+			}
+			members[m.UserID] = true
+			if name, ok := usernames[m.UserID]; ok && (name != m.Username || active[m.UserID] != m.Active()) {
+				add("%s: %s differs from its entry in another team", at, m.UserID)
+			}
+			usernames[m.UserID], active[m.UserID] = m.Username, m.Active()
+		}
+
+		for _, fb := range t.FallbackTeams {
+			if fb == t.Name {
+				add("%s: team cannot be its own fallback", where)
+			}
+		}
+		if t.MaxOpenReviews != nil && *t.MaxOpenReviews < 0 {
+			add("%s.max_open_reviews: must not be negative", where)
+		}
+		if t.RequiredApprovals != nil && *t.RequiredApprovals < 0 {
+			add("%s.required_approvals: must not be negative", where)
+		}
+		if t.SLA != nil {
+			if t.SLA.FirstResponse != nil && *t.SLA.FirstResponse < 0 {
+				add("%s.sla.first_response: must not be negative", where)
+			}
+			if t.SLA.Verdict != nil && *t.SLA.Verdict < 0 {
+				add("%s.sla.verdict: must not be negative", where)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
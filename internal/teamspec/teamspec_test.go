@@ -0,0 +1,61 @@
+package teamspec
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(`
+teams:
+  - name: backend
+    members:
+      - {user_id: u1, username: Alice}
+      - {user_id: u2, username: Bob, is_active: false}
+    fallback_teams: [platform]
+    required_approvals: 2
+    sla: {first_response: 8h}
+`))
+	require.NoError(t, err)
+	require.Len(t, f.Teams, 1)
+	team := f.Teams[0]
+	require.True(t, team.Members[0].Active())
+	require.False(t, team.Members[1].Active())
+	require.Equal(t, []string{"platform"}, team.FallbackTeams)
+	require.Equal(t, 2, *team.RequiredApprovals)
+	require.Nil(t, team.MaxOpenReviews)
+	require.Equal(t, 8*time.Hour, *team.SLA.FirstResponse)
+	require.Nil(t, team.SLA.Verdict)
+}
+
+func TestParseRejectsUnknownKeysAndReportsAllErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader("teams:\n  - name: a\n    owner: u1\n"))
+	require.ErrorContains(t, err, "owner")
+
+	_, err = Parse(strings.NewReader(`
+teams:
+  - name: a
+    members:
+      - {user_id: u1, username: Alice}
+      - {user_id: u1, username: Alice}
+    fallback_teams: [a]
+  - name: b
+    members:
+      - {user_id: u1, username: Alicia}
+    required_approvals: -1
+  - name: a
+`))
+	require.Error(t, err)
+	for _, want := range []string{
+		"listed twice in team",
+		"own fallback",
+		"differs from its entry",
+		"required_approvals",
+		`team "a" is listed twice`,
+	} {
+		require.ErrorContains(t, err, want)
+	}
+}
@@ -0,0 +1,166 @@
+// Package testdb starts the PostgreSQL the integration tests run against.
+package testdb
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+// Env names a PostgreSQL URL to create the test databases on instead of
+// starting a container.
+const Env = "PRREVIEW_TEST_DATABASE_URL"
+
+// ErrUnavailable is returned by Open when there is no database to run on.
+// It is never returned when the CI variable is set: there a missing database
+// is an error, not a reason to skip.
+var ErrUnavailable = errors.New("docker is not available and " + Env + " is not set")
+
+var created atomic.Int64
+
+// MigrationsDir is the repository's migrations directory.
+var MigrationsDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "migrations")
+}()
+
+// Database is a PostgreSQL database owned by one test or test binary.
+type Database struct {
+	*sqlx.DB
+	// URL connects to the same database, for code that opens its own pool.
+	URL string
+
+	close func() error
+}
+
+// Open creates a fresh database on the server named by Env, or starts a
+// PostgreSQL container when it is not set. migrate, when not nil, is applied
+// to MigrationsDir; it is passed in rather than imported so that the repo
+// package's own tests can use Open.
+func Open(migrate func(db *sqlx.DB, dir string) error) (*Database, error) {
+	var d *Database
+	var err error
+	if base := os.Getenv(Env); base != "" {
+		d, err = create(base)
+	} else {
+		d, err = start()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if migrate != nil {
+		if err := migrate(d.DB, MigrationsDir); err != nil {
+			_ = d.Close()
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// create makes a database of its own on an existing server, so that tests
+// and packages running in parallel do not share tables.
+func create(base string) (*Database, error) {
+	admin, err := sqlx.Connect("postgres", base)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", Env, err)
+	}
+	name := fmt.Sprintf("prreview_test_%d_%d", os.Getpid(), created.Add(1))
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		_ = admin.Close()
+		return nil, fmt.Errorf("create database: %w", err)
+	}
+	drop := func() error {
+		_, err := admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)")
+		if cerr := admin.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		_ = drop()
+		return nil, fmt.Errorf("parse %s: %w", Env, err)
+	}
+	u.Path = "/" + name
+	db, err := sqlx.Connect("postgres", u.String())
+	if err != nil {
+		_ = drop()
+		return nil, fmt.Errorf("connect to %s: %w", name, err)
+	}
+	return &Database{DB: db, URL: u.String(), close: drop}, nil
+}
+
+// start runs a PostgreSQL container that is removed on Close.
+func start() (*Database, error) {
+	pool, err := dockertest.NewPool("")
+	if err == nil {
+		err = pool.Client.Ping()
+	}
+	if err != nil {
+		if os.Getenv("CI") != "" {
+			return nil, fmt.Errorf("%s (CI is set): %v", ErrUnavailable, err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "16",
+		Env:        []string{"POSTGRES_USER=pruser", "POSTGRES_PASSWORD=prpass", "POSTGRES_DB=pr_review"},
+	}, func(h *docker.HostConfig) {
+		h.AutoRemove = true
+		h.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("start postgres: %w", err)
+	}
+	_ = resource.Expire(600)
+	purge := func() error { return pool.Purge(resource) }
+
+	dsn := fmt.Sprintf("postgres://pruser:prpass@%s/pr_review?sslmode=disable", resource.GetHostPort("5432/tcp"))
+	var db *sqlx.DB
+	if err := pool.Retry(func() error {
+		db, err = sqlx.Connect("postgres", dsn)
+		return err
+	}); err != nil {
+		_ = purge()
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+	return &Database{DB: db, URL: dsn, close: purge}, nil
+}
+
+// Close closes the connection pool and removes the database.
+func (d *Database) Close() error {
+	err := d.DB.Close()
+	if cerr := d.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// New is Open for a single test. The test is skipped when Open reports
+// ErrUnavailable and fails on any other error; the database is removed when
+// the test ends.
+func New(t testing.TB, migrate func(db *sqlx.DB, dir string) error) *Database {
+	t.Helper()
+	d, err := Open(migrate)
+	if errors.Is(err, ErrUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	return d
+}
@@ -0,0 +1,13 @@
+CREATE TABLE idempotency_keys (
+    client TEXT NOT NULL DEFAULT '',
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INT,
+    content_type TEXT NOT NULL DEFAULT '',
+    response_body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (client, key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires ON idempotency_keys(expires_at);
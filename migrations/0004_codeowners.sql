@@ -0,0 +1,11 @@
+CREATE TABLE team_codeowners (
+    team_name TEXT PRIMARY KEY REFERENCES teams(name) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE pr_files (
+    pr_id TEXT NOT NULL REFERENCES prs(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    PRIMARY KEY (pr_id, path)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE team_fallbacks (
+    team_name TEXT NOT NULL REFERENCES teams(name) ON DELETE CASCADE,
+    position INT NOT NULL,
+    fallback_team TEXT NOT NULL REFERENCES teams(name) ON DELETE CASCADE,
+    PRIMARY KEY (team_name, position),
+    UNIQUE (team_name, fallback_team),
+    CHECK (team_name <> fallback_team)
+);
+
+ALTER TABLE pr_reviewers ADD COLUMN source_team TEXT REFERENCES teams(name) ON DELETE SET NULL;
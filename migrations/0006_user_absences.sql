@@ -0,0 +1,22 @@
+CREATE TABLE user_absences (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_user_absences_user ON user_absences(user_id, ends_at);
+
+CREATE TABLE absence_handoffs (
+    absence_id BIGINT NOT NULL REFERENCES user_absences(id) ON DELETE CASCADE,
+    pr_id TEXT NOT NULL REFERENCES prs(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'ACCEPTED', 'DECLINED', 'OBSOLETE')),
+    replaced_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (absence_id, pr_id)
+);
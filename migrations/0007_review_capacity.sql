@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN max_open_reviews INT CHECK (max_open_reviews >= 0);
+ALTER TABLE teams ADD COLUMN default_max_open_reviews INT CHECK (default_max_open_reviews >= 0);
+
+CREATE INDEX idx_prs_status ON prs(status);
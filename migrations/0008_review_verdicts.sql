@@ -0,0 +1,23 @@
+CREATE TABLE pr_reviews (
+    id BIGSERIAL PRIMARY KEY,
+    pr_id TEXT NOT NULL REFERENCES prs(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    verdict TEXT NOT NULL CHECK (verdict IN ('APPROVED', 'CHANGES_REQUESTED', 'COMMENTED')),
+    comment TEXT NOT NULL DEFAULT '',
+    submitted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_pr_reviews_pr ON pr_reviews(pr_id, user_id, submitted_at DESC);
+
+ALTER TABLE teams ADD COLUMN required_approvals INT CHECK (required_approvals >= 0);
+
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    pr_id TEXT,
+    details JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX idx_audit_log_pr ON audit_log(pr_id, at);
@@ -0,0 +1,7 @@
+ALTER TABLE pr_reviewers ADD COLUMN assigned_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+ALTER TABLE pr_reviewers ADD COLUMN sla_reminded_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE pr_reviewers ADD COLUMN sla_escalated_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE teams ADD COLUMN sla_first_response_seconds BIGINT CHECK (sla_first_response_seconds >= 0);
+ALTER TABLE teams ADD COLUMN sla_verdict_seconds BIGINT CHECK (sla_verdict_seconds >= 0);
+ALTER TABLE teams ADD COLUMN lead_user_id TEXT REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN slack_user_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+CREATE INDEX idx_prs_author ON prs(author_id);
@@ -0,0 +1,7 @@
+ALTER TABLE teams ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+-- Merged PRs outlive their team: deleting a team clears their team_name.
+ALTER TABLE prs ALTER COLUMN team_name DROP NOT NULL;
+ALTER TABLE prs DROP CONSTRAINT prs_team_name_fkey;
+ALTER TABLE prs ADD CONSTRAINT prs_team_name_fkey
+    FOREIGN KEY (team_name) REFERENCES teams(name) ON DELETE SET NULL;
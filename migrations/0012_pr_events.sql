@@ -0,0 +1,3 @@
+-- Ids of the events sent to GET /events subscribers through NOTIFY pr_events.
+-- Taking them from one sequence gives every replica the same ids.
+CREATE SEQUENCE pr_event_ids;
@@ -0,0 +1,17 @@
+ALTER TABLE users ADD COLUMN notify_assignments BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE users ADD COLUMN notify_digest BOOLEAN NOT NULL DEFAULT true;
+-- Day of the last digest, claimed by the replica that sends it.
+ALTER TABLE users ADD COLUMN digest_sent_on DATE;
+
+-- Assignment emails queued in the transaction that assigns the reviewer and
+-- sent by a background job once it has committed.
+CREATE TABLE email_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    pr_id TEXT NOT NULL REFERENCES prs(id) ON DELETE CASCADE,
+    previous_reviewer_id TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
@@ -0,0 +1,5 @@
+-- Incremented by every write that changes what the API returns for the row,
+-- and sent to clients as the ETag for optimistic concurrency.
+ALTER TABLE teams ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE prs ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CreateAbsence plans an absence; the user's open reviews overlapping it are
+// offered for handoff.
+func (c *Client) CreateAbsence(ctx context.Context, userID string, startsAt, endsAt time.Time, reason string) (*Absence, error) {
+	in := map[string]interface{}{"user_id": userID, "starts_at": startsAt, "ends_at": endsAt, "reason": reason}
+	var out struct {
+		Absence Absence `json:"absence"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/users/absences/create", in: in}, &out); err != nil {
+		return nil, err
+	}
+	return &out.Absence, nil
+}
+
+// ListAbsences returns the user's current and planned absences, and past
+// ones with includePast.
+func (c *Client) ListAbsences(ctx context.Context, userID string, includePast bool) ([]Absence, error) {
+	q := url.Values{"user_id": {userID}, "include_past": {strconv.FormatBool(includePast)}}
+	var out struct {
+		Absences []Absence `json:"absences"`
+	}
+	if err := c.do(ctx, request{method: "GET", path: "/users/absences/list", query: q}, &out); err != nil {
+		return nil, err
+	}
+	return out.Absences, nil
+}
+
+func (c *Client) CancelAbsence(ctx context.Context, absenceID int64) (*Absence, error) {
+	in := map[string]int64{"absence_id": absenceID}
+	var out struct {
+		Absence Absence `json:"absence"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/users/absences/cancel", in: in}, &out); err != nil {
+		return nil, err
+	}
+	return &out.Absence, nil
+}
+
+func (c *Client) ListHandoffs(ctx context.Context, absenceID int64) ([]Handoff, error) {
+	q := url.Values{"absence_id": {strconv.FormatInt(absenceID, 10)}}
+	var out struct {
+		Handoffs []Handoff `json:"handoffs"`
+	}
+	if err := c.do(ctx, request{method: "GET", path: "/users/absences/handoffs", query: q}, &out); err != nil {
+		return nil, err
+	}
+	return out.Handoffs, nil
+}
+
+// AcceptHandoffs reassigns the pending handoffs of an absence, or only those
+// of prIDs when it is not empty.
+func (c *Client) AcceptHandoffs(ctx context.Context, absenceID int64, prIDs []string) ([]Handoff, error) {
+	return c.resolveHandoffs(ctx, "/users/absences/handoffs/accept", absenceID, prIDs)
+}
+
+// DeclineHandoffs keeps the reviews of the pending handoffs with the absent
+// user, selected as in AcceptHandoffs.
+func (c *Client) DeclineHandoffs(ctx context.Context, absenceID int64, prIDs []string) ([]Handoff, error) {
+	return c.resolveHandoffs(ctx, "/users/absences/handoffs/decline", absenceID, prIDs)
+}
+
+func (c *Client) resolveHandoffs(ctx context.Context, path string, absenceID int64, prIDs []string) ([]Handoff, error) {
+	in := map[string]interface{}{"absence_id": absenceID}
+	if len(prIDs) > 0 {
+		in["pull_request_ids"] = prIDs
+	}
+	var out struct {
+		Handoffs []Handoff `json:"handoffs"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: path, in: in}, &out); err != nil {
+		return nil, err
+	}
+	return out.Handoffs, nil
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Import loads a team and user directory in format FormatCSV or FormatJSON.
+// Nothing is imported if a row is invalid; the *Error then has the code
+// INVALID_IMPORT and lists the rows. dryRun reports the changes without
+// making them. Needs an admin token.
+func (c *Client) Import(ctx context.Context, data []byte, format string, dryRun bool) (*ImportSummary, error) {
+	if data == nil {
+		data = []byte{}
+	}
+	q := url.Values{"format": {format}, "dry_run": {strconv.FormatBool(dryRun)}}
+	contentType := "text/csv"
+	if format == FormatJSON {
+		contentType = "application/json"
+	}
+	var out struct {
+		Summary ImportSummary `json:"summary"`
+	}
+	req := request{method: "POST", path: "/bulk/import", query: q, body: data, contentType: contentType}
+	if err := c.do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out.Summary, nil
+}
+
+// Export returns every team and user in the form Import reads. Needs an
+// admin token.
+func (c *Client) Export(ctx context.Context, format string) ([]byte, error) {
+	return c.doRaw(ctx, request{method: "GET", path: "/bulk/export", query: url.Values{"format": {format}}})
+}
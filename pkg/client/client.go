@@ -0,0 +1,318 @@
+// Package client is a typed Go client for the PR reviewer service API.
+//
+// Every method takes a context and returns an *Error for API errors, so
+// callers can branch on the error code:
+//
+//	c, _ := client.New("http://prreview:8080", client.WithToken(token))
+//	pr, err := c.CreatePR(ctx, client.NewPR{ID: "pr-1", Title: "Fix", AuthorID: "u1"})
+//	if client.ErrorCode(err) == client.CodePRExists { ... }
+//
+// GET requests are retried with exponential backoff on network errors, 429
+// and 502-504 responses. POST requests carry a generated Idempotency-Key, so
+// the server replays their first outcome and they are retried the same way.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API error codes, see the ErrorResponse schema in openapi.yaml.
+const (
+	CodeBadRequest            = "BAD_REQUEST"
+	CodeUnauthorized          = "UNAUTHORIZED"
+	CodeForbidden             = "FORBIDDEN"
+	CodeNotFound              = "NOT_FOUND"
+	CodeTeamExists            = "TEAM_EXISTS"
+	CodePRExists              = "PR_EXISTS"
+	CodeUserExists            = "USER_EXISTS"
+	CodePRMerged              = "PR_MERGED"
+	CodeNotAssigned           = "NOT_ASSIGNED"
+	CodeNoCandidate           = "NO_CANDIDATE"
+	CodeNotApproved           = "NOT_APPROVED"
+	CodeTeamArchived          = "TEAM_ARCHIVED"
+	CodeTeamHasOpenPRs        = "TEAM_HAS_OPEN_PRS"
+	CodeUserHasPRs            = "USER_HAS_PRS"
+	CodeAmbiguousTeam         = "AMBIGUOUS_TEAM"
+	CodeInvalidSuccessor      = "INVALID_SUCCESSOR"
+	CodeInvalidCodeowners     = "INVALID_CODEOWNERS"
+	CodeFallbackCycle         = "FALLBACK_CYCLE"
+	CodeInvalidAbsence        = "INVALID_ABSENCE"
+	CodeAbsenceClosed         = "ABSENCE_CLOSED"
+	CodePreconditionFailed    = "PRECONDITION_FAILED"
+	CodeInvalidImport         = "INVALID_IMPORT"
+	CodeRateLimited           = "RATE_LIMITED"
+	CodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyInProgress = "IDEMPOTENCY_IN_PROGRESS"
+	CodeInternal              = "INTERNAL"
+	// CodeError was the catch-all code of /pullRequest/reassign, which now
+	// reports PR_MERGED, NOT_ASSIGNED or NO_CANDIDATE. It is left for 409
+	// responses without an error body.
+	CodeError = "ERROR"
+)
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// Rows lists the problems of a rejected import.
+	Rows []ImportRowError
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("prreview: %s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// ErrorCode returns the API error code of err, or "" if err is not an *Error.
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithToken authenticates requests with an API token.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient replaces http.DefaultClient.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.httpClient = h }
+}
+
+// WithRetries sets how many times a request is retried and the bounds of
+// the backoff between attempts. The default is 3 retries, 100ms to 2s.
+func WithRetries(max int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries, c.minBackoff, c.maxBackoff = max, minBackoff, maxBackoff
+	}
+}
+
+// New returns a client for the service at baseURL, e.g. http://localhost:8080.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("prreview: base URL %q must be http or https", baseURL)
+	}
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: 3,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// request describes one API call. body is sent as is when set, otherwise in
+// is encoded as JSON.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	in          interface{}
+	body        []byte
+	contentType string
+}
+
+// do performs req and decodes a successful JSON response into out.
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	raw, err := c.doRaw(ctx, req)
+	if err != nil || out == nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("prreview: decode %s response: %w", req.path, err)
+	}
+	return nil
+}
+
+func (c *Client) doRaw(ctx context.Context, req request) ([]byte, error) {
+	body, contentType := req.body, req.contentType
+	if body == nil && req.in != nil {
+		var err error
+		if body, err = json.Marshal(req.in); err != nil {
+			return nil, err
+		}
+		contentType = "application/json"
+	}
+	target := c.baseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+	key := ""
+	if req.method == http.MethodPost {
+		key = newIdempotencyKey()
+	}
+
+	for attempt := 0; ; attempt++ {
+		raw, retryAfter, err := c.attempt(ctx, req.method, target, body, contentType, key)
+		if err == nil {
+			return raw, nil
+		}
+		if attempt >= c.maxRetries || !retryable(err) {
+			return nil, err
+		}
+		if err := sleep(ctx, c.backoff(attempt, retryAfter)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, target string, body []byte, contentType, key string) ([]byte, time.Duration, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, &transportError{err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, &transportError{err}
+	}
+	if resp.StatusCode >= 300 {
+		retryAfter := time.Duration(0)
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(s) * time.Second
+		}
+		return nil, retryAfter, decodeError(resp.StatusCode, raw)
+	}
+	return raw, 0, nil
+}
+
+// transportError is a failure to get a response at all.
+type transportError struct{ err error }
+
+func (e *transportError) Error() string { return "prreview: " + e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+func retryable(err error) bool {
+	var te *transportError
+	if errors.As(err, &te) {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return e.Code == CodeIdempotencyInProgress
+}
+
+// backoff doubles from minBackoff up to maxBackoff with full jitter; a
+// Retry-After from the server takes precedence.
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	d := c.minBackoff << uint(attempt)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(mathrand.Int63n(int64(d)) + 1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// decodeError reads {"error": {"code", "message"}}. Plain text errors, which
+// the API uses for malformed requests, get a code from the status.
+func decodeError(status int, raw []byte) error {
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Rows []ImportRowError `json:"rows"`
+	}
+	if json.Unmarshal(raw, &body) == nil && body.Error.Code != "" {
+		return &Error{StatusCode: status, Code: body.Error.Code, Message: body.Error.Message, Rows: body.Rows}
+	}
+
+	code := CodeInternal
+	switch status {
+	case http.StatusBadRequest:
+		code = CodeBadRequest
+	case http.StatusUnauthorized:
+		code = CodeUnauthorized
+	case http.StatusForbidden:
+		code = CodeForbidden
+	case http.StatusNotFound:
+		code = CodeNotFound
+	case http.StatusConflict:
+		code = CodeError
+	case http.StatusTooManyRequests:
+		code = CodeRateLimited
+	}
+	return &Error{StatusCode: status, Code: code, Message: strings.TrimSpace(string(raw))}
+}
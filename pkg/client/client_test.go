@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stub answers with the responses in order, repeating the last one, and
+// records the requests.
+type stub struct {
+	mu        sync.Mutex
+	responses []func(w http.ResponseWriter)
+	requests  []*http.Request
+	bodies    []string
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, string(body))
+	i := len(s.requests) - 1
+	if i >= len(s.responses) {
+		i = len(s.responses) - 1
+	}
+	s.responses[i](w)
+}
+
+func respond(status int, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if len(body) > 0 && body[0] == '{' {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+func newStubClient(t *testing.T, responses ...func(w http.ResponseWriter)) (*Client, *stub) {
+	t.Helper()
+	s := &stub{responses: responses}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL, WithToken("secret"), WithRetries(3, time.Millisecond, 5*time.Millisecond))
+	require.NoError(t, err)
+	return c, s
+}
+
+func TestErrorExposesCode(t *testing.T) {
+	c, _ := newStubClient(t, respond(409, `{"error":{"code":"PR_EXISTS","message":"PR pr-1 already exists"}}`))
+
+	_, err := c.CreatePR(context.Background(), NewPR{ID: "pr-1", Title: "t", AuthorID: "u1"})
+	require.Equal(t, CodePRExists, ErrorCode(err))
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, 409, apiErr.StatusCode)
+	require.Equal(t, "PR pr-1 already exists", apiErr.Message)
+}
+
+func TestPlainTextErrorGetsCodeFromStatus(t *testing.T) {
+	c, _ := newStubClient(t, respond(400, "team_name required\n"))
+
+	_, err := c.GetTeam(context.Background(), "")
+	require.Equal(t, CodeBadRequest, ErrorCode(err))
+	require.Equal(t, "team_name required", err.(*Error).Message)
+}
+
+func TestImportRowErrors(t *testing.T) {
+	c, s := newStubClient(t, respond(400, `{"error":{"code":"INVALID_IMPORT","message":"1 invalid rows, nothing imported"},"rows":[{"row":2,"message":"username is required"}]}`))
+
+	_, err := c.Import(context.Background(), []byte("team_name,user_id,username\nbackend,u1,\n"), FormatCSV, false)
+	require.Equal(t, CodeInvalidImport, ErrorCode(err))
+	require.Equal(t, []ImportRowError{{Row: 2, Message: "username is required"}}, err.(*Error).Rows)
+	require.Equal(t, "text/csv", s.requests[0].Header.Get("Content-Type"))
+	require.Equal(t, "csv", s.requests[0].URL.Query().Get("format"))
+}
+
+func TestGetRetriesOnUnavailable(t *testing.T) {
+	c, s := newStubClient(t,
+		respond(503, "unavailable"),
+		respond(502, "bad gateway"),
+		respond(200, `{"team":{"team_name":"backend","members":[]}}`),
+	)
+
+	team, err := c.GetTeam(context.Background(), "backend")
+	require.NoError(t, err)
+	require.Equal(t, "backend", team.TeamName)
+	require.Len(t, s.requests, 3)
+	require.Equal(t, "Bearer secret", s.requests[2].Header.Get("Authorization"))
+}
+
+func TestPostRetryReusesIdempotencyKey(t *testing.T) {
+	c, s := newStubClient(t,
+		respond(429, `{"error":{"code":"RATE_LIMITED","message":"slow down"}}`),
+		respond(409, `{"error":{"code":"IDEMPOTENCY_IN_PROGRESS","message":"in progress"}}`),
+		respond(201, `{"pr":{"pull_request_id":"pr-1","status":"OPEN","assigned_reviewers":["u2"]}}`),
+	)
+
+	pr, err := c.CreatePR(context.Background(), NewPR{ID: "pr-1", Title: "t", AuthorID: "u1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"u2"}, pr.AssignedReviewers)
+	require.Len(t, s.requests, 3)
+
+	key := s.requests[0].Header.Get("Idempotency-Key")
+	require.NotEmpty(t, key)
+	for i, r := range s.requests {
+		require.Equal(t, key, r.Header.Get("Idempotency-Key"))
+		require.Equal(t, s.bodies[0], s.bodies[i])
+	}
+
+	_, err = c.CreatePR(context.Background(), NewPR{ID: "pr-2", Title: "t", AuthorID: "u1"})
+	require.NoError(t, err)
+	require.NotEqual(t, key, s.requests[3].Header.Get("Idempotency-Key"))
+}
+
+func TestNoRetryOnClientErrors(t *testing.T) {
+	c, s := newStubClient(t, respond(404, `{"error":{"code":"NOT_FOUND","message":"no such PR"}}`))
+
+	_, err := c.GetPR(context.Background(), "pr-x")
+	require.Equal(t, CodeNotFound, ErrorCode(err))
+	require.Len(t, s.requests, 1)
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	c, s := newStubClient(t, respond(503, "unavailable"))
+
+	_, err := c.GetUser(context.Background(), "u1")
+	require.Equal(t, 503, err.(*Error).StatusCode)
+	require.Len(t, s.requests, 4)
+}
+
+func TestContextStopsRetries(t *testing.T) {
+	s := &stub{responses: []func(http.ResponseWriter){respond(503, "unavailable")}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c, err := New(srv.URL, WithRetries(5, time.Hour, time.Hour))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.GetUser(ctx, "u1")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, s.requests, 1)
+}
+
+func TestNewRejectsBadURL(t *testing.T) {
+	_, err := New("localhost:8080")
+	require.Error(t, err)
+}
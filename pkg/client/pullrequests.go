@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"net/url"
+)
+
+// CreatePR registers a PR and assigns its reviewers.
+func (c *Client) CreatePR(ctx context.Context, pr NewPR) (*PullRequest, error) {
+	var out struct {
+		PR PullRequest `json:"pr"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/pullRequest/create", in: pr}, &out); err != nil {
+		return nil, err
+	}
+	return &out.PR, nil
+}
+
+func (c *Client) GetPR(ctx context.Context, prID string) (*PullRequest, error) {
+	var out struct {
+		PR PullRequest `json:"pr"`
+	}
+	if err := c.do(ctx, request{method: "GET", path: "/pullRequest/get", query: prQuery(prID)}, &out); err != nil {
+		return nil, err
+	}
+	return &out.PR, nil
+}
+
+// MergePR merges an approved PR; merging a merged PR is a no-op. opts may be
+// nil.
+func (c *Client) MergePR(ctx context.Context, prID string, opts *MergeOptions) (*MergedPR, error) {
+	in := map[string]interface{}{"pull_request_id": prID}
+	if opts != nil && opts.Force {
+		in["force"] = true
+		in["reason"] = opts.Reason
+	}
+	var out struct {
+		PR MergedPR `json:"pr"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/pullRequest/merge", in: in}, &out); err != nil {
+		return nil, err
+	}
+	return &out.PR, nil
+}
+
+// ReassignReviewer replaces oldReviewerID on the PR with another candidate.
+// It fails with CodePRMerged, CodeNotAssigned or CodeNoCandidate when the
+// reviewer cannot be replaced.
+func (c *Client) ReassignReviewer(ctx context.Context, prID, oldReviewerID string) (*Reassignment, error) {
+	in := map[string]string{"pull_request_id": prID, "old_reviewer_id": oldReviewerID}
+	var out Reassignment
+	if err := c.do(ctx, request{method: "POST", path: "/pullRequest/reassign", in: in}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SubmitReview records a verdict of an assigned reviewer.
+func (c *Client) SubmitReview(ctx context.Context, prID, reviewerID, verdict, comment string) (*PullRequest, error) {
+	in := map[string]string{"pull_request_id": prID, "reviewer_id": reviewerID, "verdict": verdict, "comment": comment}
+	var out struct {
+		PR PullRequest `json:"pr"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/pullRequest/review", in: in}, &out); err != nil {
+		return nil, err
+	}
+	return &out.PR, nil
+}
+
+// ListAudit returns the audit log of a PR.
+func (c *Client) ListAudit(ctx context.Context, prID string) ([]AuditEntry, error) {
+	var out struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	if err := c.do(ctx, request{method: "GET", path: "/pullRequest/audit", query: prQuery(prID)}, &out); err != nil {
+		return nil, err
+	}
+	return out.Entries, nil
+}
+
+func prQuery(prID string) url.Values {
+	return url.Values{"pull_request_id": {prID}}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/example/prreview/internal/app"
+	"github.com/example/prreview/internal/config"
+	"github.com/example/prreview/internal/testdb"
+)
+
+const adminToken = "admin-token"
+
+// newRouterClient serves the application router from httptest on a fresh
+// database from internal/testdb; the services run SQL in transactions, so
+// there is no repository to stand in for it.
+func newRouterClient(t *testing.T) *Client {
+	t.Helper()
+	cfg := config.Default()
+	cfg.DB.URL = testdb.New(t, nil).URL
+	cfg.DB.MigrationsDir = testdb.MigrationsDir
+	cfg.HTTP.DocsDir = "../../swagger-ui"
+	cfg.HTTP.ValidateResponses = true
+	cfg.Auth = config.AuthConfig{Enabled: true, Tokens: []config.APIToken{{Name: "admin", Token: adminToken, Admin: true}}}
+	a, err := app.NewApp(cfg, log.New(io.Discard, "", 0))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = a.DB.Close() })
+
+	srv := httptest.NewServer(a.Router)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL, WithToken(adminToken))
+	require.NoError(t, err)
+	return c
+}
+
+func TestClientAgainstRouter(t *testing.T) {
+	c := newRouterClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	team, err := c.AddTeam(ctx, "backend", []TeamMember{
+		{UserID: "u1", Username: "Alice", IsActive: true},
+		{UserID: "u2", Username: "Bob", IsActive: true},
+		{UserID: "u3", Username: "Carol", IsActive: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, team.Members, 3)
+
+	_, err = c.AddTeam(ctx, "backend", nil)
+	require.Equal(t, CodeTeamExists, ErrorCode(err))
+	_, err = c.GetTeam(ctx, "nope")
+	require.Equal(t, CodeNotFound, ErrorCode(err))
+
+	approvals := 1
+	require.NoError(t, c.SetRequiredApprovals(ctx, "backend", &approvals))
+	firstResponse := 4 * time.Hour
+	require.NoError(t, c.SetTeamSLA(ctx, "backend", SLASettings{FirstResponse: &firstResponse}))
+	team, err = c.GetTeam(ctx, "backend")
+	require.NoError(t, err)
+	require.Equal(t, &approvals, team.RequiredApprovals)
+	require.Equal(t, "4h0m0s", team.SLA.FirstResponse)
+
+	pr, err := c.CreatePR(ctx, NewPR{ID: "pr-1", Title: "Add search", AuthorID: "u1"})
+	require.NoError(t, err)
+	require.Len(t, pr.AssignedReviewers, 2)
+	require.NotContains(t, pr.AssignedReviewers, "u1")
+	_, err = c.CreatePR(ctx, NewPR{ID: "pr-1", Title: "Add search", AuthorID: "u1"})
+	require.Equal(t, CodePRExists, ErrorCode(err))
+
+	_, err = c.MergePR(ctx, "pr-1", nil)
+	require.Equal(t, CodeNotApproved, ErrorCode(err))
+
+	reviewer := pr.AssignedReviewers[0]
+	reviews, err := c.GetUserReviews(ctx, reviewer)
+	require.NoError(t, err)
+	require.Equal(t, "pr-1", reviews.PRs[0].PullRequestID)
+	require.Equal(t, 1, reviews.Load.OpenReviews)
+
+	pr, err = c.SubmitReview(ctx, "pr-1", reviewer, VerdictApproved, "lgtm")
+	require.NoError(t, err)
+	require.Equal(t, VerdictApproved, pr.Reviews[0].Verdict)
+
+	merged, err := c.MergePR(ctx, "pr-1", nil)
+	require.NoError(t, err)
+	require.Equal(t, "MERGED", merged.Status)
+	require.Equal(t, "u1", merged.AuthorID)
+
+	_, err = c.ReassignReviewer(ctx, "pr-1", reviewer)
+	require.Equal(t, CodePRMerged, ErrorCode(err))
+
+	got, err := c.GetPR(ctx, "pr-1")
+	require.NoError(t, err)
+	require.Equal(t, "MERGED", got.Status)
+
+	user, reassigned, err := c.SetUserActive(ctx, "u3", false)
+	require.NoError(t, err)
+	require.False(t, user.IsActive)
+	require.Empty(t, reassigned)
+
+	summary, err := c.Import(ctx, []byte("team_name,user_id,username\nfrontend,u4,Dave\n"), FormatCSV, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.TeamsCreated)
+	_, err = c.GetTeam(ctx, "frontend")
+	require.Equal(t, CodeNotFound, ErrorCode(err))
+
+	export, err := c.Export(ctx, FormatCSV)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(export), "team_name,user_id,username"))
+	require.Contains(t, string(export), "backend,u3,Carol,false")
+}
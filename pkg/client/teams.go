@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"net/url"
+)
+
+// AddTeam creates a team; members that do not exist yet are created, existing
+// ones are added to the team.
+func (c *Client) AddTeam(ctx context.Context, name string, members []TeamMember) (*Team, error) {
+	if members == nil {
+		members = []TeamMember{}
+	}
+	in := map[string]interface{}{"team_name": name, "members": members}
+	var out struct {
+		Team Team `json:"team"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/team/add", in: in}, &out); err != nil {
+		return nil, err
+	}
+	return &out.Team, nil
+}
+
+func (c *Client) GetTeam(ctx context.Context, name string) (*Team, error) {
+	var out struct {
+		Team Team `json:"team"`
+	}
+	if err := c.do(ctx, request{method: "GET", path: "/team/get", query: teamQuery(name)}, &out); err != nil {
+		return nil, err
+	}
+	return &out.Team, nil
+}
+
+// SetCodeowners replaces the team's CODEOWNERS file.
+func (c *Client) SetCodeowners(ctx context.Context, team, content string) error {
+	in := map[string]string{"team_name": team, "codeowners": content}
+	return c.do(ctx, request{method: "POST", path: "/team/codeowners", in: in}, nil)
+}
+
+func (c *Client) GetCodeowners(ctx context.Context, team string) (string, error) {
+	var out struct {
+		Codeowners struct {
+			Codeowners string `json:"codeowners"`
+		} `json:"codeowners"`
+	}
+	if err := c.do(ctx, request{method: "GET", path: "/team/codeowners", query: teamQuery(team)}, &out); err != nil {
+		return "", err
+	}
+	return out.Codeowners.Codeowners, nil
+}
+
+// SetFallbacks replaces the ordered list of teams that supply reviewers when
+// the team has too few candidates.
+func (c *Client) SetFallbacks(ctx context.Context, team string, fallbacks []string) error {
+	if fallbacks == nil {
+		fallbacks = []string{}
+	}
+	in := map[string]interface{}{"team_name": team, "fallback_teams": fallbacks}
+	return c.do(ctx, request{method: "POST", path: "/team/fallbacks", in: in}, nil)
+}
+
+func (c *Client) GetFallbacks(ctx context.Context, team string) ([]string, error) {
+	var out struct {
+		Fallbacks struct {
+			FallbackTeams []string `json:"fallback_teams"`
+		} `json:"fallbacks"`
+	}
+	if err := c.do(ctx, request{method: "GET", path: "/team/fallbacks", query: teamQuery(team)}, &out); err != nil {
+		return nil, err
+	}
+	return out.Fallbacks.FallbackTeams, nil
+}
+
+// SetTeamMaxOpenReviews sets the open review limit of members without their
+// own; nil falls back to the configured default.
+func (c *Client) SetTeamMaxOpenReviews(ctx context.Context, team string, limit *int) error {
+	in := map[string]interface{}{"team_name": team, "max_open_reviews": limit}
+	return c.do(ctx, request{method: "POST", path: "/team/setMaxOpenReviews", in: in}, nil)
+}
+
+// SetRequiredApprovals sets how many approvals the team's PRs need to merge;
+// nil falls back to the configured default.
+func (c *Client) SetRequiredApprovals(ctx context.Context, team string, n *int) error {
+	in := map[string]interface{}{"team_name": team, "required_approvals": n}
+	return c.do(ctx, request{method: "POST", path: "/team/setRequiredApprovals", in: in}, nil)
+}
+
+func (c *Client) SetTeamSLA(ctx context.Context, team string, sla SLASettings) error {
+	in := map[string]interface{}{"team_name": team, "lead_user_id": sla.LeadUserID}
+	if sla.FirstResponse != nil {
+		in["first_response"] = sla.FirstResponse.String()
+	}
+	if sla.Verdict != nil {
+		in["verdict"] = sla.Verdict.String()
+	}
+	return c.do(ctx, request{method: "POST", path: "/team/setSLA", in: in}, nil)
+}
+
+// ArchiveTeam archives a team and moves its open PRs to successor, if set.
+// It returns the moved PRs.
+func (c *Client) ArchiveTeam(ctx context.Context, team, successor string) ([]string, error) {
+	return c.retireTeam(ctx, "/team/archive", team, successor)
+}
+
+// DeleteTeam deletes a team, moving its open PRs to successor as ArchiveTeam.
+func (c *Client) DeleteTeam(ctx context.Context, team, successor string) ([]string, error) {
+	return c.retireTeam(ctx, "/team/delete", team, successor)
+}
+
+func (c *Client) retireTeam(ctx context.Context, path, team, successor string) ([]string, error) {
+	in := map[string]string{"team_name": team, "successor_team": successor}
+	var out struct {
+		TransferredPRs []string `json:"transferred_prs"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: path, in: in}, &out); err != nil {
+		return nil, err
+	}
+	return out.TransferredPRs, nil
+}
+
+func (c *Client) UnarchiveTeam(ctx context.Context, team string) error {
+	in := map[string]string{"team_name": team}
+	return c.do(ctx, request{method: "POST", path: "/team/unarchive", in: in}, nil)
+}
+
+func teamQuery(team string) url.Values {
+	return url.Values{"team_name": {team}}
+}
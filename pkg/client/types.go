@@ -0,0 +1,129 @@
+package client
+
+import (
+	"time"
+
+	"github.com/example/prreview/internal/models"
+)
+
+// Responses shared with the server are aliases of its models, so the two
+// cannot drift apart.
+type (
+	Team             = models.TeamResp
+	TeamMember       = models.TeamMemberResp
+	TeamSLA          = models.TeamSLAResp
+	User             = models.UserResp
+	PullRequest      = models.PullRequestResp
+	PullRequestShort = models.PullRequestShortResp
+	Review           = models.ReviewResp
+	ReviewLoad       = models.ReviewLoadResp
+	AuditEntry       = models.AuditEntryResp
+	Absence          = models.AbsenceResp
+	Handoff          = models.HandoffResp
+	Notifications    = models.NotificationSettings
+)
+
+// Verdicts of SubmitReview.
+const (
+	VerdictApproved         = "APPROVED"
+	VerdictChangesRequested = "CHANGES_REQUESTED"
+	VerdictCommented        = "COMMENTED"
+)
+
+type NewPR struct {
+	ID       string `json:"pull_request_id"`
+	Title    string `json:"pull_request_name"`
+	AuthorID string `json:"author_id"`
+	// TeamName is required when the author is in several teams.
+	TeamName     string   `json:"team_name,omitempty"`
+	ChangedFiles []string `json:"changed_files,omitempty"`
+}
+
+// MergedPR is the PR as /pullRequest/merge returns it.
+type MergedPR struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	AuthorID  string   `json:"author"`
+	Status    string   `json:"status"`
+	Reviewers []string `json:"reviewers"`
+	Reviews   []Review `json:"reviews"`
+}
+
+type MergeOptions struct {
+	// Force merges without the required approvals; it needs an admin token
+	// and a Reason for the audit log.
+	Force  bool
+	Reason string
+}
+
+type Reassignment struct {
+	PR struct {
+		ID                string            `json:"id"`
+		Title             string            `json:"title"`
+		AuthorID          string            `json:"author"`
+		FallbackReviewers map[string]string `json:"fallback_reviewers,omitempty"`
+	} `json:"pr"`
+	ReplacedBy string `json:"replaced_by"`
+}
+
+type NewUser struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	// IsActive defaults to true.
+	IsActive    *bool    `json:"is_active,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	SlackUserID string   `json:"slack_user_id,omitempty"`
+	Teams       []string `json:"teams,omitempty"`
+}
+
+// UserUpdate changes only the fields that are set.
+type UserUpdate struct {
+	Username    *string `json:"username,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	SlackUserID *string `json:"slack_user_id,omitempty"`
+	// Notifications changes the user's email opt-ins.
+	Notifications *NotificationsUpdate `json:"notifications,omitempty"`
+}
+
+// NotificationsUpdate changes only the email opt-ins that are set.
+type NotificationsUpdate struct {
+	Assignments *bool `json:"assignments,omitempty"`
+	Digest      *bool `json:"digest,omitempty"`
+}
+
+type UserReviews struct {
+	UserID string             `json:"user_id"`
+	PRs    []PullRequestShort `json:"prs"`
+	Load   ReviewLoad         `json:"load"`
+}
+
+// SLASettings replaces all SLA settings of a team: a nil duration falls
+// back to the configured default and a nil LeadUserID clears the lead.
+type SLASettings struct {
+	FirstResponse *time.Duration
+	Verdict       *time.Duration
+	LeadUserID    *string
+}
+
+// Reassigned maps PR ids to their new reviewer, "" where the user was kept
+// for lack of a candidate.
+type Reassigned map[string]string
+
+// Import formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+type ImportSummary struct {
+	TeamsCreated     int        `json:"teams_created"`
+	UsersCreated     int        `json:"users_created"`
+	UsersUpdated     int        `json:"users_updated"`
+	MembershipsAdded int        `json:"memberships_added"`
+	Reassigned       Reassigned `json:"reassigned,omitempty"`
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"net/url"
+)
+
+func (c *Client) CreateUser(ctx context.Context, u NewUser) (*User, error) {
+	var out struct {
+		User User `json:"user"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/users/create", in: u}, &out); err != nil {
+		return nil, err
+	}
+	return &out.User, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, userID string) (*User, error) {
+	var out struct {
+		User User `json:"user"`
+	}
+	if err := c.do(ctx, request{method: "GET", path: "/users/get", query: userQuery(userID)}, &out); err != nil {
+		return nil, err
+	}
+	return &out.User, nil
+}
+
+func (c *Client) UpdateUser(ctx context.Context, userID string, upd UserUpdate) (*User, error) {
+	in := struct {
+		UserID string `json:"user_id"`
+		UserUpdate
+	}{userID, upd}
+	var out struct {
+		User User `json:"user"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/users/update", in: in}, &out); err != nil {
+		return nil, err
+	}
+	return &out.User, nil
+}
+
+// DeleteUser removes a user that authored no PRs. Their open reviews are
+// handed to other reviewers first.
+func (c *Client) DeleteUser(ctx context.Context, userID string) (Reassigned, error) {
+	in := map[string]string{"user_id": userID}
+	var out struct {
+		Reassigned Reassigned `json:"reassigned"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/users/delete", in: in}, &out); err != nil {
+		return nil, err
+	}
+	return out.Reassigned, nil
+}
+
+// SetUserActive activates or deactivates a user. Deactivation hands the
+// user's open reviews to other reviewers.
+func (c *Client) SetUserActive(ctx context.Context, userID string, active bool) (*User, Reassigned, error) {
+	in := map[string]interface{}{"user_id": userID, "is_active": active}
+	var out struct {
+		User       User       `json:"user"`
+		Reassigned Reassigned `json:"reassigned"`
+	}
+	if err := c.do(ctx, request{method: "POST", path: "/users/setIsActive", in: in}, &out); err != nil {
+		return nil, nil, err
+	}
+	return &out.User, out.Reassigned, nil
+}
+
+// GetUserReviews returns the PRs the user reviews and their review load.
+func (c *Client) GetUserReviews(ctx context.Context, userID string) (*UserReviews, error) {
+	var out UserReviews
+	if err := c.do(ctx, request{method: "GET", path: "/users/getReview", query: userQuery(userID)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetUserMaxOpenReviews sets the user's own open review limit; nil falls
+// back to the team's.
+func (c *Client) SetUserMaxOpenReviews(ctx context.Context, userID string, limit *int) error {
+	in := map[string]interface{}{"user_id": userID, "max_open_reviews": limit}
+	return c.do(ctx, request{method: "POST", path: "/users/setMaxOpenReviews", in: in}, nil)
+}
+
+func userQuery(userID string) url.Values {
+	return url.Values{"user_id": {userID}}
+}